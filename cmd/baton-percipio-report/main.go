@@ -7,11 +7,13 @@ import (
 	"time"
 
 	"github.com/conductorone/baton-sdk/pkg/config"
-	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/types"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
 	cfg "github.com/iiiatthew/baton-percipio-report/pkg/config"
 	"github.com/iiiatthew/baton-percipio-report/pkg/connector"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
@@ -45,6 +47,8 @@ func main() {
 }
 
 func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, error) {
+	// Everything logged while setting up, the SDK included, is redacted.
+	ctx = logging.ToContext(ctx)
 	l := ctxzap.Extract(ctx)
 
 	// Parse the lookback duration with priority: days > years
@@ -68,20 +72,81 @@ func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, e
 		l.Info("Using default lookback (10 years)", zap.Duration("duration", lookbackDuration))
 	}
 
+	userAttributes, err := connector.ParseUserAttributes(v.GetStringSlice(cfg.UserProfileAttributesField.FieldName))
+	if err != nil {
+		l.Error("error parsing user profile attributes", zap.Error(err))
+		return nil, err
+	}
+
 	cb, err := connector.New(
 		ctx,
 		v.GetString(cfg.OrganizationIdField.FieldName),
 		v.GetString(cfg.ApiTokenField.FieldName),
 		lookbackDuration,
+		connector.WithStateDir(v.GetString(cfg.StateDirField.FieldName)),
+		connector.WithStateEncryption(state.EncryptionOptions{
+			Recipients:   v.GetStringSlice(cfg.StateEncryptionRecipientsField.FieldName),
+			IdentityFile: v.GetString(cfg.StateEncryptionIdentityFileField.FieldName),
+			Passphrase:   v.GetString(cfg.StateEncryptionPassphraseField.FieldName),
+			Required:     v.GetBool(cfg.StateEncryptionRequiredField.FieldName),
+		}),
+		connector.WithGuardrails(connector.Guardrails{
+			MinRows:                  v.GetInt(cfg.MinReportRowsField.FieldName),
+			MaxUserDropPercent:       v.GetInt(cfg.MaxUserDropPercentField.FieldName),
+			MaxCourseDropPercent:     v.GetInt(cfg.MaxCourseDropPercentField.FieldName),
+			MaxCompletionDropPercent: v.GetInt(cfg.MaxCompletionDropPercentField.FieldName),
+		}),
+		connector.WithReportFallback(time.Duration(v.GetInt(cfg.ReportFallbackMaxAgeHoursField.FieldName))*time.Hour),
+		connector.WithPageSize(v.GetInt(cfg.PageSizeField.FieldName)),
+		connector.WithCatalog(connector.CatalogOptions{
+			Enabled:         v.GetBool(cfg.CatalogEnrichmentField.FieldName),
+			PublishInactive: v.GetBool(cfg.CatalogPublishInactiveField.FieldName),
+			CacheMaxAge:     time.Duration(v.GetInt(cfg.CatalogCacheHoursField.FieldName)) * time.Hour,
+		}),
+		connector.WithUserAttributes(userAttributes),
+		connector.WithUserIdentity(connector.UserIdentity{
+			IdField:          v.GetString(cfg.UserIdFieldField.FieldName),
+			LoginField:       v.GetString(cfg.UserLoginFieldField.FieldName),
+			EmailFields:      v.GetStringSlice(cfg.UserEmailFieldsField.FieldName),
+			EmployeeIdFields: v.GetStringSlice(cfg.UserEmployeeIdFieldsField.FieldName),
+			MissingId:        connector.MissingIdPolicy(v.GetString(cfg.MissingUserIdPolicyField.FieldName)),
+		}),
+		connector.WithUserMerge(v.GetStringSlice(cfg.MergeUsersByField.FieldName)),
+		connector.WithGroups(connector.GroupOptions{
+			Attribute: v.GetString(cfg.GroupByField.FieldName),
+			Separator: v.GetString(cfg.GroupBySeparatorField.FieldName),
+		}),
+		connector.WithRoles(v.GetBool(cfg.RolesField.FieldName)),
+		connector.WithEntitlements(connector.EntitlementOptions{
+			Entitlements:        v.GetStringSlice(cfg.CourseEntitlementsField.FieldName),
+			DisplayNameTemplate: v.GetString(cfg.EntitlementDisplayNameTemplateField.FieldName),
+			DescriptionTemplate: v.GetString(cfg.EntitlementDescriptionTemplateField.FieldName),
+		}),
+		connector.WithEverCompleted(v.GetBool(cfg.EverCompletedField.FieldName)),
+		connector.WithAssignments(v.GetBool(cfg.AssignmentsField.FieldName)),
+		connector.WithAssessments(connector.AssessmentOptions{
+			PassScore: float64(v.GetInt(cfg.AssessmentPassScoreField.FieldName)),
+			Attempt:   v.GetString(cfg.AssessmentAttemptField.FieldName),
+		}),
+		connector.WithStatusStore(client.StatusStoreOptions{
+			Kind:     v.GetString(cfg.StatusStoreField.FieldName),
+			DiskRows: v.GetInt(cfg.StatusStoreDiskRowsField.FieldName),
+			Dir:      v.GetString(cfg.StatusStoreDirField.FieldName),
+		}),
+		connector.WithLogRedaction(logging.RedactionOptions{
+			Mode:    v.GetString(cfg.LogRedactionField.FieldName),
+			HashKey: v.GetString(cfg.LogRedactionKeyField.FieldName),
+		}),
+		connector.WithDormancyWindow(time.Duration(v.GetInt(cfg.DormantAfterDaysField.FieldName))*24*time.Hour),
 	)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
 	}
-	connector, err := connectorbuilder.NewConnector(ctx, cb)
+	server, err := connector.NewServer(ctx, cb)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
 	}
-	return connector, nil
+	return server, nil
 }
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ContentTypeAssessment is the content type of Percipio assessments.
+const ContentTypeAssessment = "Assessment"
+
+const (
+	// AttemptBest scores an assessment by its highest scoring attempt.
+	AttemptBest = "best"
+	// AttemptLatest scores an assessment by its latest attempt.
+	AttemptLatest = "latest"
+)
+
+// Attempts lists the supported ways of picking the attempt an assessment is
+// scored by.
+var Attempts = []string{AttemptBest, AttemptLatest}
+
+// AssessmentResult is a learner's score on an assessment.
+type AssessmentResult struct {
+	// Attempt is the attempt the score is from, AttemptBest or AttemptLatest.
+	Attempt  string
+	Score    float64
+	Attempts int
+	// PassingScore is the pass threshold the report gives, or zero when it
+	// doesn't give one.
+	PassingScore float64
+}
+
+// IsAssessment reports whether the row is for an assessment.
+func (e *ReportEntry) IsAssessment() bool {
+	return strings.EqualFold(strings.TrimSpace(e.ContentType), ContentTypeAssessment)
+}
+
+// AssessmentResult returns the row's score for the given attempt. When the
+// report only has the other attempt's score, that one is used, and the
+// result's Attempt says so. It returns false when the row has no score.
+func (e *ReportEntry) AssessmentResult(attempt string) (AssessmentResult, bool) {
+	if attempt != AttemptLatest {
+		attempt = AttemptBest
+	}
+	scores := map[string]string{AttemptBest: e.HighScore, AttemptLatest: e.LastScore}
+	order := []string{AttemptBest, AttemptLatest}
+	if attempt == AttemptLatest {
+		order = []string{AttemptLatest, AttemptBest}
+	}
+
+	var result AssessmentResult
+	found := false
+	for _, candidate := range order {
+		if score, ok := parseScore(scores[candidate]); ok {
+			result.Attempt, result.Score, found = candidate, score, true
+			break
+		}
+	}
+	if !found {
+		return AssessmentResult{}, false
+	}
+	if attempts, err := strconv.Atoi(strings.TrimSpace(e.Attempts)); err == nil && attempts > 0 {
+		result.Attempts = attempts
+	}
+	if passingScore, ok := parseScore(e.PassingScore); ok {
+		result.PassingScore = passingScore
+	}
+	return result, true
+}
+
+// Passed reports whether the score meets the pass threshold, which is the
+// report's own when it gives one and passScore otherwise.
+func (r AssessmentResult) Passed(passScore float64) bool {
+	if r.PassingScore > 0 {
+		passScore = r.PassingScore
+	}
+	return r.Score >= passScore
+}
+
+// parseScore parses a score such as "85", "85.5" or "85%".
+func parseScore(value string) (float64, bool) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	if value == "" {
+		return 0, false
+	}
+	score, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return score, true
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssessmentResult(t *testing.T) {
+	t.Run("should read numeric assessment columns", func(t *testing.T) {
+		var entry ReportEntry
+		err := json.Unmarshal([]byte(`{
+			"contentType": "Assessment",
+			"highScore": 92.5,
+			"lastScore": "70%",
+			"attempts": 3,
+			"passingScore": 75
+		}`), &entry)
+		require.NoError(t, err)
+		assert.True(t, entry.IsAssessment())
+		assert.Equal(t, "92.5", entry.HighScore)
+		assert.Equal(t, "3", entry.Attempts)
+
+		best, ok := entry.AssessmentResult(AttemptBest)
+		require.True(t, ok)
+		assert.Equal(t, AssessmentResult{Attempt: AttemptBest, Score: 92.5, Attempts: 3, PassingScore: 75}, best)
+		assert.True(t, best.Passed(80))
+
+		latest, ok := entry.AssessmentResult(AttemptLatest)
+		require.True(t, ok)
+		assert.Equal(t, 70.0, latest.Score)
+		// The report's threshold wins over the configured pass score.
+		assert.False(t, latest.Passed(60))
+	})
+
+	t.Run("should fall back to the other attempt's score", func(t *testing.T) {
+		entry := ReportEntry{HighScore: "88"}
+		result, ok := entry.AssessmentResult(AttemptLatest)
+		require.True(t, ok)
+		assert.Equal(t, 88.0, result.Score)
+		assert.Equal(t, AttemptBest, result.Attempt)
+		assert.Zero(t, result.PassingScore)
+		assert.True(t, result.Passed(80))
+		assert.False(t, result.Passed(90))
+	})
+
+	t.Run("should say the latest attempt was used when there's no high score", func(t *testing.T) {
+		entry := ReportEntry{LastScore: "70"}
+		result, ok := entry.AssessmentResult(AttemptBest)
+		require.True(t, ok)
+		assert.Equal(t, AttemptLatest, result.Attempt)
+		assert.Equal(t, 70.0, result.Score)
+	})
+
+	t.Run("should have no result without a score", func(t *testing.T) {
+		entry := ReportEntry{ContentType: "Course", Attempts: "2", HighScore: "n/a"}
+		_, ok := entry.AssessmentResult(AttemptBest)
+		assert.False(t, ok)
+		assert.False(t, entry.IsAssessment())
+	})
+
+	t.Run("should round trip scores through JSON", func(t *testing.T) {
+		entry := ReportEntry{UserId: "michael.bolton@initech.com", HighScore: "90", Attempts: "2"}
+		data, err := json.Marshal(entry)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "lastScore")
+
+		var decoded ReportEntry
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, entry, decoded)
+	})
+}
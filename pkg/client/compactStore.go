@@ -0,0 +1,279 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Status is a course status as a small integer, so stores don't keep a
+// string per user and course.
+type Status uint8
+
+const (
+	StatusNoStatusReported Status = iota
+	StatusInProgress
+	StatusCompleted
+	StatusUndefined
+)
+
+var statusNames = [...]string{
+	StatusNoStatusReported: "no_status_reported",
+	StatusInProgress:       "in_progress",
+	StatusCompleted:        "completed",
+	StatusUndefined:        "status_undefined",
+}
+
+// String returns the status name, which is also its entitlement slug.
+func (s Status) String() string {
+	if int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+	return statusNames[StatusUndefined]
+}
+
+// reportStatus maps a status as the report has it to a Status.
+func reportStatus(status string) Status {
+	switch status {
+	case "":
+		return StatusNoStatusReported
+	case "Completed", "Achieved", "Listened", "Read", "Watched":
+		return StatusCompleted
+	case "Started", "Active":
+		return StatusInProgress
+	default:
+		return StatusUndefined
+	}
+}
+
+// Interner assigns each distinct ID a dense integer index, so an ID is kept
+// once however many times it is referenced.
+type Interner struct {
+	ids   []string
+	index map[string]uint32
+}
+
+// NewInterner returns an empty interner.
+func NewInterner() *Interner {
+	return &Interner{index: make(map[string]uint32)}
+}
+
+// Intern returns the index of id, assigning the next one if it is new.
+func (i *Interner) Intern(id string) uint32 {
+	if n, ok := i.index[id]; ok {
+		return n
+	}
+	n := uint32(len(i.ids))
+	i.ids = append(i.ids, id)
+	i.index[id] = n
+	return n
+}
+
+// Lookup returns the index of id, if it has one.
+func (i *Interner) Lookup(id string) (uint32, bool) {
+	n, ok := i.index[id]
+	return n, ok
+}
+
+// Id returns the ID with index n.
+func (i *Interner) Id(n uint32) string {
+	return i.ids[n]
+}
+
+// Len returns the number of interned IDs.
+func (i *Interner) Len() int {
+	return len(i.ids)
+}
+
+// statusEntry packs a user index and a status into four bytes: the status in
+// the low two bits, the user index above them.
+type statusEntry uint32
+
+const statusEntryBits = 2
+
+func newStatusEntry(user uint32, status Status) statusEntry {
+	return statusEntry(user<<statusEntryBits | uint32(status))
+}
+
+func (e statusEntry) user() uint32 {
+	return uint32(e) >> statusEntryBits
+}
+
+func (e statusEntry) status() Status {
+	return Status(e & (1<<statusEntryBits - 1))
+}
+
+// CompactStatusesStore is a StatusesStore that interns user and course IDs
+// and keeps, per course, a slice of packed user and status entries sorted by
+// user ID, so Statuses can start anywhere with a binary search. It takes a
+// fraction of the memory of MapStatusesStore on large reports.
+type CompactStatusesStore struct {
+	users   *Interner
+	courses *Interner
+	// statuses is indexed by course index.
+	statuses [][]statusEntry
+}
+
+// NewCompactStatusesStore returns an empty store.
+func NewCompactStatusesStore() *CompactStatusesStore {
+	return &CompactStatusesStore{
+		users:   NewInterner(),
+		courses: NewInterner(),
+	}
+}
+
+// Load interns the users and courses of the report and records their
+// statuses in one pass over it.
+func (s *CompactStatusesStore) Load(ctx context.Context, report *Report) error {
+	logger := logging.Extract(ctx)
+	startTime := time.Now()
+
+	logger.Debug("Starting to load compact status store from report",
+		zap.Int("report_entries", len(*report)))
+
+	statusCounts := make(map[string]int)
+	touched := make([]bool, len(s.statuses))
+	for i := range *report {
+		row := &(*report)[i]
+		course := s.courses.Intern(row.ContentId)
+		if int(course) == len(s.statuses) {
+			s.statuses = append(s.statuses, nil)
+			touched = append(touched, false)
+		}
+		status := reportStatus(row.Status)
+		s.statuses[course] = append(s.statuses[course], newStatusEntry(s.users.Intern(row.UserId), status))
+		touched[course] = true
+		statusCounts[status.String()]++
+	}
+
+	// Later rows win, like in MapStatusesStore.
+	for course, wasTouched := range touched {
+		if wasTouched {
+			s.statuses[course] = s.sortById(compactEntries(s.statuses[course], func(_, next statusEntry) statusEntry { return next }))
+		}
+	}
+
+	logger.Info("Status store loaded successfully",
+		zap.Int("total_entries", len(*report)),
+		zap.Int("unique_courses", s.courses.Len()),
+		zap.Int("unique_users", s.users.Len()),
+		zap.Any("status_distribution", statusCounts),
+		zap.Duration("duration", time.Since(startTime)))
+
+	return nil
+}
+
+// compactEntries sorts entries by user index and keeps one entry per user,
+// chosen by keep from the earlier and later entries of that user.
+func compactEntries(entries []statusEntry, keep func(previous, next statusEntry) statusEntry) []statusEntry {
+	slices.SortStableFunc(entries, func(a, b statusEntry) int {
+		return int(a.user()) - int(b.user())
+	})
+	compacted := entries[:0]
+	for _, entry := range entries {
+		if n := len(compacted); n > 0 && compacted[n-1].user() == entry.user() {
+			compacted[n-1] = keep(compacted[n-1], entry)
+			continue
+		}
+		compacted = append(compacted, entry)
+	}
+	return slices.Clip(compacted)
+}
+
+// sortById orders entries by user ID, once compactEntries has left one
+// entry per user.
+func (s *CompactStatusesStore) sortById(entries []statusEntry) []statusEntry {
+	slices.SortFunc(entries, func(a, b statusEntry) int {
+		return strings.Compare(s.users.Id(a.user()), s.users.Id(b.user()))
+	})
+	return entries
+}
+
+// Get returns a mapping of user IDs to statuses for a course, built on each
+// call.
+func (s *CompactStatusesStore) Get(courseId string) (map[string]string, error) {
+	return collectStatuses(s, courseId)
+}
+
+// Statuses calls yield with the statuses of a course in user ID order,
+// starting after the user ID after.
+func (s *CompactStatusesStore) Statuses(courseId string, after string, yield func(userId string, status string) bool) error {
+	course, ok := s.courses.Lookup(courseId)
+	if !ok {
+		return nil
+	}
+	entries := s.statuses[course]
+	start := 0
+	if after != "" {
+		start, _ = slices.BinarySearchFunc(entries, after, func(entry statusEntry, after string) int {
+			if s.users.Id(entry.user()) <= after {
+				return -1
+			}
+			return 1
+		})
+	}
+	for _, entry := range entries[start:] {
+		if !yield(s.users.Id(entry.user()), entry.status().String()) {
+			break
+		}
+	}
+	return nil
+}
+
+// Merge moves the statuses of users to the users they were merged into,
+// keeping the more advanced status when both have one. It returns how many
+// statuses were moved.
+func (s *CompactStatusesStore) Merge(survivors map[string]string) (int, error) {
+	renames := make(map[uint32]uint32, len(survivors))
+	for userId, survivor := range survivors {
+		if user, ok := s.users.Lookup(userId); ok {
+			renames[user] = s.users.Intern(survivor)
+		}
+	}
+	if len(renames) == 0 {
+		return 0, nil
+	}
+
+	moved := 0
+	for course, entries := range s.statuses {
+		changed := false
+		for i, entry := range entries {
+			if survivor, ok := renames[entry.user()]; ok {
+				entries[i] = newStatusEntry(survivor, entry.status())
+				changed = true
+				moved++
+			}
+		}
+		if changed {
+			s.statuses[course] = s.sortById(compactEntries(entries, func(previous, next statusEntry) statusEntry {
+				if statusRank(next.status().String()) > statusRank(previous.status().String()) {
+					return next
+				}
+				return previous
+			}))
+		}
+	}
+	return moved, nil
+}
+
+// Courses iterates over the IDs of the courses with statuses, in the order
+// they first appear in the report.
+func (s *CompactStatusesStore) Courses() (iter.Seq[string], error) {
+	return func(yield func(string) bool) {
+		for course, entries := range s.statuses {
+			if len(entries) > 0 && !yield(s.courses.Id(uint32(course))) {
+				return
+			}
+		}
+	}, nil
+}
+
+// Len returns the number of courses with statuses.
+func (s *CompactStatusesStore) Len() (int, error) {
+	return s.courses.Len(), nil
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactStatusesStore(t *testing.T) {
+	ctx := context.Background()
+	report := &Report{
+		{UserId: "michael.bolton", ContentId: "course-b", Status: "Completed"},
+		{UserId: "milton.waddams", ContentId: "course-b", Status: "Started"},
+		{UserId: "michael.bolton", ContentId: "course-a", Status: "Active"},
+		{UserId: "peter.gibbons", ContentId: "course-b", Status: ""},
+		{UserId: "bill.lumbergh", ContentId: "course-b", Status: "UnknownStatus"},
+		{UserId: "milton.waddams", ContentId: "course-b", Status: "Watched"},
+	}
+
+	t.Run("should match the map store", func(t *testing.T) {
+		compact := NewCompactStatusesStore()
+		require.NoError(t, compact.Load(ctx, report))
+		mapped := make(MapStatusesStore)
+		require.NoError(t, mapped.Load(ctx, report))
+
+		assert.Equal(t, courseCount(t, mapped), courseCount(t, compact))
+		for _, courseId := range courseIds(t, mapped) {
+			assert.Equal(t, getStatuses(t, mapped, courseId), getStatuses(t, compact, courseId), courseId)
+		}
+		assert.Equal(t, map[string]string{
+			"michael.bolton": "completed",
+			"milton.waddams": "completed",
+			"peter.gibbons":  "no_status_reported",
+			"bill.lumbergh":  "status_undefined",
+		}, getStatuses(t, compact, "course-b"))
+	})
+
+	t.Run("should iterate courses in report order", func(t *testing.T) {
+		compact := NewCompactStatusesStore()
+		require.NoError(t, compact.Load(ctx, report))
+
+		assert.Equal(t, []string{"course-b", "course-a"}, courseIds(t, compact))
+		assert.Nil(t, getStatuses(t, compact, "missing"))
+	})
+
+	t.Run("should merge users keeping the more advanced status", func(t *testing.T) {
+		compact := NewCompactStatusesStore()
+		require.NoError(t, compact.Load(ctx, report))
+		mapped := make(MapStatusesStore)
+		require.NoError(t, mapped.Load(ctx, report))
+		survivors := map[string]string{"peter.gibbons": "michael.bolton", "bill.lumbergh": "samir"}
+
+		assert.Equal(t, mergeStatuses(t, mapped, survivors), mergeStatuses(t, compact, survivors))
+		assert.Equal(t, map[string]string{
+			"michael.bolton": "completed",
+			"milton.waddams": "completed",
+			"samir":          "status_undefined",
+		}, getStatuses(t, compact, "course-b"))
+		for _, courseId := range courseIds(t, mapped) {
+			assert.Equal(t, getStatuses(t, mapped, courseId), getStatuses(t, compact, courseId), courseId)
+		}
+	})
+
+	t.Run("should copy into a map store", func(t *testing.T) {
+		compact := NewCompactStatusesStore()
+		require.NoError(t, compact.Load(ctx, report))
+
+		copied, err := CopyStatuses(compact)
+		require.NoError(t, err)
+		assert.Len(t, copied, 2)
+		assert.Equal(t, getStatuses(t, compact, "course-a"), copied["course-a"])
+		copied, err = CopyStatuses(nil)
+		require.NoError(t, err)
+		assert.Empty(t, copied)
+	})
+}
+
+func TestStatusEntry(t *testing.T) {
+	t.Run("should pack the user and status", func(t *testing.T) {
+		entry := newStatusEntry(123456, StatusCompleted)
+		assert.Equal(t, uint32(123456), entry.user())
+		assert.Equal(t, StatusCompleted, entry.status())
+	})
+
+	t.Run("should name statuses by their entitlement slug", func(t *testing.T) {
+		assert.Equal(t, "in_progress", StatusInProgress.String())
+		assert.Equal(t, "status_undefined", Status(42).String())
+	})
+}
+
+// benchmarkReport returns a report of users taking courses, each user taking
+// coursesPerUser of them.
+func benchmarkReport(users int, courses int, coursesPerUser int) *Report {
+	statuses := []string{"Completed", "Started", "", "Watched"}
+	report := make(Report, 0, users*coursesPerUser)
+	for u := 0; u < users; u++ {
+		for c := 0; c < coursesPerUser; c++ {
+			report = append(report, ReportEntry{
+				UserId:    fmt.Sprintf("00000000-0000-0000-0000-%012d", u),
+				ContentId: fmt.Sprintf("11111111-0000-0000-0000-%012d", (u*7+c)%courses),
+				Status:    statuses[(u+c)%len(statuses)],
+			})
+		}
+	}
+	return &report
+}
+
+// retainedBytes reports how much heap the store built by load keeps alive.
+func retainedBytes(load func() StatusesStore) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	store := load()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(store)
+	if after.HeapAlloc < before.HeapAlloc {
+		return 0
+	}
+	return after.HeapAlloc - before.HeapAlloc
+}
+
+func BenchmarkStatusesStoreLoad(b *testing.B) {
+	ctx := context.Background()
+	// Both stores share the ID strings with the report, so retained-B is
+	// what each store adds on top of it.
+	report := benchmarkReport(20000, 500, 10)
+
+	for _, bench := range []struct {
+		name  string
+		store func() StatusesStore
+	}{
+		{"map", func() StatusesStore { return make(MapStatusesStore) }},
+		{"compact", func() StatusesStore { return NewCompactStatusesStore() }},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				store := bench.store()
+				if err := store.Load(ctx, report); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			retained := retainedBytes(func() StatusesStore {
+				store := bench.store()
+				_ = store.Load(ctx, report)
+				return store
+			})
+			b.ReportMetric(float64(retained), "retained-B")
+			b.ReportMetric(float64(retained)/float64(len(*report)), "retained-B/row")
+		})
+	}
+}
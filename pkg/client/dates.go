@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// ErrUnparsableDate is returned for dates in none of the known layouts.
+var ErrUnparsableDate = errors.New("unparsable date")
+
+// dateLayouts are the layouts Percipio has been seen to use for dates, with
+// and without fractional seconds and offsets. Layouts without an offset are
+// read as UTC.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+}
+
+// maxUnparsableDateSamples caps how many unparsable values are logged.
+const maxUnparsableDateSamples = 5
+
+// ParseDate parses a date as Percipio emits it, returning it in UTC. An empty
+// value is the zero time.
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range dateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %q", ErrUnparsableDate, value)
+}
+
+// FormatDate normalizes a date for publishing as RFC 3339 in UTC. Values that
+// don't parse are returned unchanged.
+func FormatDate(value string) string {
+	parsed, err := ParseDate(value)
+	if err != nil || parsed.IsZero() {
+		return value
+	}
+	return parsed.Format(time.RFC3339)
+}
+
+// CompletedAt returns the entry's completion date, or the zero time if it
+// has none.
+func (e *ReportEntry) CompletedAt() (time.Time, error) {
+	return ParseDate(e.CompletedDate)
+}
+
+// FirstAccessAt returns when the user first accessed the content, or the zero
+// time if unknown.
+func (e *ReportEntry) FirstAccessAt() (time.Time, error) {
+	return ParseDate(e.FirstAccess)
+}
+
+// LastAccessAt returns when the user last accessed the content, or the zero
+// time if unknown.
+func (e *ReportEntry) LastAccessAt() (time.Time, error) {
+	return ParseDate(e.LastAccess)
+}
+
+// activityDates returns the entry's dates that parse.
+func (e *ReportEntry) activityDates() []time.Time {
+	dates := make([]time.Time, 0, 3)
+	for _, parse := range []func() (time.Time, error){e.CompletedAt, e.LastAccessAt, e.FirstAccessAt} {
+		if date, err := parse(); err == nil && !date.IsZero() {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+// LatestActivity returns the most recent date on the entry, or the zero time
+// if none parse.
+func (e *ReportEntry) LatestActivity() time.Time {
+	var latest time.Time
+	for _, date := range e.activityDates() {
+		if date.After(latest) {
+			latest = date
+		}
+	}
+	return latest
+}
+
+// EarliestActivity returns the earliest date on the entry, or the zero time
+// if none parse.
+func (e *ReportEntry) EarliestActivity() time.Time {
+	var earliest time.Time
+	for _, date := range e.activityDates() {
+		if earliest.IsZero() || date.Before(earliest) {
+			earliest = date
+		}
+	}
+	return earliest
+}
+
+// logUnparsableDates warns about report dates in none of the known layouts,
+// which are treated as missing.
+func logUnparsableDates(ctx context.Context, report *Report) {
+	if report == nil {
+		return
+	}
+
+	counts := make(map[string]int)
+	var samples []string
+	for i := range *report {
+		entry := &(*report)[i]
+		for _, date := range [][2]string{
+			{"completedDate", entry.CompletedDate},
+			{"firstAccess", entry.FirstAccess},
+			{"lastAccess", entry.LastAccess},
+		} {
+			column, value := date[0], date[1]
+			if _, err := ParseDate(value); err != nil {
+				counts[column]++
+				if len(samples) < maxUnparsableDateSamples {
+					samples = append(samples, value)
+				}
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	logging.Extract(ctx).Warn("Report has unparsable dates, they are treated as missing",
+		zap.Any("unparsable_dates", counts),
+		zap.Strings("samples", samples))
+}
+
+// DueAt returns when the assignment is due, or the zero time when it has no
+// due date or the date can't be parsed.
+func (a *Assignment) DueAt() time.Time {
+	due, _ := ParseDate(a.DueDate)
+	return due
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDate(t *testing.T) {
+	expected := time.Date(2025, 6, 20, 16, 0, 43, 775000000, time.UTC)
+
+	testCases := []struct {
+		value    string
+		expected time.Time
+		message  string
+	}{
+		{"2025-06-20T16:00:43.775Z", expected, "RFC 3339 with milliseconds"},
+		{"2025-06-20T18:00:43.775+02:00", expected, "RFC 3339 with an offset"},
+		{"2025-06-20T11:00:43.775-0500", expected, "offset without a colon"},
+		{"2025-06-20T16:00:43.775", expected, "no offset is UTC"},
+		{"2025-06-20 16:00:43.775", expected, "space separated"},
+		{"2025-06-20 16:00:43.775+00:00", expected, "space separated with an offset"},
+		{"2025-06-20", time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC), "date only"},
+		{"06/20/2025", time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC), "US date"},
+		{" 2025-06-20 ", time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC), "surrounding whitespace"},
+		{"", time.Time{}, "empty is the zero time"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.message, func(t *testing.T) {
+			parsed, err := ParseDate(testCase.value)
+			require.NoError(t, err)
+			assert.True(t, testCase.expected.Equal(parsed), "got %s", parsed)
+			assert.Equal(t, time.UTC, parsed.Location())
+		})
+	}
+
+	t.Run("should report unparsable dates", func(t *testing.T) {
+		_, err := ParseDate("last Tuesday")
+		require.ErrorIs(t, err, ErrUnparsableDate)
+		assert.Contains(t, err.Error(), `"last Tuesday"`)
+	})
+}
+
+func TestFormatDate(t *testing.T) {
+	assert.Equal(t, "2025-01-31T00:00:00Z", FormatDate("2025-01-31"))
+	assert.Equal(t, "2025-06-20T16:00:43Z", FormatDate("2025-06-20T18:00:43+02:00"))
+	assert.Equal(t, "soon", FormatDate("soon"))
+	assert.Equal(t, "", FormatDate(""))
+}
+
+func TestReportEntryActivity(t *testing.T) {
+	t.Run("should compare dates across formats and offsets", func(t *testing.T) {
+		entry := ReportEntry{
+			FirstAccess:   "2025-06-20T08:00:00-05:00",
+			LastAccess:    "2025-06-20 12:00:00",
+			CompletedDate: "2025-06-20T13:30:00.000Z",
+		}
+		// Lexically the first access would be the earliest and the
+		// completion the latest; in time the last access is earliest.
+		assert.Equal(t, time.Date(2025, 6, 20, 12, 0, 0, 0, time.UTC), entry.EarliestActivity())
+		assert.Equal(t, time.Date(2025, 6, 20, 13, 30, 0, 0, time.UTC), entry.LatestActivity())
+	})
+
+	t.Run("should ignore missing and unparsable dates", func(t *testing.T) {
+		entry := ReportEntry{FirstAccess: "2025-06-20", LastAccess: "not a date"}
+		assert.Equal(t, time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC), entry.LatestActivity())
+
+		_, err := entry.LastAccessAt()
+		assert.ErrorIs(t, err, ErrUnparsableDate)
+		assert.True(t, (&ReportEntry{}).LatestActivity().IsZero())
+	})
+}
@@ -0,0 +1,313 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	// Registers the pure Go "sqlite" database/sql driver.
+	_ "github.com/glebarez/go-sqlite"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	diskStoreDirPattern = "baton-percipio-statuses-*"
+	diskStoreFile       = "statuses.db"
+	// diskStoreCacheKiB bounds the page cache SQLite keeps in memory.
+	diskStoreCacheKiB = 16 * 1024
+	// diskStoreChunkRows is how many statuses Statuses reads per query.
+	diskStoreChunkRows = 1000
+)
+
+var diskStoreSchema = []string{
+	// Pages are never synced or journaled: the database only lives for one
+	// sync and is rebuilt from the report if anything goes wrong.
+	"PRAGMA journal_mode = OFF",
+	"PRAGMA synchronous = OFF",
+	"PRAGMA temp_store = MEMORY",
+	fmt.Sprintf("PRAGMA cache_size = -%d", diskStoreCacheKiB),
+	`CREATE TABLE statuses (
+		course_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		PRIMARY KEY (course_id, user_id)
+	) WITHOUT ROWID`,
+	"CREATE INDEX statuses_user_id ON statuses (user_id)",
+}
+
+// DiskStatusesStore is a StatusesStore kept in an embedded SQLite database in
+// a temporary directory, for reports whose statuses don't fit in memory. Rows
+// are keyed by course, so a course's statuses are read together.
+//
+// The directory is removed as soon as the database is open where the OS
+// allows it, so the space is reclaimed when the process exits however it
+// exits; otherwise it is removed by Close.
+type DiskStatusesStore struct {
+	logger *zap.Logger
+	db     *sql.DB
+	// conn is the only connection: the database file may already be
+	// unlinked, so another connection couldn't reopen it.
+	conn *sql.Conn
+	dir  string
+}
+
+// NewDiskStatusesStore creates an empty store in a new temporary directory
+// under dir, or under the OS temporary directory if dir is empty.
+func NewDiskStatusesStore(ctx context.Context, dir string) (*DiskStatusesStore, error) {
+	tempDir, err := os.MkdirTemp(dir, diskStoreDirPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create status store directory: %w", err)
+	}
+
+	store := &DiskStatusesStore{logger: logging.Extract(ctx), dir: tempDir}
+	if err := store.open(ctx); err != nil {
+		return nil, errors.Join(err, store.Close())
+	}
+	if err := os.RemoveAll(tempDir); err == nil {
+		store.dir = ""
+	}
+
+	store.logger.Debug("Created disk status store", zap.String("dir", tempDir))
+	return store, nil
+}
+
+func (s *DiskStatusesStore) open(ctx context.Context) error {
+	db, err := sql.Open("sqlite", filepath.Join(s.dir, diskStoreFile))
+	if err != nil {
+		return fmt.Errorf("failed to open status store: %w", err)
+	}
+	s.db = db
+
+	s.conn, err = db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open status store: %w", err)
+	}
+	for _, statement := range diskStoreSchema {
+		if _, err := s.conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to create status store: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database and removes its directory.
+func (s *DiskStatusesStore) Close() error {
+	var err error
+	if s.conn != nil {
+		err = errors.Join(err, s.conn.Close())
+		s.conn = nil
+	}
+	if s.db != nil {
+		err = errors.Join(err, s.db.Close())
+		s.db = nil
+	}
+	if s.dir != "" {
+		err = errors.Join(err, os.RemoveAll(s.dir))
+		s.dir = ""
+	}
+	return err
+}
+
+// Load adds the statuses in report in a single transaction, the last row for
+// a user and course winning.
+func (s *DiskStatusesStore) Load(ctx context.Context, report *Report) error {
+	startTime := time.Now()
+	s.logger.Debug("Starting to load disk status store from report",
+		zap.Int("report_entries", len(*report)))
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to load status store: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO statuses (course_id, user_id, status) VALUES (?, ?, ?)
+		ON CONFLICT (course_id, user_id) DO UPDATE SET status = excluded.status`)
+	if err != nil {
+		return fmt.Errorf("failed to load status store: %w", err)
+	}
+	defer insert.Close()
+
+	statusCounts := make(map[string]int)
+	for i := range *report {
+		row := &(*report)[i]
+		status := reportStatus(row.Status)
+		if _, err := insert.ExecContext(ctx, row.ContentId, row.UserId, status); err != nil {
+			return fmt.Errorf("failed to load status store: %w", err)
+		}
+		statusCounts[status.String()]++
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to load status store: %w", err)
+	}
+	courses, err := s.Len()
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Status store loaded successfully",
+		zap.Int("total_entries", len(*report)),
+		zap.Int("unique_courses", courses),
+		zap.Any("status_distribution", statusCounts),
+		zap.Duration("duration", time.Since(startTime)))
+
+	return nil
+}
+
+// Get returns a mapping of user IDs to statuses for a course, read from disk
+// on each call.
+func (s *DiskStatusesStore) Get(courseId string) (map[string]string, error) {
+	return collectStatuses(s, courseId)
+}
+
+// Statuses calls yield with the statuses of a course in user ID order,
+// starting after the user ID after. They are read diskStoreChunkRows at a
+// time, so yield can use the store between chunks' queries and a course is
+// never held in memory whole.
+func (s *DiskStatusesStore) Statuses(courseId string, after string, yield func(userId string, status string) bool) error {
+	type row struct {
+		userId string
+		status Status
+	}
+	chunk := make([]row, 0, diskStoreChunkRows)
+	for {
+		chunk = chunk[:0]
+		rows, err := s.conn.QueryContext(context.Background(),
+			"SELECT user_id, status FROM statuses WHERE course_id = ? AND user_id > ? ORDER BY user_id LIMIT ?",
+			courseId, after, diskStoreChunkRows)
+		if err != nil {
+			return fmt.Errorf("failed to read statuses of course %s from status store: %w", courseId, err)
+		}
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.userId, &r.status); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read statuses of course %s from status store: %w", courseId, err)
+			}
+			chunk = append(chunk, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read statuses of course %s from status store: %w", courseId, err)
+		}
+
+		for _, r := range chunk {
+			if !yield(r.userId, r.status.String()) {
+				return nil
+			}
+		}
+		if len(chunk) < diskStoreChunkRows {
+			return nil
+		}
+		after = chunk[len(chunk)-1].userId
+	}
+}
+
+// Courses returns an iterator over the IDs of the courses with statuses,
+// ordered by ID. The IDs are read up front so Statuses can be called while
+// iterating.
+func (s *DiskStatusesStore) Courses() (iter.Seq[string], error) {
+	courseIds, err := s.queryStrings(context.Background(), "SELECT DISTINCT course_id FROM statuses ORDER BY course_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read courses from status store: %w", err)
+	}
+	return slices.Values(courseIds), nil
+}
+
+// Len returns the number of courses with statuses.
+func (s *DiskStatusesStore) Len() (int, error) {
+	var count int
+	err := s.conn.QueryRowContext(context.Background(), "SELECT COUNT(DISTINCT course_id) FROM statuses").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count courses in status store: %w", err)
+	}
+	return count, nil
+}
+
+// Merge moves the statuses of users to the users they were merged into,
+// keeping the more advanced status when both have one. It returns how many
+// statuses were moved; on error nothing is moved.
+func (s *DiskStatusesStore) Merge(survivors map[string]string) (int, error) {
+	moved, err := s.merge(context.Background(), survivors)
+	if err != nil {
+		return 0, fmt.Errorf("failed to merge users in status store: %w", err)
+	}
+	return moved, nil
+}
+
+func (s *DiskStatusesStore) merge(ctx context.Context, survivors map[string]string) (int, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	moved := 0
+	for userId, survivor := range survivors {
+		rows, err := tx.QueryContext(ctx, `SELECT merged.course_id, merged.status, survivor.status
+			FROM statuses merged
+			LEFT JOIN statuses survivor ON survivor.course_id = merged.course_id AND survivor.user_id = ?
+			WHERE merged.user_id = ?`, survivor, userId)
+		if err != nil {
+			return 0, err
+		}
+		type move struct {
+			courseId string
+			status   Status
+			existing sql.NullInt16
+		}
+		var moves []move
+		for rows.Next() {
+			var m move
+			if err := rows.Scan(&m.courseId, &m.status, &m.existing); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			moves = append(moves, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for _, m := range moves {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM statuses WHERE course_id = ? AND user_id = ?", m.courseId, userId); err != nil {
+				return 0, err
+			}
+			if !m.existing.Valid || statusRank(m.status.String()) > statusRank(Status(m.existing.Int16).String()) {
+				_, err := tx.ExecContext(ctx, `INSERT INTO statuses (course_id, user_id, status) VALUES (?, ?, ?)
+					ON CONFLICT (course_id, user_id) DO UPDATE SET status = excluded.status`, m.courseId, survivor, m.status)
+				if err != nil {
+					return 0, err
+				}
+			}
+			moved++
+		}
+	}
+	return moved, tx.Commit()
+}
+
+func (s *DiskStatusesStore) queryStrings(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStatusesStore(t *testing.T) {
+	ctx := context.Background()
+	report := &Report{
+		{UserId: "michael.bolton", ContentId: "course-b", Status: "Completed"},
+		{UserId: "milton.waddams", ContentId: "course-b", Status: "Started"},
+		{UserId: "michael.bolton", ContentId: "course-a", Status: "Active"},
+		{UserId: "peter.gibbons", ContentId: "course-b", Status: ""},
+		{UserId: "bill.lumbergh", ContentId: "course-b", Status: "UnknownStatus"},
+		{UserId: "milton.waddams", ContentId: "course-b", Status: "Watched"},
+	}
+
+	newStore := func(t *testing.T) *DiskStatusesStore {
+		store, err := NewDiskStatusesStore(ctx, t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		require.NoError(t, store.Load(ctx, report))
+		return store
+	}
+
+	t.Run("should match the map store", func(t *testing.T) {
+		store := newStore(t)
+		mapped := make(MapStatusesStore)
+		require.NoError(t, mapped.Load(ctx, report))
+
+		assert.Equal(t, courseCount(t, mapped), courseCount(t, store))
+		for _, courseId := range courseIds(t, mapped) {
+			assert.Equal(t, getStatuses(t, mapped, courseId), getStatuses(t, store, courseId), courseId)
+		}
+		assert.Nil(t, getStatuses(t, store, "missing"))
+	})
+
+	t.Run("should iterate courses by ID while reading them", func(t *testing.T) {
+		store := newStore(t)
+
+		courses, err := store.Courses()
+		require.NoError(t, err)
+		var read []string
+		for courseId := range courses {
+			assert.NotEmpty(t, getStatuses(t, store, courseId))
+			read = append(read, courseId)
+		}
+		assert.Equal(t, []string{"course-a", "course-b"}, read)
+	})
+
+	t.Run("should return read errors", func(t *testing.T) {
+		store := newStore(t)
+		require.NoError(t, store.conn.Close())
+
+		_, err := store.Get("course-a")
+		assert.Error(t, err)
+		err = store.Statuses("course-a", "", func(string, string) bool { return true })
+		assert.Error(t, err)
+		_, err = store.Courses()
+		assert.Error(t, err)
+		_, err = store.Len()
+		assert.Error(t, err)
+		_, err = store.Merge(map[string]string{"peter.gibbons": "michael.bolton"})
+		assert.Error(t, err)
+	})
+
+	t.Run("should merge users keeping the more advanced status", func(t *testing.T) {
+		store := newStore(t)
+		mapped := make(MapStatusesStore)
+		require.NoError(t, mapped.Load(ctx, report))
+		survivors := map[string]string{"peter.gibbons": "michael.bolton", "bill.lumbergh": "samir"}
+
+		assert.Equal(t, mergeStatuses(t, mapped, survivors), mergeStatuses(t, store, survivors))
+		for _, courseId := range courseIds(t, mapped) {
+			assert.Equal(t, getStatuses(t, mapped, courseId), getStatuses(t, store, courseId), courseId)
+		}
+	})
+
+	t.Run("should leave nothing on disk", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewDiskStatusesStore(ctx, dir)
+		require.NoError(t, err)
+		require.NoError(t, store.Load(ctx, report))
+		require.NoError(t, store.Close())
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestStatusStoreOptions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should keep large reports on disk automatically", func(t *testing.T) {
+		options := StatusStoreOptions{DiskRows: 2}
+		assert.False(t, options.onDisk(2))
+		assert.True(t, options.onDisk(3))
+		assert.False(t, StatusStoreOptions{}.onDisk(DefaultStatusStoreDiskRows))
+	})
+
+	t.Run("should follow an explicit kind", func(t *testing.T) {
+		assert.True(t, StatusStoreOptions{Kind: StatusStoreDisk}.onDisk(0))
+		assert.False(t, StatusStoreOptions{Kind: StatusStoreMemory, DiskRows: 1}.onDisk(100))
+	})
+
+	t.Run("should reject invalid options", func(t *testing.T) {
+		assert.NoError(t, StatusStoreOptions{}.Validate())
+		assert.Error(t, StatusStoreOptions{Kind: "tape"}.Validate())
+		assert.Error(t, StatusStoreOptions{DiskRows: -1}.Validate())
+	})
+
+	t.Run("should replace and release disk stores", func(t *testing.T) {
+		dir := t.TempDir()
+		c := &Client{StatusStore: StatusStoreOptions{Kind: StatusStoreDisk, Dir: dir}}
+		report := &Report{{UserId: "michael.bolton", ContentId: "course-a", Status: "Completed"}}
+
+		require.NoError(t, c.LoadReport(ctx, report))
+		first, ok := c.StatusesStore.(*DiskStatusesStore)
+		require.True(t, ok)
+		assert.Equal(t, map[string]string{"michael.bolton": "completed"}, getStatuses(t, c.StatusesStore, "course-a"))
+
+		require.NoError(t, c.LoadReport(ctx, report))
+		assert.Nil(t, first.conn, "the previous store is closed")
+		assert.Equal(t, []string{"course-a"}, courseIds(t, c.StatusesStore))
+
+		require.NoError(t, c.Close())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
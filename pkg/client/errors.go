@@ -0,0 +1,107 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Kinds of failure the connector needs to tell apart. They are wrapped in an
+// *Error, so callers can match them with errors.Is.
+var (
+	ErrUnauthenticated      = errors.New("percipio rejected the API token")
+	ErrForbidden            = errors.New("percipio API token lacks permission")
+	ErrOrganizationNotFound = errors.New("percipio organization not found")
+	ErrRateLimited          = errors.New("percipio rate limit exceeded")
+	ErrReportFailed         = errors.New("percipio report generation failed")
+	ErrReportTimedOut       = errors.New("percipio report generation timed out")
+	ErrUpstreamUnavailable  = errors.New("percipio is unavailable")
+)
+
+// ErrUnexpectedResponse is returned when Percipio answers with a body whose
+// shape we don't recognize. Polling fails fast on it instead of retrying
+// until timeout.
+var ErrUnexpectedResponse = errors.New("unexpected response from Percipio")
+
+// APIError is an error payload returned by Percipio, usually alongside a
+// non-2xx status code. Percipio is not consistent about field names, so both
+// `error` and `errorCode` are accepted.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"errorCode,omitempty"`
+	ErrorText  string `json:"error,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	parts := make([]string, 0, 3)
+	if e.Code != "" {
+		parts = append(parts, e.Code)
+	}
+	if e.ErrorText != "" && e.ErrorText != e.Code {
+		parts = append(parts, e.ErrorText)
+	}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("percipio error (status %d)", e.StatusCode)
+	}
+	return fmt.Sprintf("percipio error (status %d): %s", e.StatusCode, strings.Join(parts, ": "))
+}
+
+// Error is a classified failure talking to Percipio. Kind is one of the
+// sentinel errors above and Err is the underlying cause. RateLimit is set
+// when the response carried rate limit information.
+type Error struct {
+	Kind      error
+	RateLimit *v2.RateLimitDescription
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// classifyStatus maps an HTTP status code to an error kind, or nil for codes
+// that don't say anything useful on their own (e.g. 400, 404).
+func classifyStatus(statusCode int) error {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return ErrUnauthenticated
+	case statusCode == http.StatusForbidden:
+		return ErrForbidden
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode == http.StatusRequestTimeout,
+		statusCode >= http.StatusInternalServerError && statusCode != http.StatusNotImplemented:
+		return ErrUpstreamUnavailable
+	default:
+		return nil
+	}
+}
+
+// classifyError wraps err in an *Error when the response status code or the
+// error itself identifies a known kind of failure. Otherwise err is returned
+// unchanged.
+func classifyError(response *http.Response, ratelimitData *v2.RateLimitDescription, err error) error {
+	var kind error
+	if response != nil {
+		kind = classifyStatus(response.StatusCode)
+	} else if code := status.Code(err); code == codes.Unavailable || code == codes.DeadlineExceeded || isTransientError(err) {
+		kind = ErrUpstreamUnavailable
+	}
+	if kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, RateLimit: ratelimitData, Err: err}
+}
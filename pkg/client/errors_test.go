@@ -0,0 +1,93 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIErrorMessage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      APIError
+		expected string
+	}{
+		{
+			name:     "code and message",
+			err:      APIError{StatusCode: http.StatusNotFound, Code: "NOT_FOUND", Message: "Organization not found"},
+			expected: "percipio error (status 404): NOT_FOUND: Organization not found",
+		},
+		{
+			name:     "error text only",
+			err:      APIError{StatusCode: http.StatusUnauthorized, ErrorText: "unauthorized"},
+			expected: "percipio error (status 401): unauthorized",
+		},
+		{
+			name:     "empty payload",
+			err:      APIError{StatusCode: http.StatusBadGateway},
+			expected: "percipio error (status 502)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.err.Error())
+		})
+	}
+}
+
+func TestDecodeAPIError(t *testing.T) {
+	t.Run("should decode JSON error payload", func(t *testing.T) {
+		apiErr := decodeAPIError(http.StatusForbidden, "application/json", []byte(`{"errorCode": "FORBIDDEN", "message": "nope"}`))
+		assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+		assert.Equal(t, "FORBIDDEN", apiErr.Code)
+		assert.Equal(t, "nope", apiErr.Message)
+	})
+
+	t.Run("should keep an excerpt of non-JSON bodies", func(t *testing.T) {
+		apiErr := decodeAPIError(http.StatusBadGateway, "text/html", []byte("  <html>bad gateway</html>  "))
+		assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+		assert.Equal(t, "<html>bad gateway</html>", apiErr.Message)
+	})
+}
+
+func TestClassifyStatus(t *testing.T) {
+	testCases := []struct {
+		statusCode int
+		expected   error
+	}{
+		{http.StatusUnauthorized, ErrUnauthenticated},
+		{http.StatusForbidden, ErrForbidden},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusRequestTimeout, ErrUpstreamUnavailable},
+		{http.StatusInternalServerError, ErrUpstreamUnavailable},
+		{http.StatusServiceUnavailable, ErrUpstreamUnavailable},
+		{http.StatusNotImplemented, nil},
+		{http.StatusNotFound, nil},
+		{http.StatusBadRequest, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(http.StatusText(tc.statusCode), func(t *testing.T) {
+			assert.Equal(t, tc.expected, classifyStatus(tc.statusCode))
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	cause := errors.New("boom")
+
+	t.Run("should wrap classified responses", func(t *testing.T) {
+		err := classifyError(&http.Response{StatusCode: http.StatusUnauthorized}, nil, cause)
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+		assert.ErrorIs(t, err, cause)
+		assert.Equal(t, "percipio rejected the API token: boom", err.Error())
+	})
+
+	t.Run("should leave unclassified errors alone", func(t *testing.T) {
+		err := classifyError(&http.Response{StatusCode: http.StatusBadRequest}, nil, cause)
+		assert.Equal(t, cause, err)
+	})
+}
@@ -1,11 +1,98 @@
 package client
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CatalogContent is a single item from the Content Discovery catalog. Only
+// the fields the connector uses are mapped.
+type CatalogContent struct {
+	Id                string                     `json:"id"`
+	Code              string                     `json:"code,omitempty"`
+	ContentType       CatalogContentType         `json:"contentType"`
+	LocalizedMetadata []CatalogLocalizedMetadata `json:"localizedMetadata,omitempty"`
+	Duration          string                     `json:"duration,omitempty"`
+	Publication       CatalogPublication         `json:"publication"`
+	Lifecycle         CatalogLifecycle           `json:"lifecycle"`
+}
+
+// Catalog lifecycle states.
+const (
+	CatalogStatusActive  = "ACTIVE"
+	CatalogStatusRetired = "RETIRED"
+)
+
+type CatalogLifecycle struct {
+	Status                string `json:"status,omitempty"`
+	PublishDate           string `json:"publishDate,omitempty"`
+	LastUpdatedDate       string `json:"lastUpdatedDate,omitempty"`
+	PlannedRetirementDate string `json:"plannedRetirementDate,omitempty"`
+}
+
+type CatalogPublication struct {
+	Publisher     string `json:"publisher,omitempty"`
+	CopyrightYear int    `json:"copyrightYear,omitempty"`
+}
+
+type CatalogContentType struct {
+	PercipioType string `json:"percipioType,omitempty"`
+	Category     string `json:"category,omitempty"`
+	DisplayLabel string `json:"displayLabel,omitempty"`
+}
+
+type CatalogLocalizedMetadata struct {
+	LocaleCode  string `json:"localeCode,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
 
 type Course struct {
 	Id          string `json:"contentId"`
 	CourseTitle string `json:"contentTitle"`
 	ContentType string `json:"contentType"`
+
+	// Catalog metadata, only known when the course was looked up in the
+	// Content Discovery catalog.
+	Locale      string `json:"locale,omitempty"`
+	Duration    string `json:"duration,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Status is the catalog lifecycle status, e.g. ACTIVE or RETIRED.
+	Status                string            `json:"status,omitempty"`
+	PlannedRetirementDate string            `json:"plannedRetirementDate,omitempty"`
+	LocalizedTitles       map[string]string `json:"localizedTitles,omitempty"`
+}
+
+// ToCourse converts a catalog item to a course with the given ID. The first
+// localized metadata entry provides the title, description and locale.
+func (content CatalogContent) ToCourse(id string) Course {
+	course := Course{
+		Id:                    id,
+		ContentType:           content.ContentType.DisplayLabel,
+		Duration:              content.Duration,
+		Provider:              content.Publication.Publisher,
+		Status:                content.Lifecycle.Status,
+		PlannedRetirementDate: content.Lifecycle.PlannedRetirementDate,
+	}
+	if len(content.LocalizedMetadata) > 0 {
+		course.CourseTitle = content.LocalizedMetadata[0].Title
+		course.Description = content.LocalizedMetadata[0].Description
+		course.Locale = content.LocalizedMetadata[0].LocaleCode
+	}
+	if len(content.LocalizedMetadata) > 1 {
+		course.LocalizedTitles = make(map[string]string, len(content.LocalizedMetadata))
+		for _, metadata := range content.LocalizedMetadata {
+			if metadata.LocaleCode != "" && metadata.Title != "" {
+				course.LocalizedTitles[metadata.LocaleCode] = metadata.Title
+			}
+		}
+	}
+	return course
 }
 
 type Report []ReportEntry
@@ -29,6 +116,210 @@ type ReportEntry struct {
 	CompletedDate string `json:"completedDate,omitempty"`
 	FirstAccess   string `json:"firstAccess,omitempty"`
 	LastAccess    string `json:"lastAccess,omitempty"`
+
+	// Assessment results, where the report provides them. Percipio may send
+	// them as numbers; they are kept as text like the other columns.
+	HighScore    string `json:"highScore,omitempty"`
+	LastScore    string `json:"lastScore,omitempty"`
+	Attempts     string `json:"attempts,omitempty"`
+	PassingScore string `json:"passingScore,omitempty"`
+
+	// Attributes holds the report columns not mapped above, such as custom
+	// user attributes, keyed by column name. Non-string values keep their
+	// JSON text.
+	Attributes map[string]string `json:"-"`
+}
+
+// mappedColumns are the report columns with a field in ReportEntry.
+var mappedColumns = map[string]bool{
+	"userId":        true,
+	"firstName":     true,
+	"lastName":      true,
+	"emailAddress":  true,
+	"contentId":     true,
+	"contentTitle":  true,
+	"contentType":   true,
+	"status":        true,
+	"completedDate": true,
+	"firstAccess":   true,
+	"lastAccess":    true,
+	"highScore":     true,
+	"lastScore":     true,
+	"attempts":      true,
+	"passingScore":  true,
+}
+
+// Column returns the value of a report column, mapped or not.
+func (e *ReportEntry) Column(name string) string {
+	switch name {
+	case "userId":
+		return e.UserId
+	case "firstName":
+		return e.FirstName
+	case "lastName":
+		return e.LastName
+	case "emailAddress":
+		return e.EmailAddress
+	case "contentId":
+		return e.ContentId
+	case "contentTitle":
+		return e.ContentTitle
+	case "contentType":
+		return e.ContentType
+	case "status":
+		return e.Status
+	case "completedDate":
+		return e.CompletedDate
+	case "firstAccess":
+		return e.FirstAccess
+	case "lastAccess":
+		return e.LastAccess
+	case "highScore":
+		return e.HighScore
+	case "lastScore":
+		return e.LastScore
+	case "attempts":
+		return e.Attempts
+	case "passingScore":
+		return e.PassingScore
+	default:
+		return e.Attributes[name]
+	}
+}
+
+// reportEntryFields is ReportEntry without its JSON methods.
+type reportEntryFields ReportEntry
+
+// UnmarshalJSON decodes the mapped columns of a report row. Unmapped columns
+// are only kept when the report is read with DecodeReport.
+func (e *ReportEntry) UnmarshalJSON(data []byte) error {
+	*e = ReportEntry{}
+	// The optional columns may hold JSON numbers.
+	row := struct {
+		*reportEntryFields
+		CompletedDate reportText `json:"completedDate"`
+		FirstAccess   reportText `json:"firstAccess"`
+		LastAccess    reportText `json:"lastAccess"`
+		HighScore     reportText `json:"highScore"`
+		LastScore     reportText `json:"lastScore"`
+		Attempts      reportText `json:"attempts"`
+		PassingScore  reportText `json:"passingScore"`
+	}{reportEntryFields: (*reportEntryFields)(e)}
+	if err := json.Unmarshal(data, &row); err != nil {
+		return err
+	}
+
+	e.CompletedDate = string(row.CompletedDate)
+	e.FirstAccess = string(row.FirstAccess)
+	e.LastAccess = string(row.LastAccess)
+	e.HighScore = string(row.HighScore)
+	e.LastScore = string(row.LastScore)
+	e.Attempts = string(row.Attempts)
+	e.PassingScore = string(row.PassingScore)
+	return nil
+}
+
+// MarshalJSON encodes a report row in the shape it was read, so cached
+// reports keep their unmapped columns.
+func (e ReportEntry) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal((*reportEntryFields)(&e))
+	if err != nil || len(e.Attributes) == 0 {
+		return data, err
+	}
+
+	attributes, err := json.Marshal(e.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	// Splice the attributes into the object: {...mapped,...attributes}.
+	data[len(data)-1] = ','
+	return append(data, attributes[1:]...), nil
+}
+
+// reportText is a report column kept as text, which Percipio may send as a
+// JSON number.
+type reportText string
+
+func (t *reportText) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*t = reportText(text)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("expected a string or a number, got %s", data)
+	}
+	*t = reportText(number)
+	return nil
+}
+
+// DecodeReport decodes a report, keeping the given unmapped columns of each
+// row in its Attributes. Other unmapped columns are dropped.
+func DecodeReport(data []byte, columns []string) (Report, error) {
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	kept := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		if !mappedColumns[column] {
+			kept[column] = true
+		}
+	}
+	if len(kept) == 0 {
+		return report, nil
+	}
+	if err := decodeAttributes(data, report, kept); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// decodeAttributes reads the kept columns of each row of data into the
+// Attributes of the matching entry of report. Non-string values keep their
+// JSON text.
+func decodeAttributes(data []byte, report Report, kept map[string]bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	// value is reused: decoding into a RawMessage overwrites it in place.
+	var value json.RawMessage
+	for i := 0; decoder.More(); i++ {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			if err := decoder.Decode(&value); err != nil {
+				return err
+			}
+			column, _ := key.(string)
+			if !kept[column] || bytes.Equal(value, []byte("null")) {
+				continue
+			}
+
+			entry := &report[i]
+			if entry.Attributes == nil {
+				entry.Attributes = make(map[string]string, len(kept))
+			}
+			var text string
+			if json.Unmarshal(value, &text) == nil {
+				entry.Attributes[column] = text
+			} else {
+				entry.Attributes[column] = string(value)
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type ReportSort struct {
@@ -36,15 +327,100 @@ type ReportSort struct {
 	Order string `json:"order,omitempty"`
 }
 
+// Report generation states returned by the report status endpoint.
+const (
+	ReportStatusPending    = "PENDING"
+	ReportStatusInProgress = "IN_PROGRESS"
+	ReportStatusCompleted  = "COMPLETED"
+	ReportStatusFailed     = "FAILED"
+)
+
 type ReportStatus struct {
 	Id     string `json:"id"`
 	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
 }
 
+// ManagedUser is a user as returned by the User Management service. Only the
+// fields the connector uses are mapped.
+type ManagedUser struct {
+	Id        string `json:"id"`
+	LoginName string `json:"loginName,omitempty"`
+	Email     string `json:"email,omitempty"`
+	FirstName string `json:"firstName,omitempty"`
+	LastName  string `json:"lastName,omitempty"`
+	Role      string `json:"role,omitempty"`
+	IsActive  bool   `json:"isActive"`
+}
+
+// Assignment is a piece of content assigned to a learner, as returned by the
+// Content Assignment service. Only the fields the connector uses are mapped.
+type Assignment struct {
+	Id           string `json:"id"`
+	Name         string `json:"name,omitempty"`
+	UserId       string `json:"userId"`
+	ContentId    string `json:"contentId"`
+	AssignedDate string `json:"assignedDate,omitempty"`
+	DueDate      string `json:"dueDate,omitempty"`
+}
+
+// ToUser converts a managed user to a user, using their login name as their
+// email when it looks like one and no email is set.
+func (u ManagedUser) ToUser() User {
+	email := u.Email
+	if email == "" && strings.Contains(u.LoginName, "@") {
+		email = u.LoginName
+	}
+	return User{
+		Id:             u.Id,
+		PercipioUserId: u.Id,
+		Email:          email,
+		FirstName:      u.FirstName,
+		LastName:       u.LastName,
+	}
+}
+
 type User struct {
 	Id        string `json:"userId"`
 	Email     string `json:"emailAddress"`
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
+
+	// PercipioUserId is the user's ID in the report, which differs from Id
+	// when users are identified by another column.
+	PercipioUserId   string   `json:"percipioUserId,omitempty"`
+	Login            string   `json:"login,omitempty"`
+	AdditionalEmails []string `json:"additionalEmails,omitempty"`
+	EmployeeIds      []string `json:"employeeIds,omitempty"`
+
+	// Attributes are extra profile values taken from report columns, keyed
+	// by profile key.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// LastActivity is the most recent date on any of the user's report rows,
+	// zero if none. Dormant is set when it falls outside the dormancy window.
+	LastActivity time.Time `json:"lastActivity,omitempty"`
+	Dormant      bool      `json:"dormant,omitempty"`
+}
+
+// Group is a set of users sharing a value of a report column, such as their
+// department or audience, with completion counts across its members.
+type Group struct {
+	Id      string   `json:"id"`
+	Members []string `json:"members"`
+
+	// Enrollments counts the members' course statuses; Completed and
+	// InProgress count those that are completed or in progress.
+	Enrollments int `json:"enrollments"`
+	Completed   int `json:"completed"`
+	InProgress  int `json:"inProgress"`
+}
+
+// CompletionRate returns the percentage of the group's enrollments that are
+// completed, or 0 without enrollments.
+func (g Group) CompletionRate() float64 {
+	if g.Enrollments == 0 {
+		return 0
+	}
+	return float64(g.Completed) * 100 / float64(g.Enrollments)
 }
@@ -1,10 +1,12 @@
 package client
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUserModel(t *testing.T) {
@@ -161,3 +163,130 @@ func TestReportType(t *testing.T) {
 	assert.Equal(t, "bill.lumbergh@initech.com", report[3].UserId)
 	assert.Equal(t, "UnknownStatus", report[3].Status)
 }
+
+func TestCatalogContentToCourse(t *testing.T) {
+	content := CatalogContent{
+		Id:          "7f1c5a4e-6c1d-4b8e-9a43-2c0b3f6f9a10",
+		Code:        "bs_adg02_a23_enus",
+		ContentType: CatalogContentType{DisplayLabel: "Course"},
+		LocalizedMetadata: []CatalogLocalizedMetadata{
+			{LocaleCode: "en-US", Title: "Data Privacy", Description: "Explore data privacy."},
+			{LocaleCode: "fr-FR", Title: "Confidentialité des données"},
+		},
+		Duration:    "PT25M3S",
+		Publication: CatalogPublication{Publisher: "Skillsoft"},
+		Lifecycle:   CatalogLifecycle{Status: CatalogStatusRetired, PlannedRetirementDate: "2025-01-31"},
+	}
+
+	course := content.ToCourse("bs_adg02_a23_enus")
+
+	assert.Equal(t, "bs_adg02_a23_enus", course.Id)
+	assert.Equal(t, "Data Privacy", course.CourseTitle)
+	assert.Equal(t, "Course", course.ContentType)
+	assert.Equal(t, "en-US", course.Locale)
+	assert.Equal(t, "Explore data privacy.", course.Description)
+	assert.Equal(t, "PT25M3S", course.Duration)
+	assert.Equal(t, "Skillsoft", course.Provider)
+	assert.Equal(t, CatalogStatusRetired, course.Status)
+	assert.Equal(t, "2025-01-31", course.PlannedRetirementDate)
+	assert.Equal(t, map[string]string{
+		"en-US": "Data Privacy",
+		"fr-FR": "Confidentialité des données",
+	}, course.LocalizedTitles)
+}
+
+func TestReportEntryJSON(t *testing.T) {
+	t.Run("should decode mapped columns and drop the others", func(t *testing.T) {
+		var entry ReportEntry
+		err := json.Unmarshal([]byte(`{
+			"userId": "michael.bolton@initech.com",
+			"emailAddress": "michael.bolton@initech.com",
+			"contentId": "bs_adg02_a23_enus",
+			"status": "Completed",
+			"completedDate": "2025-06-20T00:00:00.000Z",
+			"highScore": 85,
+			"lastScore": null,
+			"department": "Engineering"
+		}`), &entry)
+		require.NoError(t, err)
+
+		assert.Equal(t, "michael.bolton@initech.com", entry.UserId)
+		assert.Equal(t, "Completed", entry.Status)
+		assert.Equal(t, "2025-06-20T00:00:00.000Z", entry.CompletedDate)
+		assert.Equal(t, "85", entry.HighScore)
+		assert.Empty(t, entry.LastScore)
+		assert.Nil(t, entry.Attributes)
+	})
+
+	t.Run("should round trip through JSON", func(t *testing.T) {
+		entry := ReportEntry{
+			UserId:     "michael.bolton@initech.com",
+			ContentId:  "bs_adg02_a23_enus",
+			Status:     "Started",
+			LastAccess: "2025-06-20T16:00:43.775Z",
+			Attributes: map[string]string{"department": "Engineering"},
+		}
+
+		data, err := json.Marshal(Report{entry})
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "completedDate")
+
+		decoded, err := DecodeReport(data, []string{"department"})
+		require.NoError(t, err)
+		assert.Equal(t, Report{entry}, decoded)
+	})
+
+	t.Run("should reject mistyped mapped columns", func(t *testing.T) {
+		var entry ReportEntry
+		err := json.Unmarshal([]byte(`{"userId": 42}`), &entry)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "userId")
+	})
+}
+
+func TestDecodeReport(t *testing.T) {
+	data := []byte(`[
+		{
+			"userId": "michael.bolton@initech.com",
+			"contentId": "bs_adg02_a23_enus",
+			"status": "Completed",
+			"department": "Engineering",
+			"employeeNumber": 4711,
+			"isManager": false,
+			"manager": null,
+			"favoriteColor": "red"
+		},
+		{
+			"userId": "peter.gibbons@initech.com",
+			"contentId": "bs_adg02_a23_enus",
+			"status": "Started"
+		}
+	]`)
+
+	t.Run("should keep only the requested unmapped columns", func(t *testing.T) {
+		report, err := DecodeReport(data, []string{"department", "employeeNumber", "isManager", "manager", "userId"})
+		require.NoError(t, err)
+		require.Len(t, report, 2)
+
+		assert.Equal(t, "michael.bolton@initech.com", report[0].UserId)
+		assert.Equal(t, map[string]string{
+			"department":     "Engineering",
+			"employeeNumber": "4711",
+			"isManager":      "false",
+		}, report[0].Attributes)
+		assert.Equal(t, "peter.gibbons@initech.com", report[1].UserId)
+		assert.Nil(t, report[1].Attributes)
+	})
+
+	t.Run("should drop unmapped columns when none are requested", func(t *testing.T) {
+		report, err := DecodeReport(data, nil)
+		require.NoError(t, err)
+		require.Len(t, report, 2)
+		assert.Nil(t, report[0].Attributes)
+	})
+
+	t.Run("should reject invalid JSON", func(t *testing.T) {
+		_, err := DecodeReport([]byte(`[{"userId": "a"`), []string{"department"})
+		require.Error(t, err)
+	})
+}
@@ -1,35 +1,58 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
-	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"github.com/iiiatthew/baton-percipio-report/pkg/config"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
 	"go.uber.org/zap"
 )
 
 const (
 	ApiPathLearningActivityReport = "/reporting/v1/organizations/%s/report-requests/learning-activity"
 	ApiPathReport                 = "/reporting/v1/organizations/%s/report-requests/%s"
+	ApiPathUsers                  = "/user-management/v1/organizations/%s/users"
+	ApiPathUser                   = "/user-management/v1/organizations/%s/users/%s"
+	ApiPathCatalogContent         = "/content-discovery/v1/organizations/%s/catalog-content/%s"
+	ApiPathCatalog                = "/content-discovery/v2/organizations/%s/catalog-content"
+	ApiPathAssignments            = "/content-assignment/v1/organizations/%s/assignments"
 	BaseApiUrl                    = "https://api.percipio.com"
+
+	HeaderNameTotalCount      = "x-total-count"
+	HeaderNamePagingRequestId = "x-paging-request-id"
 )
 
 type Client struct {
-	baseUrl        *url.URL
-	bearerToken    string
-	StatusesStore  StatusesStore
+	baseUrl       *url.URL
+	bearerToken   string
+	StatusesStore StatusesStore
+	// StatusStore chooses the kind of StatusesStore a loaded report's
+	// statuses are kept in.
+	StatusStore StatusStoreOptions
+	// StatusHistory holds every status observation of the reports loaded
+	// while KeepStatusHistory is set, and is nil otherwise.
+	StatusHistory     StatusHistory
+	KeepStatusHistory bool
+	// ReportColumns are the unmapped report columns kept in each entry's
+	// Attributes; the others are dropped when the report is decoded.
+	ReportColumns  []string
 	organizationId string
 	ReportStatus   ReportStatus
 	wrapper        *uhttp.BaseHttpClient
-	loadedReport   *Report // Store the loaded report data
+	httpClient     *http.Client  // The wrapper's http.Client, for requests that bypass its response cache
+	retryBaseDelay time.Duration // Initial backoff for transient request failures
+	loadedReport   *Report       // Store the loaded report data
 }
 
 func New(
@@ -38,11 +61,13 @@ func New(
 	organizationId string,
 	token string,
 ) (*Client, error) {
+	logging.AddSecret(token)
+	ctx = logging.ToContext(ctx)
 	httpClient, err := uhttp.NewClient(
 		ctx,
 		uhttp.WithLogger(
 			true,
-			ctxzap.Extract(ctx),
+			logging.Extract(ctx),
 		),
 	)
 	if err != nil {
@@ -60,11 +85,13 @@ func New(
 	}
 
 	return &Client{
-		StatusesStore:  make(map[string]map[string]string),
+		StatusesStore:  NewCompactStatusesStore(),
 		baseUrl:        parsedUrl,
 		bearerToken:    token,
 		organizationId: organizationId,
 		wrapper:        wrapper,
+		httpClient:     httpClient,
+		retryBaseDelay: config.RequestRetryBaseDelay,
 	}, nil
 }
 
@@ -78,7 +105,7 @@ func (c *Client) GenerateLearningActivityReport(
 	*v2.RateLimitDescription,
 	error,
 ) {
-	logger := ctxzap.Extract(ctx)
+	logger := logging.Extract(ctx)
 	now := time.Now()
 
 	reportStart := now.Add(-lookbackPeriod)
@@ -104,6 +131,11 @@ func (c *Client) GenerateLearningActivityReport(
 	)
 	if err != nil {
 		logger.Error("Failed to initiate report generation", zap.Error(err))
+		// The endpoint is scoped only by organization, so a 404 means the
+		// organization ID is wrong.
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			err = &Error{Kind: ErrOrganizationNotFound, RateLimit: ratelimitData, Err: err}
+		}
 		return ratelimitData, err
 	}
 	defer response.Body.Close()
@@ -118,108 +150,185 @@ func (c *Client) GenerateLearningActivityReport(
 	return ratelimitData, nil
 }
 
-// pollReportStatus uses standard net/http to poll report status without any caching
-// Returns the report data directly when ready, avoiding a second HTTP call
-func (c *Client) pollReportStatus(ctx context.Context) (*Report, error) {
-	logger := ctxzap.Extract(ctx)
+// pollReportStatus polls the report status endpoint through the shared uhttp
+// client with caching disabled, so every attempt sees the current status.
+// Returns the report data directly when ready, avoiding a second HTTP call.
+func (c *Client) pollReportStatus(ctx context.Context) (*Report, *v2.RateLimitDescription, error) {
+	logger := logging.Extract(ctx)
 
-	// Build the URL for status polling
-	statusURL := fmt.Sprintf("%s%s",
-		c.baseUrl.String(),
-		fmt.Sprintf(ApiPathReport, c.organizationId, c.ReportStatus.Id))
-
-	// Create a simple HTTP client with no caching
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
-	var attempts int
+	var (
+		attempts      int
+		ratelimitData *v2.RateLimitDescription
+	)
 	for i := range config.RetryAttemptsMaximum {
 		attempts = i + 1
 
-		req, err := http.NewRequestWithContext(ctx, "GET", statusURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create status request: %w", err)
-		}
-
-		// Add authorization header
-		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
-		req.Header.Set("Accept", "application/json")
-
 		logger.Debug("Polling report status (no cache)",
-			zap.String("url", statusURL),
 			zap.Int("attempt", attempts),
 			zap.String("report_id", c.ReportStatus.Id))
 
-		resp, err := client.Do(req)
+		resp, body, rateLimit, err := c.getNoCache(
+			ctx,
+			fmt.Sprintf(ApiPathReport, "%s", c.ReportStatus.Id),
+			nil,
+		)
+		ratelimitData = rateLimit
 		if err != nil {
-			return nil, fmt.Errorf("failed to poll report status: %w", err)
+			return nil, ratelimitData, fmt.Errorf("failed to poll report status: %w", err)
 		}
 
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
+		polled, err := decodePollResponse(resp.StatusCode, resp.Header.Get(uhttp.ContentType), body, c.ReportColumns)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read status response: %w", err)
+			var clientErr *Error
+			if errors.As(err, &clientErr) {
+				clientErr.RateLimit = ratelimitData
+			}
+			return nil, ratelimitData, err
 		}
 
-		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("status polling failed with code %d: %s", resp.StatusCode, string(body))
+		if polled.Report != nil {
+			logger.Info("Report data ready immediately",
+				zap.String("report_id", c.ReportStatus.Id),
+				zap.Int("polling_attempts", attempts),
+				zap.Int("report_entries", len(*polled.Report)))
+			return polled.Report, ratelimitData, nil
 		}
 
-		// Try to unmarshal as status first
-		var status ReportStatus
-		err = json.Unmarshal(body, &status)
-		if err == nil {
-			// Preserve the original report ID if the status response doesn't include it
-			originalId := c.ReportStatus.Id
-			c.ReportStatus = status
-			if c.ReportStatus.Id == "" {
-				c.ReportStatus.Id = originalId
-			}
+		status := *polled.Status
 
-			logger.Debug("Report status update",
-				zap.String("status", status.Status),
-				zap.Int("attempt", attempts),
-				zap.String("report_id", c.ReportStatus.Id))
+		// Preserve the original report ID if the status response doesn't include it
+		originalId := c.ReportStatus.Id
+		c.ReportStatus = status
+		if c.ReportStatus.Id == "" {
+			c.ReportStatus.Id = originalId
+		}
 
-			if status.Status == "FAILED" {
-				return nil, fmt.Errorf("report generation failed: %v", status)
-			}
+		logger.Debug("Report status update",
+			zap.String("status", status.Status),
+			zap.Int("attempt", attempts),
+			zap.String("report_id", c.ReportStatus.Id))
 
-			if status.Status == "COMPLETED" {
-				logger.Info("Report generation completed",
-					zap.String("report_id", c.ReportStatus.Id),
-					zap.Int("polling_attempts", attempts))
-				return nil, nil // Status completed but we need to fetch data separately
+		switch status.Status {
+		case ReportStatusFailed:
+			cause := fmt.Errorf("report %s reported status %s", c.ReportStatus.Id, status.Status)
+			if status.Error != "" {
+				cause = fmt.Errorf("%w: %s", cause, status.Error)
 			}
+			return nil, ratelimitData, &Error{Kind: ErrReportFailed, Err: cause}
+		case ReportStatusCompleted:
+			logger.Info("Report generation completed",
+				zap.String("report_id", c.ReportStatus.Id),
+				zap.Int("polling_attempts", attempts))
+			return nil, ratelimitData, nil // Status completed but we need to fetch data separately
+		}
 
-			// Still processing, wait and continue
-			time.Sleep(config.RetryAfterSeconds * time.Second)
-			continue
+		// Still processing, wait and continue
+		time.Sleep(config.RetryAfterSeconds * time.Second)
+	}
+
+	return nil, ratelimitData, &Error{
+		Kind: ErrReportTimedOut,
+		Err:  fmt.Errorf("report %s not ready after %d polling attempts", c.ReportStatus.Id, attempts),
+	}
+}
+
+// pollResponse is the decoded body of a report status poll. Exactly one of
+// Status or Report is set.
+type pollResponse struct {
+	Status *ReportStatus
+	Report *Report
+}
+
+// decodePollResponse decides what a poll returned from the status code, the
+// Content-Type and the first JSON token, rather than by trial-unmarshalling:
+//
+//   - non-200: a Percipio error payload, returned as *APIError
+//   - `[`: the report rows themselves (the report is ready), keeping the
+//     unmapped columns listed in columns
+//   - `{` with a known `status`: a ReportStatus
+//   - `{` with error fields: a Percipio error payload, returned as *APIError
+//
+// Anything else is an ErrUnexpectedResponse so polling fails fast.
+func decodePollResponse(statusCode int, contentType string, body []byte, columns []string) (*pollResponse, error) {
+	if statusCode != http.StatusOK {
+		err := fmt.Errorf("status polling failed with code %d: %w", statusCode, decodeAPIError(statusCode, contentType, body))
+		if kind := classifyStatus(statusCode); kind != nil {
+			return nil, &Error{Kind: kind, Err: err}
 		}
+		return nil, err
+	}
 
-		// If we can't unmarshal as status, try as report data (report is ready)
-		var report Report
-		err = json.Unmarshal(body, &report)
-		if err == nil {
-			logger.Info("Report data ready immediately",
-				zap.String("report_id", c.ReportStatus.Id),
-				zap.Int("polling_attempts", attempts),
-				zap.Int("report_entries", len(report)))
-			return &report, nil
+	if !uhttp.IsJSONContentType(contentType) {
+		return nil, fmt.Errorf("%w: content type %q", ErrUnexpectedResponse, contentType)
+	}
+
+	token, err := json.NewDecoder(bytes.NewReader(body)).Token()
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON body: %w", ErrUnexpectedResponse, err)
+	}
+
+	switch token {
+	case json.Delim('['):
+		report, err := DecodeReport(body, columns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode report data: %w", err)
 		}
+		return &pollResponse{Report: &report}, nil
 
-		// Neither status nor report format worked
-		sampleLen := len(body)
-		if sampleLen > 100 {
-			sampleLen = 100
+	case json.Delim('{'):
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, fmt.Errorf("failed to decode status response: %w", err)
 		}
-		logger.Debug("Response format not recognized, continuing",
-			zap.String("response_sample", string(body[:sampleLen])))
-		time.Sleep(config.RetryAfterSeconds * time.Second)
+
+		if _, ok := fields["status"]; ok {
+			var status ReportStatus
+			if err := json.Unmarshal(body, &status); err != nil {
+				return nil, fmt.Errorf("failed to decode status response: %w", err)
+			}
+			switch status.Status {
+			case ReportStatusPending, ReportStatusInProgress, ReportStatusCompleted, ReportStatusFailed:
+				return &pollResponse{Status: &status}, nil
+			}
+			return nil, fmt.Errorf("%w: unknown report status %q", ErrUnexpectedResponse, status.Status)
+		}
+
+		if hasAnyKey(fields, "errorCode", "error", "message") {
+			return nil, decodeAPIError(statusCode, contentType, body)
+		}
+
+		return nil, fmt.Errorf("%w: object without status or error fields", ErrUnexpectedResponse)
 	}
 
-	return nil, fmt.Errorf("report polling timed out after %d attempts", attempts)
+	return nil, fmt.Errorf("%w: body starts with %v", ErrUnexpectedResponse, token)
+}
+
+func hasAnyKey(fields map[string]json.RawMessage, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := fields[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeAPIError turns an error response body into an *APIError. Bodies that
+// aren't a JSON error payload still produce one, carrying the status code and
+// a short excerpt of the body.
+func decodeAPIError(statusCode int, contentType string, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode}
+	if uhttp.IsJSONContentType(contentType) && json.Unmarshal(body, apiErr) == nil {
+		apiErr.StatusCode = statusCode
+		return apiErr
+	}
+
+	const maxExcerpt = 200
+	excerpt := strings.TrimSpace(string(body))
+	if len(excerpt) > maxExcerpt {
+		excerpt = excerpt[:maxExcerpt]
+	}
+	apiErr.Message = excerpt
+	return apiErr
 }
 
 func (c *Client) GetLearningActivityReport(
@@ -228,43 +337,40 @@ func (c *Client) GetLearningActivityReport(
 	*v2.RateLimitDescription,
 	error,
 ) {
-	logger := ctxzap.Extract(ctx)
+	logger := logging.Extract(ctx)
 
-	// Poll for status using standard HTTP (no cache)
-	report, err := c.pollReportStatus(ctx)
+	// Poll for status, bypassing the HTTP cache
+	report, ratelimitData, err := c.pollReportStatus(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to poll report status: %w", err)
+		return ratelimitData, fmt.Errorf("failed to poll report status: %w", err)
 	}
 
-	var ratelimitData *v2.RateLimitDescription
-
 	// If polling returned report data directly, use it
 	if report != nil {
 		logger.Debug("Using report data from polling response")
 		c.loadedReport = report
 		c.ReportStatus.Status = "done"
-		// Create a basic rate limit response since polling doesn't provide it
-		ratelimitData = &v2.RateLimitDescription{
-			Limit:     -1,
-			Remaining: 0,
-			ResetAt:   nil,
-			Status:    v2.RateLimitDescription_STATUS_UNSPECIFIED,
-		}
 	} else {
-		// Otherwise fetch the report data
-		var target Report
-		response, rateLimit, err := c.get(
+		// Otherwise fetch the report data, decoded like a polled report so
+		// the configured report columns are kept.
+		response, body, rateLimit, err := c.getNoCache(
 			ctx,
 			fmt.Sprintf(ApiPathReport, "%s", c.ReportStatus.Id),
 			nil,
-			&target,
 		)
 		if err != nil {
 			return rateLimit, fmt.Errorf("failed to fetch report data: %w", err)
 		}
-		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			apiErr := decodeAPIError(response.StatusCode, response.Header.Get(uhttp.ContentType), body)
+			return rateLimit, classifyError(response, rateLimit, fmt.Errorf("failed to fetch report data: %w", apiErr))
+		}
+		target, err := DecodeReport(body, c.ReportColumns)
+		if err != nil {
+			return rateLimit, fmt.Errorf("failed to decode report data: %w", err)
+		}
 
-		logger.Debug("Fetched report data using baton-sdk")
+		logger.Debug("Fetched report data")
 		c.loadedReport = &target
 		c.ReportStatus.Status = "done"
 		ratelimitData = rateLimit
@@ -287,14 +393,325 @@ func (c *Client) GetLearningActivityReport(
 		zap.Int("estimated_size_bytes", reportSizeBytes),
 		zap.Float64("estimated_size_mb", float64(reportSizeBytes)/1024/1024))
 
-	err = c.StatusesStore.Load(ctx, c.loadedReport)
-	if err != nil {
+	logUnparsableDates(ctx, c.loadedReport)
+	if err := c.loadStatuses(ctx, c.loadedReport); err != nil {
 		return ratelimitData, err
 	}
-	return ratelimitData, nil
+	return ratelimitData, c.loadStatusHistory(ctx, c.loadedReport)
+}
+
+// LoadReport replaces the loaded report with one obtained elsewhere (e.g. a
+// report cached by a previous sync) and rebuilds the statuses store from it.
+func (c *Client) LoadReport(ctx context.Context, report *Report) error {
+	c.loadedReport = report
+	logUnparsableDates(ctx, report)
+	if err := c.loadStatuses(ctx, report); err != nil {
+		return err
+	}
+	return c.loadStatusHistory(ctx, report)
+}
+
+// loadStatuses replaces the statuses store with one loaded from report,
+// releasing the previous one.
+func (c *Client) loadStatuses(ctx context.Context, report *Report) error {
+	if err := closeStatusesStore(c.StatusesStore); err != nil {
+		logging.Extract(ctx).Warn("Failed to release previous status store", zap.Error(err))
+	}
+	c.StatusesStore = NewCompactStatusesStore()
+
+	store, err := c.StatusStore.newStatusesStore(ctx, len(*report))
+	if err != nil {
+		return err
+	}
+	if err := store.Load(ctx, report); err != nil {
+		return errors.Join(err, closeStatusesStore(store))
+	}
+	c.StatusesStore = store
+	return nil
+}
+
+// Close releases the statuses store, removing it from disk if it is kept
+// there.
+func (c *Client) Close() error {
+	err := closeStatusesStore(c.StatusesStore)
+	c.StatusesStore = NewCompactStatusesStore()
+	return err
+}
+
+// loadStatusHistory adds report to the status history, if it is kept. The
+// history builds up over the reports loaded; set StatusHistory beforehand to
+// start from a saved one.
+func (c *Client) loadStatusHistory(ctx context.Context, report *Report) error {
+	if !c.KeepStatusHistory {
+		c.StatusHistory = nil
+		return nil
+	}
+	if c.StatusHistory == nil {
+		c.StatusHistory = make(StatusHistory)
+	}
+	return c.StatusHistory.Load(ctx, report)
 }
 
 // GetLoadedReport returns the loaded report data.
 func (c *Client) GetLoadedReport() *Report {
 	return c.loadedReport
 }
+
+// GetUser looks up a single user in the User Management service. It returns
+// nil without an error when Percipio doesn't know the user.
+func (c *Client) GetUser(
+	ctx context.Context,
+	userId string,
+) (
+	*User,
+	*v2.RateLimitDescription,
+	error,
+) {
+	var target ManagedUser
+	response, ratelimitData, err := c.get(
+		ctx,
+		fmt.Sprintf(ApiPathUser, "%s", escapePathParameter(userId)),
+		nil,
+		&target,
+	)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil, ratelimitData, nil
+		}
+		return nil, ratelimitData, err
+	}
+	defer response.Body.Close()
+
+	user := target.ToUser()
+	user.Id = userId
+	user.PercipioUserId = ""
+	return &user, ratelimitData, nil
+}
+
+// GetManagedUser looks up a single user and their role in the User Management
+// service, bypassing the response cache so a role changed earlier in the run
+// is seen. It returns nil without an error when Percipio doesn't know the
+// user.
+func (c *Client) GetManagedUser(
+	ctx context.Context,
+	userId string,
+) (
+	*ManagedUser,
+	*v2.RateLimitDescription,
+	error,
+) {
+	response, body, ratelimitData, err := c.getNoCache(
+		ctx,
+		fmt.Sprintf(ApiPathUser, "%s", escapePathParameter(userId)),
+		nil,
+	)
+	if err != nil {
+		return nil, ratelimitData, err
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ratelimitData, nil
+	default:
+		apiErr := decodeAPIError(response.StatusCode, response.Header.Get(uhttp.ContentType), body)
+		return nil, ratelimitData, classifyError(response, ratelimitData, fmt.Errorf("failed to get user: %w", apiErr))
+	}
+
+	var user ManagedUser
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, ratelimitData, fmt.Errorf("failed to decode user: %w", err)
+	}
+	return &user, ratelimitData, nil
+}
+
+// GetCourse looks up a single item in the Content Discovery catalog. It
+// returns nil without an error when Percipio doesn't know the content.
+func (c *Client) GetCourse(
+	ctx context.Context,
+	courseId string,
+) (
+	*Course,
+	*v2.RateLimitDescription,
+	error,
+) {
+	var target CatalogContent
+	response, ratelimitData, err := c.get(
+		ctx,
+		fmt.Sprintf(ApiPathCatalogContent, "%s", escapePathParameter(courseId)),
+		nil,
+		&target,
+	)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil, ratelimitData, nil
+		}
+		return nil, ratelimitData, err
+	}
+	defer response.Body.Close()
+
+	course := target.ToCourse(courseId)
+	return &course, ratelimitData, nil
+}
+
+// GetCatalogPage fetches one page of the Content Discovery catalog. The
+// catalog is paged by offset; the paging request ID returned with the first
+// page must be passed back with the following ones so they come from the same
+// snapshot of the catalog. It returns the total number of items alongside the
+// page.
+func (c *Client) GetCatalogPage(
+	ctx context.Context,
+	offset int,
+	limit int,
+	pagingRequestId string,
+) (
+	[]CatalogContent,
+	string,
+	int,
+	*v2.RateLimitDescription,
+	error,
+) {
+	queryParameters := map[string]any{
+		"offset": offset,
+		"max":    limit,
+	}
+	if pagingRequestId != "" {
+		queryParameters["pagingRequestId"] = pagingRequestId
+	}
+
+	var target []CatalogContent
+	response, ratelimitData, err := c.get(
+		ctx,
+		ApiPathCatalog,
+		queryParameters,
+		&target,
+	)
+	if err != nil {
+		return nil, "", 0, ratelimitData, err
+	}
+	defer response.Body.Close()
+
+	total, err := strconv.Atoi(response.Header.Get(HeaderNameTotalCount))
+	if err != nil {
+		// Without a total, keep paging until a short page comes back.
+		total = offset + len(target)
+		if len(target) == limit {
+			total++
+		}
+	}
+
+	return target, response.Header.Get(HeaderNamePagingRequestId), total, ratelimitData, nil
+}
+
+// GetUsersPage fetches one page of the users in the User Management service,
+// paged by offset. It returns the total number of users alongside the page.
+// Users are fetched around the response cache, since roles must reflect the
+// changes made by provisioning.
+func (c *Client) GetUsersPage(
+	ctx context.Context,
+	offset int,
+	limit int,
+) (
+	[]ManagedUser,
+	int,
+	*v2.RateLimitDescription,
+	error,
+) {
+	response, body, ratelimitData, err := c.getNoCache(
+		ctx,
+		ApiPathUsers,
+		map[string]any{
+			"offset": offset,
+			"max":    limit,
+		},
+	)
+	if err != nil {
+		return nil, 0, ratelimitData, err
+	}
+	if response.StatusCode != http.StatusOK {
+		apiErr := decodeAPIError(response.StatusCode, response.Header.Get(uhttp.ContentType), body)
+		return nil, 0, ratelimitData, classifyError(response, ratelimitData, fmt.Errorf("failed to list users: %w", apiErr))
+	}
+
+	var target []ManagedUser
+	if err := json.Unmarshal(body, &target); err != nil {
+		return nil, 0, ratelimitData, fmt.Errorf("failed to decode users: %w", err)
+	}
+
+	total, err := strconv.Atoi(response.Header.Get(HeaderNameTotalCount))
+	if err != nil {
+		// Without a total, keep paging until a short page comes back.
+		total = offset + len(target)
+		if len(target) == limit {
+			total++
+		}
+	}
+
+	return target, total, ratelimitData, nil
+}
+
+// UpdateUserRole changes a user's role in the User Management service.
+func (c *Client) UpdateUserRole(
+	ctx context.Context,
+	userId string,
+	role string,
+) (
+	*v2.RateLimitDescription,
+	error,
+) {
+	var target ManagedUser
+	response, ratelimitData, err := c.doRequest(
+		ctx,
+		http.MethodPatch,
+		fmt.Sprintf(ApiPathUser, "%s", escapePathParameter(userId)),
+		nil,
+		map[string]string{"role": role},
+		&target,
+	)
+	if err != nil {
+		return ratelimitData, err
+	}
+	defer response.Body.Close()
+
+	return ratelimitData, nil
+}
+
+// GetAssignmentsPage fetches one page of the content assigned to learners,
+// paged by offset. It returns the total number of assignments alongside the
+// page.
+func (c *Client) GetAssignmentsPage(
+	ctx context.Context,
+	offset int,
+	limit int,
+) (
+	[]Assignment,
+	int,
+	*v2.RateLimitDescription,
+	error,
+) {
+	var target []Assignment
+	response, ratelimitData, err := c.get(
+		ctx,
+		ApiPathAssignments,
+		map[string]any{
+			"offset": offset,
+			"max":    limit,
+		},
+		&target,
+	)
+	if err != nil {
+		return nil, 0, ratelimitData, err
+	}
+	defer response.Body.Close()
+
+	total, err := strconv.Atoi(response.Header.Get(HeaderNameTotalCount))
+	if err != nil {
+		// Without a total, keep paging until a short page comes back.
+		total = offset + len(target)
+		if len(target) == limit {
+			total++
+		}
+	}
+
+	return target, total, ratelimitData, nil
+}
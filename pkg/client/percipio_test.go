@@ -2,6 +2,8 @@ package client
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -96,6 +98,20 @@ func TestGenerateLearningActivityReport(t *testing.T) {
 
 		_, err = client.GenerateLearningActivityReport(ctx, 24*time.Hour)
 		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+	})
+
+	t.Run("should report unknown organization", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "missing-org", "test-token")
+		require.NoError(t, err)
+
+		_, err = client.GenerateLearningActivityReport(ctx, 24*time.Hour)
+		assert.ErrorIs(t, err, ErrOrganizationNotFound)
 	})
 }
 
@@ -137,6 +153,33 @@ func TestGetLearningActivityReport(t *testing.T) {
 		assert.Len(t, *client.loadedReport, 1)
 	})
 
+	t.Run("should keep report columns when fetching a completed report", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Contains(t, r.URL.Path, "/reporting/v1/organizations/test-org/report-requests/report-123")
+			requests++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			if requests == 1 {
+				_, _ = w.Write([]byte(`{"id": "report-123", "status": "COMPLETED"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`[{"userId": "user1", "contentId": "course1", "status": "Completed", "employeeId": "E100"}]`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		client.ReportStatus = ReportStatus{Id: "report-123", Status: "PENDING"}
+		client.ReportColumns = []string{"employeeId"}
+
+		_, err = client.GetLearningActivityReport(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, requests)
+		require.Len(t, *client.loadedReport, 1)
+		assert.Equal(t, "E100", (*client.loadedReport)[0].Attributes["employeeId"])
+	})
+
 	t.Run("should handle failed report", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
@@ -155,6 +198,210 @@ func TestGetLearningActivityReport(t *testing.T) {
 	})
 }
 
+func TestPollReportStatus(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should retry rate limited polls honoring Retry-After", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			if calls == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("X-Ratelimit-Limit", "100")
+			w.Header().Set("X-Ratelimit-Remaining", "99")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`[{"userId": "user1", "contentId": "course1", "status": "Completed"}]`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		client.ReportStatus = ReportStatus{Id: "report-123", Status: "PENDING"}
+
+		report, rateLimit, err := client.pollReportStatus(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, report)
+		assert.Len(t, *report, 1)
+		assert.Equal(t, 2, calls)
+		require.NotNil(t, rateLimit)
+		assert.Equal(t, int64(100), rateLimit.Limit)
+		assert.Equal(t, int64(99), rateLimit.Remaining)
+	})
+
+	t.Run("should retry server errors with backoff", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"id": "report-123", "status": "FAILED"}`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		client.retryBaseDelay = time.Millisecond
+		client.ReportStatus = ReportStatus{Id: "report-123", Status: "PENDING"}
+
+		_, _, err = client.pollReportStatus(ctx)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "report generation failed")
+		assert.ErrorIs(t, err, ErrReportFailed)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("should fail fast on unrecognized responses", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"unexpected": true}`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		client.ReportStatus = ReportStatus{Id: "report-123", Status: "PENDING"}
+
+		_, _, err = client.pollReportStatus(ctx)
+		assert.ErrorIs(t, err, ErrUnexpectedResponse)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should not retry client errors", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		client.retryBaseDelay = time.Millisecond
+		client.ReportStatus = ReportStatus{Id: "report-123", Status: "PENDING"}
+
+		_, _, err = client.pollReportStatus(ctx)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "status polling failed with code 401")
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestDecodePollResponse(t *testing.T) {
+	testCases := []struct {
+		name        string
+		statusCode  int
+		contentType string
+		body        string
+		wantStatus  string
+		wantRows    int
+		wantAPIErr  bool
+		wantUnknown bool
+	}{
+		{
+			name:        "pending status",
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			body:        `{"id": "report-123", "status": "PENDING"}`,
+			wantStatus:  ReportStatusPending,
+		},
+		{
+			name:        "report rows",
+			statusCode:  http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body:        `[{"userId": "user1"}, {"userId": "user2"}]`,
+			wantRows:    2,
+		},
+		{
+			name:        "empty report",
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			body:        `[]`,
+			wantRows:    0,
+		},
+		{
+			name:        "error payload with 200",
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			body:        `{"errorCode": "REPORT_NOT_FOUND", "message": "No report with that id"}`,
+			wantAPIErr:  true,
+		},
+		{
+			name:        "error payload with 401",
+			statusCode:  http.StatusUnauthorized,
+			contentType: "application/json",
+			body:        `{"error": "unauthorized"}`,
+			wantAPIErr:  true,
+		},
+		{
+			name:        "unknown object",
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			body:        `{"foo": "bar"}`,
+			wantUnknown: true,
+		},
+		{
+			name:        "unknown status value",
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			body:        `{"id": "report-123", "status": "EXPLODED"}`,
+			wantUnknown: true,
+		},
+		{
+			name:        "scalar body",
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			body:        `"COMPLETED"`,
+			wantUnknown: true,
+		},
+		{
+			name:        "html body",
+			statusCode:  http.StatusOK,
+			contentType: "text/html",
+			body:        `<html>maintenance</html>`,
+			wantUnknown: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			polled, err := decodePollResponse(tc.statusCode, tc.contentType, []byte(tc.body), nil)
+
+			var apiErr *APIError
+			switch {
+			case tc.wantAPIErr:
+				require.Error(t, err)
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, tc.statusCode, apiErr.StatusCode)
+			case tc.wantUnknown:
+				require.Error(t, err)
+				assert.ErrorIs(t, err, ErrUnexpectedResponse)
+			case tc.wantStatus != "":
+				require.NoError(t, err)
+				require.NotNil(t, polled.Status)
+				assert.Nil(t, polled.Report)
+				assert.Equal(t, tc.wantStatus, polled.Status.Status)
+			default:
+				require.NoError(t, err)
+				require.NotNil(t, polled.Report)
+				assert.Nil(t, polled.Status)
+				assert.Len(t, *polled.Report, tc.wantRows)
+			}
+		})
+	}
+}
+
 func TestGetLoadedReport(t *testing.T) {
 	ctx := context.Background()
 
@@ -173,3 +420,271 @@ func TestGetLoadedReport(t *testing.T) {
 	// Should return the report
 	assert.Equal(t, testReport, client.GetLoadedReport())
 }
+
+func TestLoadReport(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := New(ctx, "https://api.example.com", "test-org", "test-token")
+	require.NoError(t, err)
+	client.StatusesStore = MapStatusesStore{"stale_course": {"someone": "completed"}}
+
+	report := &Report{
+		{UserId: "michael.bolton@initech.com", ContentId: "bs_adg02_a23_enus", Status: "Completed"},
+	}
+	require.NoError(t, client.LoadReport(ctx, report))
+
+	assert.Equal(t, report, client.GetLoadedReport())
+	assert.Nil(t, getStatuses(t, client.StatusesStore, "stale_course"))
+	assert.Equal(t, "completed", getStatuses(t, client.StatusesStore, "bs_adg02_a23_enus")["michael.bolton@initech.com"])
+}
+
+func TestGetUser(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should look up a single user", func(t *testing.T) {
+		var requestedPath string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestedPath = r.URL.Path
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"id": "b2f4", "loginName": "michael.bolton@initech.com", "firstName": "Michael", "lastName": "Bolton", "isActive": true}`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		user, _, err := client.GetUser(ctx, "michael.bolton@initech.com")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, "/user-management/v1/organizations/test-org/users/michael.bolton@initech.com", requestedPath)
+		assert.Equal(t, "michael.bolton@initech.com", user.Id)
+		assert.Equal(t, "michael.bolton@initech.com", user.Email)
+		assert.Equal(t, "Michael", user.FirstName)
+		assert.Equal(t, "Bolton", user.LastName)
+	})
+
+	t.Run("should return nil for unknown users", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errorCode": "NOT_FOUND", "message": "User not found"}`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		user, _, err := client.GetUser(ctx, "nobody%40initech.com")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+}
+
+func TestGetManagedUser(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should see role changes made during the run", func(t *testing.T) {
+		role := "Admin"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/user-management/v1/organizations/test-org/users/b2f4", r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = fmt.Fprintf(w, `{"id": "b2f4", "role": %q, "isActive": true}`, role)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		user, _, err := client.GetManagedUser(ctx, "b2f4")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, "Admin", user.Role)
+
+		role = "Learner"
+		user, _, err = client.GetManagedUser(ctx, "b2f4")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, "Learner", user.Role)
+	})
+
+	t.Run("should return nil for unknown users", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errorCode": "NOT_FOUND", "message": "User not found"}`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		user, _, err := client.GetManagedUser(ctx, "nobody")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("should classify failures", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		_, _, err = client.GetManagedUser(ctx, "b2f4")
+		assert.ErrorIs(t, err, ErrForbidden)
+	})
+}
+
+func TestGetCourse(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should look up a single catalog item", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/content-discovery/v1/organizations/test-org/catalog-content/bs_adg02_a23_enus", r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{
+				"id": "f00d",
+				"code": "bs_adg02_a23_enus",
+				"contentType": {"percipioType": "COURSE", "category": "COURSE", "displayLabel": "Course"},
+				"localizedMetadata": [{"localeCode": "en-US", "title": "Case Studies: Successful Data Privacy Implementations", "description": "Explore real-world data privacy programs."}],
+				"duration": "PT25M3S",
+				"publication": {"publisher": "Skillsoft", "copyrightYear": 2023}
+			}`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		course, _, err := client.GetCourse(ctx, "bs_adg02_a23_enus")
+		require.NoError(t, err)
+		require.NotNil(t, course)
+		assert.Equal(t, "bs_adg02_a23_enus", course.Id)
+		assert.Equal(t, "Case Studies: Successful Data Privacy Implementations", course.CourseTitle)
+		assert.Equal(t, "Course", course.ContentType)
+		assert.Equal(t, "en-US", course.Locale)
+		assert.Equal(t, "PT25M3S", course.Duration)
+		assert.Equal(t, "Skillsoft", course.Provider)
+		assert.Equal(t, "Explore real-world data privacy programs.", course.Description)
+	})
+
+	t.Run("should return nil for unknown content", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		course, _, err := client.GetCourse(ctx, "missing")
+		require.NoError(t, err)
+		assert.Nil(t, course)
+	})
+
+	t.Run("should surface other failures", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		course, _, err := client.GetCourse(ctx, "bs_adg02_a23_enus")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrForbidden)
+		assert.Nil(t, course)
+	})
+}
+
+func TestGetUsersPage(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/user-management/v1/organizations/test-org/users", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("offset"))
+		assert.Equal(t, "2", r.URL.Query().Get("max"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("x-total-count", "3")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[
+			{"id": "c3a5", "email": "milton.waddams@initech.com", "role": "Learner", "isActive": true},
+			{"id": "d4b6", "loginName": "bill.lumbergh@initech.com", "role": "Admin", "isActive": true}
+		]`))
+	}))
+	defer server.Close()
+
+	client, err := New(ctx, server.URL, "test-org", "test-token")
+	require.NoError(t, err)
+
+	users, total, _, err := client.GetUsersPage(ctx, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Len(t, users, 2)
+	assert.Equal(t, "Learner", users[0].Role)
+	assert.Equal(t, "Admin", users[1].Role)
+	assert.Equal(t, "bill.lumbergh@initech.com", users[1].ToUser().Email)
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		method string
+		path   string
+		body   map[string]string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"id": "c3a5", "role": "Manager", "isActive": true}`))
+	}))
+	defer server.Close()
+
+	client, err := New(ctx, server.URL, "test-org", "test-token")
+	require.NoError(t, err)
+
+	_, err = client.UpdateUserRole(ctx, "c3a5", "Manager")
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPatch, method)
+	assert.Equal(t, "/user-management/v1/organizations/test-org/users/c3a5", path)
+	assert.Equal(t, map[string]string{"role": "Manager"}, body)
+}
+
+func TestGetAssignmentsPage(t *testing.T) {
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/content-assignment/v1/organizations/test-org/assignments", r.URL.Path)
+		assert.Equal(t, "0", r.URL.Query().Get("offset"))
+		assert.Equal(t, "2", r.URL.Query().Get("max"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[
+			{"id": "a1", "name": "Compliance 2025", "userId": "c3a5", "contentId": "course1", "dueDate": "2025-03-31"},
+			{"id": "a1", "name": "Compliance 2025", "userId": "d4b6", "contentId": "course1"}
+		]`))
+	}))
+	defer server.Close()
+
+	client, err := New(ctx, server.URL, "test-org", "test-token")
+	require.NoError(t, err)
+
+	assignments, total, _, err := client.GetAssignmentsPage(ctx, 0, 2)
+	require.NoError(t, err)
+	// Without a total count header a full page means there may be more.
+	assert.Equal(t, 3, total)
+	require.Len(t, assignments, 2)
+	assert.Equal(t, "c3a5", assignments[0].UserId)
+	assert.Equal(t, time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC), assignments[0].DueAt())
+	assert.True(t, assignments[1].DueAt().IsZero())
+}
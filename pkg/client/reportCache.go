@@ -2,13 +2,119 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"slices"
 	"time"
 
-	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
 	"go.uber.org/zap"
 )
 
-type StatusesStore map[string]map[string]string
+// StatusesStore holds the course status of every user in a loaded report.
+type StatusesStore interface {
+	// Load adds the statuses in report, the last row for a user and course
+	// winning.
+	Load(ctx context.Context, report *Report) error
+	// Get returns a mapping of user IDs to statuses for a course, or nil if
+	// nobody has a status on it. Stores that don't keep maps build it on
+	// each call; Statuses reads a course without holding it whole.
+	Get(courseId string) (map[string]string, error)
+	// Statuses calls yield with the ID and status of each user with a
+	// status on a course, in user ID order, starting after the user ID
+	// after ("" starts at the first). It stops early when yield returns
+	// false. yield may call the store.
+	Statuses(courseId string, after string, yield func(userId string, status string) bool) error
+	// Merge moves the statuses of merged users to their survivors; see
+	// MapStatusesStore.Merge.
+	Merge(survivors map[string]string) (int, error)
+	// Courses returns an iterator over the IDs of the courses with
+	// statuses, in no particular order.
+	Courses() (iter.Seq[string], error)
+	// Len returns the number of courses with statuses.
+	Len() (int, error)
+}
+
+const (
+	// StatusStoreAuto keeps statuses in memory, or on disk for reports of
+	// more than StatusStoreOptions.DiskRows rows.
+	StatusStoreAuto   = "auto"
+	StatusStoreMemory = "memory"
+	StatusStoreDisk   = "disk"
+
+	// DefaultStatusStoreDiskRows is the report size above which statuses
+	// are kept on disk by default.
+	DefaultStatusStoreDiskRows = 5_000_000
+)
+
+// StatusStores lists the valid StatusStoreOptions kinds.
+var StatusStores = []string{StatusStoreAuto, StatusStoreMemory, StatusStoreDisk}
+
+// StatusStoreOptions controls where the statuses of a loaded report are kept.
+type StatusStoreOptions struct {
+	// Kind is StatusStoreAuto, StatusStoreMemory or StatusStoreDisk. Empty
+	// means StatusStoreAuto.
+	Kind string
+	// DiskRows is the report size above which StatusStoreAuto keeps
+	// statuses on disk. Zero means DefaultStatusStoreDiskRows.
+	DiskRows int
+	// Dir is the directory disk stores are created in. Empty means the OS
+	// temporary directory.
+	Dir string
+}
+
+// Validate checks the status store configuration.
+func (o StatusStoreOptions) Validate() error {
+	if o.Kind != "" && !slices.Contains(StatusStores, o.Kind) {
+		return fmt.Errorf("invalid status store %q: expected one of %v", o.Kind, StatusStores)
+	}
+	if o.DiskRows < 0 {
+		return fmt.Errorf("invalid status store disk rows %d: must not be negative", o.DiskRows)
+	}
+	return nil
+}
+
+// onDisk reports whether the statuses of a report with rows rows are kept on
+// disk.
+func (o StatusStoreOptions) onDisk(rows int) bool {
+	switch o.Kind {
+	case StatusStoreDisk:
+		return true
+	case StatusStoreMemory:
+		return false
+	}
+	diskRows := o.DiskRows
+	if diskRows == 0 {
+		diskRows = DefaultStatusStoreDiskRows
+	}
+	return rows > diskRows
+}
+
+// newStatusesStore returns an empty store for a report with rows rows.
+func (o StatusStoreOptions) newStatusesStore(ctx context.Context, rows int) (StatusesStore, error) {
+	if !o.onDisk(rows) {
+		return NewCompactStatusesStore(), nil
+	}
+	logging.Extract(ctx).Info("Keeping course statuses on disk",
+		zap.Int("report_entries", rows),
+		zap.String("status_store", o.Kind))
+	return NewDiskStatusesStore(ctx, o.Dir)
+}
+
+// closeStatusesStore releases a store that holds resources, e.g. a
+// DiskStatusesStore's database.
+func closeStatusesStore(store StatusesStore) error {
+	if closer, ok := store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// MapStatusesStore is a StatusesStore kept as nested maps. It is also the
+// form statuses are saved in.
+type MapStatusesStore map[string]map[string]string
 
 // Load given a Report (which again, can be on the order of 1 GB), and just
 // create a mapping of course IDs to a mapping of user IDs to statuses. e.g.:
@@ -19,8 +125,8 @@ type StatusesStore map[string]map[string]string
 //	    "00000000-0000-0000-0000-000000000002": "completed",
 //	  },
 //	}
-func (r StatusesStore) Load(ctx context.Context, report *Report) error {
-	logger := ctxzap.Extract(ctx)
+func (r MapStatusesStore) Load(ctx context.Context, report *Report) error {
+	logger := logging.Extract(ctx)
 	startTime := time.Now()
 
 	logger.Debug("Starting to load status store from report",
@@ -58,25 +164,115 @@ func (r StatusesStore) Load(ctx context.Context, report *Report) error {
 }
 
 // Get - return a mapping of user IDs to course completion status.
-// TODO(marcos) Should we use enums instead?
-func (r StatusesStore) Get(courseUUID string) map[string]string {
+func (r MapStatusesStore) Get(courseUUID string) (map[string]string, error) {
 	found, ok := r[courseUUID]
 	if !ok {
 		// `nil` and empty map are equivalent.
-		return nil
+		return nil, nil
 	}
-	return found
+	return found, nil
 }
 
-func toStatus(status string) string {
+// Statuses calls yield with the statuses of a course in user ID order,
+// starting after the user ID after. The user IDs are sorted on each call.
+func (r MapStatusesStore) Statuses(courseId string, after string, yield func(userId string, status string) bool) error {
+	users := r[courseId]
+	for _, userId := range slices.Sorted(maps.Keys(users)) {
+		if userId <= after {
+			continue
+		}
+		if !yield(userId, users[userId]) {
+			break
+		}
+	}
+	return nil
+}
+
+// Courses iterates over the IDs of the courses with statuses.
+func (r MapStatusesStore) Courses() (iter.Seq[string], error) {
+	return maps.Keys(r), nil
+}
+
+// Len returns the number of courses with statuses.
+func (r MapStatusesStore) Len() (int, error) {
+	return len(r), nil
+}
+
+// collectStatuses builds the Get mapping of a course from store.Statuses.
+func collectStatuses(store StatusesStore, courseId string) (map[string]string, error) {
+	var statuses map[string]string
+	err := store.Statuses(courseId, "", func(userId string, status string) bool {
+		if statuses == nil {
+			statuses = make(map[string]string)
+		}
+		statuses[userId] = status
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// CopyStatuses copies any StatusesStore into a MapStatusesStore, e.g. to save
+// it.
+func CopyStatuses(store StatusesStore) (MapStatusesStore, error) {
+	copied := make(MapStatusesStore)
+	if store == nil {
+		return copied, nil
+	}
+	courses, err := store.Courses()
+	if err != nil {
+		return nil, err
+	}
+	for courseId := range courses {
+		statuses, err := collectStatuses(store, courseId)
+		if err != nil {
+			return nil, err
+		}
+		if len(statuses) > 0 {
+			copied[courseId] = statuses
+		}
+	}
+	return copied, nil
+}
+
+// Merge moves the statuses of users to the users they were merged into, given
+// as a mapping of merged user ID to surviving user ID. When both users have a
+// status for a course, the more advanced one is kept. It returns how many
+// statuses were moved.
+func (r MapStatusesStore) Merge(survivors map[string]string) (int, error) {
+	moved := 0
+	for _, users := range r {
+		for userId, survivor := range survivors {
+			status, ok := users[userId]
+			if !ok {
+				continue
+			}
+			delete(users, userId)
+			if existing, ok := users[survivor]; !ok || statusRank(status) > statusRank(existing) {
+				users[survivor] = status
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// statusRank orders statuses by how far along a user is.
+func statusRank(status string) int {
 	switch status {
-	case "":
-		return "no_status_reported"
-	case "Completed", "Achieved", "Listened", "Read", "Watched":
-		return "completed"
-	case "Started", "Active":
-		return "in_progress"
+	case "completed":
+		return 3
+	case "in_progress":
+		return 2
+	case "status_undefined":
+		return 1
 	default:
-		return "status_undefined"
+		return 0
 	}
 }
+
+func toStatus(status string) string {
+	return reportStatus(status).String()
+}
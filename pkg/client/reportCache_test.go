@@ -2,17 +2,52 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// getStatuses reads a course's statuses from store, failing the test on
+// error.
+func getStatuses(t *testing.T, store StatusesStore, courseId string) map[string]string {
+	t.Helper()
+	statuses, err := store.Get(courseId)
+	require.NoError(t, err)
+	return statuses
+}
+
+// courseIds returns the courses with statuses in store, in its order.
+func courseIds(t *testing.T, store StatusesStore) []string {
+	t.Helper()
+	courses, err := store.Courses()
+	require.NoError(t, err)
+	return slices.Collect(courses)
+}
+
+// courseCount returns how many courses have statuses in store.
+func courseCount(t *testing.T, store StatusesStore) int {
+	t.Helper()
+	count, err := store.Len()
+	require.NoError(t, err)
+	return count
+}
+
+// mergeStatuses merges users in store, failing the test on error.
+func mergeStatuses(t *testing.T, store StatusesStore, survivors map[string]string) int {
+	t.Helper()
+	moved, err := store.Merge(survivors)
+	require.NoError(t, err)
+	return moved
+}
+
 func TestStatusesStoreLoad(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("should load report data correctly", func(t *testing.T) {
-		store := make(StatusesStore)
+		store := make(MapStatusesStore)
 		report := &Report{
 			{
 				UserId:       "michael.bolton@initech.com",
@@ -56,20 +91,20 @@ func TestStatusesStoreLoad(t *testing.T) {
 
 		assert.Len(t, store, 2)
 
-		course1Users := store.Get("bs_adg02_a23_enus")
+		course1Users := getStatuses(t, store, "bs_adg02_a23_enus")
 		assert.Len(t, course1Users, 4)
 		assert.Equal(t, "completed", course1Users["michael.bolton@initech.com"])
 		assert.Equal(t, "in_progress", course1Users["milton.waddams@initech.com"])
 		assert.Equal(t, "no_status_reported", course1Users["peter.gibbons@initech.com"])
 		assert.Equal(t, "status_undefined", course1Users["bill.lumbergh@initech.com"])
 
-		course2Users := store.Get("another_course_id")
+		course2Users := getStatuses(t, store, "another_course_id")
 		assert.Len(t, course2Users, 1)
 		assert.Equal(t, "in_progress", course2Users["michael.bolton@initech.com"])
 	})
 
 	t.Run("should handle empty report", func(t *testing.T) {
-		store := make(StatusesStore)
+		store := make(MapStatusesStore)
 		report := &Report{}
 
 		err := store.Load(ctx, report)
@@ -78,7 +113,7 @@ func TestStatusesStoreLoad(t *testing.T) {
 	})
 
 	t.Run("should handle duplicate entries", func(t *testing.T) {
-		store := make(StatusesStore)
+		store := make(MapStatusesStore)
 		report := &Report{
 			{
 				UserId:    "michael.bolton@initech.com",
@@ -95,14 +130,14 @@ func TestStatusesStoreLoad(t *testing.T) {
 		err := store.Load(ctx, report)
 		require.NoError(t, err)
 
-		course1Users := store.Get("bs_adg02_a23_enus")
+		course1Users := getStatuses(t, store, "bs_adg02_a23_enus")
 		assert.Len(t, course1Users, 1)
 		assert.Equal(t, "completed", course1Users["michael.bolton@initech.com"])
 	})
 }
 
-func TestStatusesStoreGet(t *testing.T) {
-	store := make(StatusesStore)
+func TestStatusesStoreStatuses(t *testing.T) {
+	store := make(MapStatusesStore)
 
 	store["bs_adg02_a23_enus"] = map[string]string{
 		"michael.bolton@initech.com": "completed",
@@ -112,7 +147,7 @@ func TestStatusesStoreGet(t *testing.T) {
 	}
 
 	t.Run("should return existing course mappings", func(t *testing.T) {
-		users := store.Get("bs_adg02_a23_enus")
+		users := getStatuses(t, store, "bs_adg02_a23_enus")
 		assert.Len(t, users, 4)
 		assert.Equal(t, "completed", users["michael.bolton@initech.com"])
 		assert.Equal(t, "in_progress", users["milton.waddams@initech.com"])
@@ -121,9 +156,52 @@ func TestStatusesStoreGet(t *testing.T) {
 	})
 
 	t.Run("should return nil for non-existent course", func(t *testing.T) {
-		users := store.Get("nonexistent_course")
+		users := getStatuses(t, store, "nonexistent_course")
 		assert.Nil(t, users)
 	})
+
+	t.Run("should read users in ID order after a cursor", func(t *testing.T) {
+		ctx := context.Background()
+		report := make(Report, 0, 2500)
+		for i := 2500; i > 0; i-- {
+			report = append(report, ReportEntry{UserId: fmt.Sprintf("user-%04d", i), ContentId: "course-a", Status: "Completed"})
+		}
+		disk, err := NewDiskStatusesStore(ctx, t.TempDir())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = disk.Close() })
+		stores := map[string]StatusesStore{
+			"map":     make(MapStatusesStore),
+			"compact": NewCompactStatusesStore(),
+			"disk":    disk,
+		}
+
+		for name, store := range stores {
+			require.NoError(t, store.Load(ctx, &report), name)
+
+			// Reading past a disk chunk takes more than one query.
+			userIds := readUserIds(t, store, "course-a", "user-0999", 1100)
+			assert.Len(t, userIds, 1100, name)
+			assert.Equal(t, "user-1000", userIds[0], name)
+			assert.Equal(t, "user-2099", userIds[len(userIds)-1], name)
+			assert.True(t, slices.IsSorted(userIds), name)
+
+			assert.Len(t, readUserIds(t, store, "course-a", "", 0), 2500, name)
+			assert.Empty(t, readUserIds(t, store, "course-a", "user-2500", 0), name)
+		}
+	})
+}
+
+// readUserIds reads the users of a course from store after the user ID after,
+// stopping after limit of them unless limit is 0.
+func readUserIds(t *testing.T, store StatusesStore, courseId string, after string, limit int) []string {
+	t.Helper()
+	var userIds []string
+	err := store.Statuses(courseId, after, func(userId string, _ string) bool {
+		userIds = append(userIds, userId)
+		return limit == 0 || len(userIds) < limit
+	})
+	require.NoError(t, err)
+	return userIds
 }
 
 func TestToStatus(t *testing.T) {
@@ -156,7 +234,7 @@ func TestStatusesStoreIntegration(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("should handle realistic report data", func(t *testing.T) {
-		store := make(StatusesStore)
+		store := make(MapStatusesStore)
 		report := &Report{
 			{
 				UserId:        "michael.bolton@initech.com",
@@ -213,15 +291,29 @@ func TestStatusesStoreIntegration(t *testing.T) {
 
 		assert.Len(t, store, 2)
 
-		course1 := store.Get("bs_adg02_a23_enus")
+		course1 := getStatuses(t, store, "bs_adg02_a23_enus")
 		assert.Len(t, course1, 4)
 		assert.Equal(t, "completed", course1["michael.bolton@initech.com"])
 		assert.Equal(t, "in_progress", course1["milton.waddams@initech.com"])
 		assert.Equal(t, "no_status_reported", course1["peter.gibbons@initech.com"])
 		assert.Equal(t, "status_undefined", course1["bill.lumbergh@initech.com"])
 
-		course2 := store.Get("another_course_id")
+		course2 := getStatuses(t, store, "another_course_id")
 		assert.Len(t, course2, 1)
 		assert.Equal(t, "in_progress", course2["michael.bolton@initech.com"])
 	})
 }
+
+func TestStatusesStoreMerge(t *testing.T) {
+	store := MapStatusesStore{
+		"course1": {"old": "completed", "new": "in_progress", "other": "in_progress"},
+		"course2": {"new": "completed", "third": "status_undefined"},
+		"course3": {"old": "no_status_reported", "third": "in_progress"},
+	}
+
+	moved := mergeStatuses(t, store, map[string]string{"new": "old", "third": "old"})
+	assert.Equal(t, 4, moved)
+	assert.Equal(t, map[string]string{"old": "completed", "other": "in_progress"}, getStatuses(t, store, "course1"))
+	assert.Equal(t, map[string]string{"old": "completed"}, getStatuses(t, store, "course2"))
+	assert.Equal(t, map[string]string{"old": "in_progress"}, getStatuses(t, store, "course3"))
+}
@@ -1,17 +1,26 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	liburl "net/url"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/ratelimit"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
-	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/iiiatthew/baton-percipio-report/pkg/config"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func (c *Client) getUrl(
@@ -37,6 +46,12 @@ func (c *Client) getUrl(
 	return output
 }
 
+// escapePathParameter escapes a value for use as a path segment in a path
+// template passed to getUrl, which still substitutes the organization ID.
+func escapePathParameter(value string) string {
+	return strings.ReplaceAll(liburl.PathEscape(value), "%", "%%")
+}
+
 // WithBearerToken - TODO(marcos): move this function to `baton-sdk`.
 func WithBearerToken(token string) uhttp.RequestOption {
 	return uhttp.WithHeader("Authorization", fmt.Sprintf("Bearer %s", token))
@@ -53,7 +68,9 @@ func (c *Client) get(
 	*v2.RateLimitDescription,
 	error,
 ) {
-	logger := ctxzap.Extract(ctx)
+	// The SDK logs request URLs through the request context's logger.
+	ctx = logging.ToContext(ctx)
+	logger := logging.Extract(ctx)
 	startTime := time.Now()
 
 	options := []uhttp.RequestOption{
@@ -96,7 +113,7 @@ func (c *Client) get(
 			zap.String("method", "GET"),
 			zap.String("endpoint", url.String()),
 			zap.Duration("duration", time.Since(startTime)))
-		return response, &ratelimitData, fmt.Errorf("error making GET request to %s: %w", url, err)
+		return response, &ratelimitData, classifyError(response, &ratelimitData, fmt.Errorf("error making GET request to %s: %w", url, err))
 	}
 
 	logger.Debug("API request completed",
@@ -142,7 +159,9 @@ func (c *Client) doRequest(
 	*v2.RateLimitDescription,
 	error,
 ) {
-	logger := ctxzap.Extract(ctx)
+	// The SDK logs request URLs through the request context's logger.
+	ctx = logging.ToContext(ctx)
+	logger := logging.Extract(ctx)
 	startTime := time.Now()
 
 	options := []uhttp.RequestOption{
@@ -184,7 +203,7 @@ func (c *Client) doRequest(
 			zap.String("method", method),
 			zap.String("endpoint", url.String()),
 			zap.Duration("duration", time.Since(startTime)))
-		return response, &ratelimitData, fmt.Errorf("error making %s request to %s: %w", method, url, err)
+		return response, &ratelimitData, classifyError(response, &ratelimitData, fmt.Errorf("error making %s request to %s: %w", method, url, err))
 	}
 
 	logger.Debug("API request completed",
@@ -197,3 +216,186 @@ func (c *Client) doRequest(
 
 	return response, &ratelimitData, nil
 }
+
+// getNoCache issues a GET straight through the HTTP client, so it never
+// reads or fills the wrapper's response cache. It is used for endpoints whose response changes
+// between identical requests (e.g. report status polling), where a cache hit
+// would hand back a stale status. Transient failures are retried with backoff,
+// honoring Retry-After when the server sends it.
+func (c *Client) getNoCache(
+	ctx context.Context,
+	path string,
+	queryParameters map[string]any,
+) (
+	*http.Response,
+	[]byte,
+	*v2.RateLimitDescription,
+	error,
+) {
+	logger := logging.Extract(ctx)
+
+	url := c.getUrl(path, queryParameters)
+
+	var (
+		response      *http.Response
+		body          []byte
+		ratelimitData *v2.RateLimitDescription
+		err           error
+	)
+	for attempt := 0; attempt <= config.RequestRetryMaximum; attempt++ {
+		startTime := time.Now()
+
+		logger.Debug("Making API request",
+			zap.String("method", "GET"),
+			zap.String("endpoint", url.String()),
+			zap.String("path", path),
+			zap.Bool("cache_bypass", true),
+			zap.Int("attempt", attempt+1))
+
+		response, body, ratelimitData, err = c.doNoCache(ctx, url)
+		if err != nil {
+			if !isTransientError(err) || attempt == config.RequestRetryMaximum {
+				logger.Error("API request failed",
+					zap.Error(err),
+					zap.String("method", "GET"),
+					zap.String("endpoint", url.String()),
+					zap.Duration("duration", time.Since(startTime)))
+				return nil, nil, ratelimitData, classifyError(nil, ratelimitData, fmt.Errorf("error making GET request to %s: %w", url, err))
+			}
+		} else if !isTransientStatus(response.StatusCode) || attempt == config.RequestRetryMaximum {
+			logger.Debug("API request completed",
+				zap.String("method", "GET"),
+				zap.String("endpoint", url.String()),
+				zap.Int("status_code", response.StatusCode),
+				zap.Duration("duration", time.Since(startTime)),
+				zap.Int("rate_limit_remaining", int(ratelimitData.Remaining)),
+				zap.Int64("rate_limit_reset_at", ratelimitData.ResetAt.GetSeconds()))
+			return response, body, ratelimitData, nil
+		}
+
+		delay := c.retryDelay(attempt, response)
+		logger.Warn("Transient API failure, retrying",
+			zap.String("endpoint", url.String()),
+			zap.Int("attempt", attempt+1),
+			zap.Int("status_code", statusCodeOf(response)),
+			zap.Error(err),
+			zap.Duration("retry_in", delay))
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ratelimitData, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	// Unreachable: the final attempt always returns above.
+	return response, body, ratelimitData, err
+}
+
+// doNoCache sends a single GET with the same headers as get/doRequest through
+// the HTTP client, bypassing the wrapper and its cache, and returns the fully
+// read body alongside the parsed rate limit data. Error statuses come back as
+// a response, not an error, so getNoCache and its callers can inspect them.
+func (c *Client) doNoCache(
+	ctx context.Context,
+	url *liburl.URL,
+) (
+	*http.Response,
+	[]byte,
+	*v2.RateLimitDescription,
+	error,
+) {
+	// Redact as get does, should the transport log through the request.
+	ctx = logging.ToContext(ctx)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.bearerToken))
+
+	ratelimitData := &v2.RateLimitDescription{}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, nil, ratelimitData, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		// A truncated body is transient, so getNoCache retries it.
+		return nil, nil, ratelimitData, fmt.Errorf("failed to read response body: %w", err)
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	if extracted, err := ratelimit.ExtractRateLimitData(response.StatusCode, &response.Header); err == nil {
+		ratelimitData = extracted
+	}
+	return response, body, ratelimitData, nil
+}
+
+// retryDelay returns how long to wait before the next attempt. A Retry-After
+// header wins; otherwise the delay doubles per attempt up to the maximum.
+func (c *Client) retryDelay(attempt int, response *http.Response) time.Duration {
+	if response != nil {
+		if delay, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			return min(delay, config.RequestRetryMaxDelay)
+		}
+	}
+	return min(c.retryBaseDelay<<attempt, config.RequestRetryMaxDelay)
+}
+
+// parseRetryAfter accepts both forms allowed by RFC 9110: delay-seconds and
+// an HTTP-date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func isTransientStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransientError reports whether a request failed in a way worth retrying:
+// a timeout, a dropped connection or a truncated response.
+func isTransientError(err error) bool {
+	var urlErr *liburl.Error
+	if errors.As(err, &urlErr) && urlErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		// The wrapper reports timeouts and dropped connections as these.
+		return true
+	default:
+		return false
+	}
+}
+
+func statusCodeOf(response *http.Response) int {
+	if response == nil {
+		return 0
+	}
+	return response.StatusCode
+}
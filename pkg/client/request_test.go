@@ -2,13 +2,26 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/iiiatthew/baton-percipio-report/pkg/config"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
 )
 
 func TestClientGetUrl(t *testing.T) {
@@ -232,6 +245,195 @@ func TestClientGetAndPost(t *testing.T) {
 		assert.NotNil(t, rateLimit)
 		assert.Equal(t, "success", target["created"])
 	})
+
+	t.Run("should redact user IDs from the URLs the SDK logs", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"id": "michael.bolton", "firstName": "Michael"}`))
+		}))
+		defer server.Close()
+
+		require.NoError(t, logging.Configure(logging.RedactionOptions{Mode: logging.RedactDrop}))
+		t.Cleanup(func() { require.NoError(t, logging.Configure(logging.RedactionOptions{})) })
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		// Like the SDK's, the context of a sync call carries a logger that
+		// doesn't redact.
+		core, logs := observer.New(zapcore.DebugLevel)
+		syncCtx := ctxzap.ToContext(ctx, zap.New(core))
+		_, _, err = client.GetUser(syncCtx, "michael.bolton")
+		require.NoError(t, err)
+
+		urls := logs.FilterMessageSnippet("http cache").All()
+		require.NotEmpty(t, urls)
+		assert.Contains(t, urls[0].ContextMap()["url"], "/users/[redacted]")
+		for _, entry := range logs.All() {
+			assert.NotContains(t, fmt.Sprint(entry.Message, entry.ContextMap()), "michael.bolton")
+		}
+	})
+}
+
+func TestClientGetNoCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should not serve repeated requests from cache", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = fmt.Fprintf(w, `{"call": %d}`, calls)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		_, first, _, err := client.getNoCache(ctx, "/test", nil)
+		require.NoError(t, err)
+		_, second, _, err := client.getNoCache(ctx, "/test", nil)
+		require.NoError(t, err)
+
+		assert.JSONEq(t, `{"call": 1}`, string(first))
+		assert.JSONEq(t, `{"call": 2}`, string(second))
+	})
+
+	t.Run("should retry a truncated response", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			if calls == 1 {
+				// Promise more bytes than are sent, so the body ends early.
+				w.Header().Set("Content-Length", "100")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte(`{"call":`))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = fmt.Fprintf(w, `{"call": %d}`, calls)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		client.retryBaseDelay = time.Millisecond
+
+		_, body, _, err := client.getNoCache(ctx, "/test", nil)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"call": 2}`, string(body))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should return error statuses as responses", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "not found"}`))
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		response, body, _, err := client.getNoCache(ctx, "/test", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		assert.JSONEq(t, `{"message": "not found"}`, string(body))
+	})
+
+	t.Run("should keep caching requests made through the wrapper", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"call": %d}`, calls)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+
+		var target map[string]int
+		_, _, err = client.get(ctx, "/test", nil, &target)
+		require.NoError(t, err)
+		_, _, err = client.get(ctx, "/test", nil, &target)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"call": 1}, target)
+
+		_, body, _, err := client.getNoCache(ctx, "/test", nil)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"call": 2}`, string(body))
+	})
+
+	t.Run("should give up after the retry maximum", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		client, err := New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		client.retryBaseDelay = time.Millisecond
+
+		response, _, _, err := client.getNoCache(ctx, "/test", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadGateway, response.StatusCode)
+		assert.Equal(t, config.RequestRetryMaximum+1, calls)
+	})
+}
+
+func TestIsTransientError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "timeout", err: &url.Error{Op: "Get", URL: "http://test", Err: timeoutError{}}, expected: true},
+		{name: "connection reset", err: &url.Error{Op: "Get", URL: "http://test", Err: syscall.ECONNRESET}, expected: true},
+		{name: "unexpected eof", err: fmt.Errorf("failed to read response body: %w", io.ErrUnexpectedEOF), expected: true},
+		{name: "wrapped unavailable status", err: uhttp.WrapErrors(codes.Unavailable, "connection reset", syscall.ECONNRESET), expected: true},
+		{name: "connection refused", err: &url.Error{Op: "Get", URL: "http://test", Err: syscall.ECONNREFUSED}, expected: false},
+		{name: "other", err: errors.New("boom"), expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isTransientError(tc.err))
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+func TestParseRetryAfter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "empty", value: "", ok: false},
+		{name: "seconds", value: "7", expected: 7 * time.Second, ok: true},
+		{name: "http date in the past", value: "Wed, 21 Oct 2015 07:28:00 GMT", expected: 0, ok: true},
+		{name: "garbage", value: "soon", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delay, ok := parseRetryAfter(tc.value)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, delay)
+		})
+	}
 }
 
 // Helper function for tests
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// StatusObservation is a status a user had on a course, as of a date. At is
+// the completion date for completions and the latest activity otherwise; it
+// is zero when the report row has no usable date. Current marks the status
+// StatusesStore holds for the user.
+type StatusObservation struct {
+	Status  string    `json:"status"`
+	At      time.Time `json:"at,omitempty"`
+	Current bool      `json:"current,omitempty"`
+}
+
+// StatusHistory keeps every status observation per course and user, where
+// StatusesStore only keeps the last one. A user who completed a course and
+// later restarted it is in_progress in StatusesStore, but still has the
+// completion here. Observations are ordered oldest first; undated ones come
+// before dated ones, and rows with the same date keep report order. The same
+// status on the same date is only kept once, so reports that overlap can be
+// loaded into the same history.
+type StatusHistory map[string]map[string][]StatusObservation
+
+// Load adds an observation for every row of the report that the history
+// doesn't have yet. The report's last row for each course and user becomes
+// their current status, as in StatusesStore; observations from earlier
+// reports are no longer current.
+func (h StatusHistory) Load(ctx context.Context, report *Report) error {
+	logger := logging.Extract(ctx)
+	startTime := time.Now()
+
+	for _, users := range h {
+		for _, history := range users {
+			for i := range history {
+				history[i].Current = false
+			}
+		}
+	}
+
+	added := 0
+	current := make(map[[2]string]StatusObservation)
+	for i := range *report {
+		row := &(*report)[i]
+		status := toStatus(row.Status)
+		at := row.LatestActivity()
+		if status == "completed" {
+			if completedAt, err := row.CompletedAt(); err == nil && !completedAt.IsZero() {
+				at = completedAt
+			}
+		}
+
+		users, ok := h[row.ContentId]
+		if !ok {
+			users = make(map[string][]StatusObservation)
+			h[row.ContentId] = users
+		}
+		observation := StatusObservation{Status: status, At: at}
+		if observationIndex(users[row.UserId], observation) < 0 {
+			users[row.UserId] = append(users[row.UserId], observation)
+			added++
+		}
+		current[[2]string{row.ContentId, row.UserId}] = observation
+	}
+
+	for key, observation := range current {
+		history := h[key[0]][key[1]]
+		history[observationIndex(history, observation)].Current = true
+	}
+
+	for _, users := range h {
+		for _, history := range users {
+			sortObservations(history)
+		}
+	}
+
+	logger.Info("Status history loaded successfully",
+		zap.Int("observations", len(*report)),
+		zap.Int("new_observations", added),
+		zap.Int("unique_courses", len(h)),
+		zap.Duration("duration", time.Since(startTime)))
+
+	return nil
+}
+
+func sortObservations(history []StatusObservation) {
+	slices.SortStableFunc(history, func(a, b StatusObservation) int {
+		return a.At.Compare(b.At)
+	})
+}
+
+// observationIndex returns the index of the observation with the same status
+// and date in history, or -1.
+func observationIndex(history []StatusObservation, observation StatusObservation) int {
+	return slices.IndexFunc(history, func(o StatusObservation) bool {
+		return o.Status == observation.Status && o.At.Equal(observation.At)
+	})
+}
+
+// Observations returns a user's observations on a course, oldest first.
+func (h StatusHistory) Observations(courseId string, userId string) []StatusObservation {
+	return h[courseId][userId]
+}
+
+// Current returns a user's status on a course in the last report loaded,
+// which is the one StatusesStore holds. It returns false if the last report
+// has no status for them.
+func (h StatusHistory) Current(courseId string, userId string) (string, bool) {
+	for _, observation := range h[courseId][userId] {
+		if observation.Current {
+			return observation.Status, true
+		}
+	}
+	return "", false
+}
+
+// EverCompleted reports whether a user has ever completed a course.
+func (h StatusHistory) EverCompleted(courseId string, userId string) bool {
+	_, ok := h.LastCompleted(courseId, userId)
+	return ok
+}
+
+// CompletedSince reports whether a user completed a course at or after
+// since. Completions without a date don't count.
+func (h StatusHistory) CompletedSince(courseId string, userId string, since time.Time) bool {
+	completedAt, ok := h.LastCompleted(courseId, userId)
+	return ok && !completedAt.IsZero() && !completedAt.Before(since)
+}
+
+// LastCompleted returns when a user last completed a course, which is zero
+// when the completion has no date. It returns false if they never did.
+func (h StatusHistory) LastCompleted(courseId string, userId string) (time.Time, bool) {
+	history := h[courseId][userId]
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Status == "completed" {
+			return history[i].At, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Completions returns how many times a user completed a course.
+func (h StatusHistory) Completions(courseId string, userId string) int {
+	completions := 0
+	for _, observation := range h[courseId][userId] {
+		if observation.Status == "completed" {
+			completions++
+		}
+	}
+	return completions
+}
+
+// Merge moves the observations of users to the users they were merged into,
+// given as a mapping of merged user ID to surviving user ID. When both users
+// have a current status, the more advanced one stays current, as in
+// StatusesStore.Merge. It returns how many observations were moved.
+func (h StatusHistory) Merge(survivors map[string]string) int {
+	moved := 0
+	for _, users := range h {
+		for userId, survivor := range survivors {
+			history, ok := users[userId]
+			if !ok {
+				continue
+			}
+			delete(users, userId)
+			merged := users[survivor]
+			current := slices.IndexFunc(merged, func(o StatusObservation) bool { return o.Current })
+			for _, observation := range history {
+				isCurrent := observation.Current
+				observation.Current = false
+				i := observationIndex(merged, observation)
+				if i < 0 {
+					merged = append(merged, observation)
+					i = len(merged) - 1
+				}
+				if !isCurrent {
+					continue
+				}
+				if current < 0 || statusRank(observation.Status) > statusRank(merged[current].Status) {
+					if current >= 0 {
+						merged[current].Current = false
+					}
+					merged[i].Current = true
+					current = i
+				}
+			}
+			sortObservations(merged)
+			users[survivor] = merged
+			moved += len(history)
+		}
+	}
+	return moved
+}
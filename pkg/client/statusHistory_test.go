@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// historyReport has Michael completing course1 in 2021 and restarting it in
+// 2024, and Milton, who never completed it.
+func historyReport() *Report {
+	return &Report{
+		{
+			UserId:     "michael.bolton@initech.com",
+			ContentId:  "course1",
+			Status:     "Started",
+			LastAccess: "2024-03-01T00:00:00Z",
+		},
+		{
+			UserId:        "michael.bolton@initech.com",
+			ContentId:     "course1",
+			Status:        "Completed",
+			CompletedDate: "2021-05-10T00:00:00Z",
+			LastAccess:    "2021-06-01T00:00:00Z",
+		},
+		{
+			UserId:    "milton.waddams@initech.com",
+			ContentId: "course1",
+			Status:    "Started",
+		},
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	ctx := context.Background()
+	history := make(StatusHistory)
+	require.NoError(t, history.Load(ctx, historyReport()))
+
+	t.Run("should keep every observation in date order", func(t *testing.T) {
+		assert.Equal(t, []StatusObservation{
+			{Status: "completed", At: time.Date(2021, 5, 10, 0, 0, 0, 0, time.UTC), Current: true},
+			{Status: "in_progress", At: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		}, history.Observations("course1", "michael.bolton@initech.com"))
+	})
+
+	t.Run("should answer status queries", func(t *testing.T) {
+		// The current status is the report's last row, as in StatusesStore.
+		current, ok := history.Current("course1", "michael.bolton@initech.com")
+		require.True(t, ok)
+		assert.Equal(t, "completed", current)
+		assert.True(t, history.EverCompleted("course1", "michael.bolton@initech.com"))
+		assert.True(t, history.CompletedSince("course1", "michael.bolton@initech.com", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.False(t, history.CompletedSince("course1", "michael.bolton@initech.com", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.Equal(t, 1, history.Completions("course1", "michael.bolton@initech.com"))
+
+		assert.False(t, history.EverCompleted("course1", "milton.waddams@initech.com"))
+		_, ok = history.Current("course2", "milton.waddams@initech.com")
+		assert.False(t, ok)
+	})
+
+	t.Run("should merge observations into the surviving user", func(t *testing.T) {
+		history := make(StatusHistory)
+		require.NoError(t, history.Load(ctx, historyReport()))
+
+		moved := history.Merge(map[string]string{"michael.bolton@initech.com": "milton.waddams@initech.com"})
+		assert.Equal(t, 2, moved)
+		assert.Nil(t, history.Observations("course1", "michael.bolton@initech.com"))
+		observations := history.Observations("course1", "milton.waddams@initech.com")
+		require.Len(t, observations, 3)
+		// Milton's undated observation sorts first.
+		assert.True(t, observations[0].At.IsZero())
+		assert.True(t, history.EverCompleted("course1", "milton.waddams@initech.com"))
+		// Michael's completion is more advanced than Milton's start.
+		current, ok := history.Current("course1", "milton.waddams@initech.com")
+		require.True(t, ok)
+		assert.Equal(t, "completed", current)
+	})
+
+	t.Run("should add later reports without repeating observations", func(t *testing.T) {
+		history := make(StatusHistory)
+		require.NoError(t, history.Load(ctx, historyReport()))
+		require.NoError(t, history.Load(ctx, &Report{
+			{
+				UserId:        "michael.bolton@initech.com",
+				ContentId:     "course1",
+				Status:        "Completed",
+				CompletedDate: "2021-05-10T00:00:00Z",
+			},
+			{
+				UserId:        "michael.bolton@initech.com",
+				ContentId:     "course1",
+				Status:        "Completed",
+				CompletedDate: "2024-09-01T00:00:00Z",
+			},
+		}))
+
+		assert.Equal(t, 2, history.Completions("course1", "michael.bolton@initech.com"))
+		require.Len(t, history.Observations("course1", "michael.bolton@initech.com"), 3)
+		current, ok := history.Current("course1", "michael.bolton@initech.com")
+		require.True(t, ok)
+		assert.Equal(t, "completed", current)
+		lastCompleted, _ := history.LastCompleted("course1", "michael.bolton@initech.com")
+		assert.Equal(t, time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC), lastCompleted)
+
+		// Milton isn't in the later report, so he has no current status.
+		assert.Len(t, history.Observations("course1", "milton.waddams@initech.com"), 1)
+		_, ok = history.Current("course1", "milton.waddams@initech.com")
+		assert.False(t, ok)
+	})
+}
+
+func TestClientStatusHistory(t *testing.T) {
+	ctx := context.Background()
+	client, err := New(ctx, "https://api.example.com", "test-org", "test-token")
+	require.NoError(t, err)
+
+	require.NoError(t, client.LoadReport(ctx, historyReport()))
+	assert.Nil(t, client.StatusHistory)
+
+	client.KeepStatusHistory = true
+	require.NoError(t, client.LoadReport(ctx, historyReport()))
+	assert.True(t, client.StatusHistory.EverCompleted("course1", "michael.bolton@initech.com"))
+	// The statuses store still has the last status in the report.
+	assert.Equal(t, "in_progress", getStatuses(t, client.StatusesStore, "course1")["milton.waddams@initech.com"])
+
+	// Reports loaded later add to the history.
+	require.NoError(t, client.LoadReport(ctx, &Report{{UserId: "milton.waddams@initech.com", ContentId: "course2", Status: "Completed"}}))
+	assert.True(t, client.StatusHistory.EverCompleted("course1", "michael.bolton@initech.com"))
+	assert.True(t, client.StatusHistory.EverCompleted("course2", "milton.waddams@initech.com"))
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/conductorone/baton-sdk/pkg/field"
 )
 
@@ -10,6 +12,12 @@ const (
 	// // For Testing Only
 	// RetryAttemptsMaximum = 1800
 	// RetryAfterSeconds    = 1
+
+	// Transient failures (429, 5xx, timeouts) on individual requests are
+	// retried with exponential backoff, unless the server sends Retry-After.
+	RequestRetryMaximum   = 5
+	RequestRetryBaseDelay = 2 * time.Second
+	RequestRetryMaxDelay  = 2 * time.Minute
 )
 
 var (
@@ -34,6 +42,171 @@ var (
 		field.WithShortHand("y"),
 		field.WithDefaultValue(10),
 	)
+	StateDirField = field.StringField(
+		"state-dir",
+		field.WithDescription("Directory where the connector keeps state between syncs, such as guardrail baselines. Features that need it are disabled when unset"),
+	)
+	StateEncryptionRecipientsField = field.StringSliceField(
+		"state-encryption-recipients",
+		field.WithDescription("Additional age recipients (age1...) to encrypt state files to, e.g. a recovery key. Requires --state-encryption-identity-file"),
+	)
+	StateEncryptionIdentityFileField = field.StringField(
+		"state-encryption-identity-file",
+		field.WithDescription("File holding the age identity (AGE-SECRET-KEY-1...) state files are encrypted to and decrypted with"),
+	)
+	StateEncryptionPassphraseField = field.StringField(
+		"state-encryption-passphrase",
+		field.WithDescription("Passphrase to encrypt state files with, instead of an age identity"),
+		field.WithIsSecret(true),
+	)
+	StateEncryptionRequiredField = field.BoolField(
+		"state-encryption-required",
+		field.WithDescription("Refuse to read state files that are not encrypted (requires --state-encryption-identity-file or --state-encryption-passphrase)"),
+	)
+	MinReportRowsField = field.IntField(
+		"min-report-rows",
+		field.WithDescription("Refuse to sync when the learning activity report has fewer rows than this (0 disables)"),
+	)
+	MaxUserDropPercentField = field.IntField(
+		"max-user-drop-percent",
+		field.WithDescription("Refuse to sync when unique users drop by more than this percentage since the last successful sync (0 disables, requires --state-dir)"),
+	)
+	MaxCourseDropPercentField = field.IntField(
+		"max-course-drop-percent",
+		field.WithDescription("Refuse to sync when unique courses drop by more than this percentage since the last successful sync (0 disables, requires --state-dir)"),
+	)
+	MaxCompletionDropPercentField = field.IntField(
+		"max-completion-drop-percent",
+		field.WithDescription("Refuse to sync when completed grants drop by more than this percentage since the last successful sync (0 disables, requires --state-dir)"),
+	)
+	ReportFallbackMaxAgeHoursField = field.IntField(
+		"report-fallback-max-age-hours",
+		field.WithDescription("When a fresh report can't be generated, serve the last good report if it is at most this many hours old (0 disables, requires --state-dir)"),
+	)
+	PageSizeField = field.IntField(
+		"page-size",
+		field.WithDescription("How many users, courses or grants to return per page"),
+		field.WithDefaultValue(1000),
+	)
+	CatalogEnrichmentField = field.BoolField(
+		"catalog-enrichment",
+		field.WithDescription("Enrich courses with descriptions, durations, retirement status and localized titles from the Content Discovery catalog"),
+	)
+	CatalogPublishInactiveField = field.BoolField(
+		"catalog-publish-inactive",
+		field.WithDescription("Also publish catalog courses that have no learning activity (requires --catalog-enrichment)"),
+	)
+	CatalogCacheHoursField = field.IntField(
+		"catalog-cache-hours",
+		field.WithDescription("How many hours a fetched catalog is reused before it is fetched again"),
+		field.WithDefaultValue(24),
+	)
+	UserProfileAttributesField = field.StringSliceField(
+		"user-profile-attributes",
+		field.WithDescription("Report columns to copy into user profiles, as column=profile_key or just column, e.g. department,employeeId=employee_id"),
+	)
+	UserIdFieldField = field.StringField(
+		"user-id-field",
+		field.WithDescription("Report column used as the user resource ID, e.g. a custom employee ID column"),
+		field.WithDefaultValue("userId"),
+	)
+	UserLoginFieldField = field.StringField(
+		"user-login-field",
+		field.WithDescription("Report column used as the user login for account linking"),
+	)
+	UserEmailFieldsField = field.StringSliceField(
+		"user-email-fields",
+		field.WithDescription("Report columns holding user email addresses, primary first (default: emailAddress)"),
+	)
+	UserEmployeeIdFieldsField = field.StringSliceField(
+		"user-employee-id-fields",
+		field.WithDescription("Report columns holding user employee IDs for account linking"),
+	)
+	MissingUserIdPolicyField = field.SelectField(
+		"missing-user-id-policy",
+		[]string{"skip", "quarantine", "synthesize"},
+		field.WithDescription("What to do with users whose --user-id-field is empty: skip them, quarantine them (skip and record them in --state-dir) or synthesize an ID from their Percipio user ID"),
+		field.WithDefaultValue("skip"),
+	)
+	DormantAfterDaysField = field.IntField(
+		"dormant-after-days",
+		field.WithDescription("Flag users with no learning activity in this many days as dormant (0 disables)"),
+	)
+	GroupByField = field.StringField(
+		"group-by",
+		field.WithDescription("Report column to publish user groups from, such as a department, cost center or audience column"),
+	)
+	GroupBySeparatorField = field.StringField(
+		"group-by-separator",
+		field.WithDescription("Separator splitting a --group-by column that holds several groups, e.g. ;"),
+	)
+	RolesField = field.BoolField(
+		"roles",
+		field.WithDescription("Publish the roles users hold in Percipio user management (admin, manager, curator, learner, ...) as role resources"),
+	)
+	AssessmentPassScoreField = field.IntField(
+		"assessment-pass-score",
+		field.WithDescription("Score an assessment attempt needs to be granted passed, when the report gives no pass threshold for the assessment"),
+		field.WithDefaultValue(80),
+	)
+	AssessmentAttemptField = field.SelectField(
+		"assessment-attempt",
+		[]string{"best", "latest"},
+		field.WithDescription("Which attempt grades an assessment and is attached to its passed or failed grant: the best or the latest"),
+		field.WithDefaultValue("best"),
+	)
+	AssignmentsField = field.BoolField(
+		"assignments",
+		field.WithDescription("Grant the assigned and overdue course entitlements from the content assigned to learners in Percipio"),
+	)
+	CourseEntitlementsField = field.StringSliceField(
+		"course-entitlements",
+		field.WithDescription("Entitlements to publish on every course, e.g. completed,in_progress (default: only those granted on each course)"),
+	)
+	EntitlementDisplayNameTemplateField = field.StringField(
+		"entitlement-display-name-template",
+		field.WithDescription("Template for course entitlement display names, using {{.Course}}, {{.CourseId}}, {{.Entitlement}} and {{.Description}}"),
+		field.WithDefaultValue("Course {{.Course}} {{.Entitlement}}"),
+	)
+	EntitlementDescriptionTemplateField = field.StringField(
+		"entitlement-description-template",
+		field.WithDescription("Template for course entitlement descriptions, using the same fields as --entitlement-display-name-template"),
+		field.WithDefaultValue("{{.Description}}"),
+	)
+	EverCompletedField = field.BoolField(
+		"ever-completed",
+		field.WithDescription("Keep every status users had on a course and grant ever_completed to users who completed it at any point, even if they have since restarted it"),
+	)
+	StatusStoreField = field.SelectField(
+		"status-store",
+		[]string{"auto", "memory", "disk"},
+		field.WithDescription("Where course statuses are kept during a sync: in memory, on disk in a temporary database, or auto (on disk for reports larger than --status-store-disk-rows). The disk store isn't encrypted, so state encryption keeps statuses in memory"),
+		field.WithDefaultValue("auto"),
+	)
+	StatusStoreDiskRowsField = field.IntField(
+		"status-store-disk-rows",
+		field.WithDescription("Report rows above which --status-store auto keeps course statuses on disk"),
+		field.WithDefaultValue(5000000),
+	)
+	StatusStoreDirField = field.StringField(
+		"status-store-dir",
+		field.WithDescription("Directory the on-disk status store is created in (default: the OS temporary directory)"),
+	)
+	LogRedactionField = field.SelectField(
+		"log-redaction",
+		[]string{"off", "hash", "drop"},
+		field.WithDescription("Keep personal data such as user IDs and emails out of the connector's logs: off, hash (a keyed hash, so values can still be correlated) or drop"),
+		field.WithDefaultValue("off"),
+	)
+	LogRedactionKeyField = field.StringField(
+		"log-redaction-key",
+		field.WithDescription("Key for --log-redaction hash, so hashes match across runs (default: a random key per run)"),
+		field.WithIsSecret(true),
+	)
+	MergeUsersByField = field.StringSliceField(
+		"merge-users-by",
+		field.WithDescription("Merge Percipio users that are the same person because they share a value, ignoring case, of any of these: email (any of --user-email-fields) or a report column"),
+	)
 
 	// ConfigurationFields defines the external configuration required for the
 	// connector to run. Note: these fields can be marked as optional or
@@ -43,6 +216,43 @@ var (
 		OrganizationIdField,
 		LookbackDaysField,
 		LookbackYearsField,
+		StateDirField,
+		StateEncryptionRecipientsField,
+		StateEncryptionIdentityFileField,
+		StateEncryptionPassphraseField,
+		StateEncryptionRequiredField,
+		MinReportRowsField,
+		MaxUserDropPercentField,
+		MaxCourseDropPercentField,
+		MaxCompletionDropPercentField,
+		ReportFallbackMaxAgeHoursField,
+		PageSizeField,
+		CatalogEnrichmentField,
+		CatalogPublishInactiveField,
+		CatalogCacheHoursField,
+		UserProfileAttributesField,
+		UserIdFieldField,
+		UserLoginFieldField,
+		UserEmailFieldsField,
+		UserEmployeeIdFieldsField,
+		MissingUserIdPolicyField,
+		MergeUsersByField,
+		DormantAfterDaysField,
+		GroupByField,
+		GroupBySeparatorField,
+		RolesField,
+		AssessmentPassScoreField,
+		AssessmentAttemptField,
+		AssignmentsField,
+		CourseEntitlementsField,
+		EntitlementDisplayNameTemplateField,
+		EntitlementDescriptionTemplateField,
+		EverCompletedField,
+		StatusStoreField,
+		StatusStoreDiskRowsField,
+		StatusStoreDirField,
+		LogRedactionField,
+		LogRedactionKeyField,
 	}
 
 	// FieldRelationships defines relationships between the fields listed in
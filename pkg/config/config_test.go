@@ -58,6 +58,159 @@ func TestConfigs(t *testing.T) {
 			true,
 			"valid with custom lookback years",
 		},
+		{
+			map[string]string{
+				"api-token":             "1",
+				"organization-id":       "1",
+				"state-dir":             "/var/lib/baton-percipio-report",
+				"min-report-rows":       "100",
+				"max-user-drop-percent": "25",
+			},
+			true,
+			"valid with guardrails",
+		},
+		{
+			map[string]string{
+				"api-token":                "1",
+				"organization-id":          "1",
+				"catalog-enrichment":       "true",
+				"catalog-publish-inactive": "true",
+				"catalog-cache-hours":      "12",
+			},
+			true,
+			"valid with catalog enrichment",
+		},
+		{
+			map[string]string{
+				"api-token":               "1",
+				"organization-id":         "1",
+				"user-profile-attributes": "department,employeeId=employee_id",
+			},
+			true,
+			"valid with user profile attributes",
+		},
+		{
+			map[string]string{
+				"api-token":               "1",
+				"organization-id":         "1",
+				"user-id-field":           "employeeId",
+				"user-login-field":        "login",
+				"user-email-fields":       "emailAddress,personalEmail",
+				"user-employee-id-fields": "employeeId",
+				"missing-user-id-policy":  "quarantine",
+			},
+			true,
+			"valid with user identity fields",
+		},
+		{
+			map[string]string{
+				"api-token":       "1",
+				"organization-id": "1",
+				"merge-users-by":  "email,employeeId",
+			},
+			true,
+			"valid with user merging",
+		},
+		{
+			map[string]string{
+				"api-token":          "1",
+				"organization-id":    "1",
+				"dormant-after-days": "90",
+			},
+			true,
+			"valid with dormancy window",
+		},
+		{
+			map[string]string{
+				"api-token":          "1",
+				"organization-id":    "1",
+				"group-by":           "audiences",
+				"group-by-separator": ";",
+			},
+			true,
+			"valid with groups",
+		},
+		{
+			map[string]string{
+				"api-token":       "1",
+				"organization-id": "1",
+				"roles":           "true",
+			},
+			true,
+			"valid with roles",
+		},
+		{
+			map[string]string{
+				"api-token":             "1",
+				"organization-id":       "1",
+				"assessment-pass-score": "70",
+				"assessment-attempt":    "latest",
+			},
+			true,
+			"valid with assessment grading",
+		},
+		{
+			map[string]string{
+				"api-token":       "1",
+				"organization-id": "1",
+				"assignments":     "true",
+			},
+			true,
+			"valid with assignments",
+		},
+		{
+			map[string]string{
+				"api-token":                         "1",
+				"organization-id":                   "1",
+				"course-entitlements":               "completed,in_progress",
+				"entitlement-display-name-template": "{{.Course}}: {{.Entitlement}}",
+				"entitlement-description-template":  "{{.Description}}",
+			},
+			true,
+			"valid with course entitlements",
+		},
+		{
+			map[string]string{
+				"api-token":       "1",
+				"organization-id": "1",
+				"ever-completed":  "true",
+			},
+			true,
+			"valid with ever completed",
+		},
+		{
+			map[string]string{
+				"api-token":              "1",
+				"organization-id":        "1",
+				"status-store":           "disk",
+				"status-store-disk-rows": "1000",
+				"status-store-dir":       "/tmp",
+			},
+			true,
+			"valid with status store",
+		},
+		{
+			map[string]string{
+				"api-token":                      "1",
+				"organization-id":                "1",
+				"state-dir":                      "/tmp/state",
+				"state-encryption-identity-file": "/tmp/key.txt",
+				"state-encryption-recipients":    "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p",
+				"state-encryption-required":      "true",
+			},
+			true,
+			"valid with state encryption",
+		},
+		{
+			map[string]string{
+				"api-token":         "1",
+				"organization-id":   "1",
+				"log-redaction":     "hash",
+				"log-redaction-key": "pepper",
+			},
+			true,
+			"valid with log redaction",
+		},
 	}
 
 	test.ExerciseTestCases(t, configurationSchema, nil, testCases)
@@ -0,0 +1,161 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+)
+
+const (
+	passedEntitlement = "passed"
+	failedEntitlement = "failed"
+
+	// defaultPassScore is the pass score for assessments when neither the
+	// report nor the configuration gives one.
+	defaultPassScore = 80
+)
+
+// AssessmentOptions controls how assessment scores become passed and failed
+// grants.
+type AssessmentOptions struct {
+	// PassScore is the score needed to pass an assessment the report gives
+	// no pass threshold for. Zero means defaultPassScore.
+	PassScore float64
+	// Attempt is the attempt a learner is scored by, client.AttemptBest or
+	// client.AttemptLatest. Empty means the best attempt.
+	Attempt string
+}
+
+// passScore returns the configured pass score.
+func (o AssessmentOptions) passScore() float64 {
+	if o.PassScore <= 0 {
+		return defaultPassScore
+	}
+	return o.PassScore
+}
+
+// attempt returns the configured attempt.
+func (o AssessmentOptions) attempt() string {
+	if o.Attempt == "" {
+		return client.AttemptBest
+	}
+	return o.Attempt
+}
+
+// validate checks the assessment configuration.
+func (o AssessmentOptions) validate() error {
+	if o.Attempt != "" && !slices.Contains(client.Attempts, o.Attempt) {
+		return fmt.Errorf("invalid assessment attempt %q: expected one of %v", o.Attempt, client.Attempts)
+	}
+	if o.PassScore < 0 {
+		return fmt.Errorf("invalid assessment pass score %v: must not be negative", o.PassScore)
+	}
+	return nil
+}
+
+// assessmentResults maps course IDs to Percipio user IDs to the score they
+// are graded by.
+type assessmentResults map[string]map[string]client.AssessmentResult
+
+// buildAssessmentIndex picks each learner's result per assessment from the
+// report rows that have a score. A learner with several rows for the same
+// assessment is scored by the best of them, or by the one with the latest
+// activity.
+func buildAssessmentIndex(report *client.Report, options AssessmentOptions) assessmentResults {
+	if report == nil {
+		return nil
+	}
+
+	attempt := options.attempt()
+	results := make(assessmentResults)
+	activity := make(map[[2]string]time.Time)
+	for i := range *report {
+		entry := &(*report)[i]
+		if entry.ContentId == "" || entry.UserId == "" {
+			continue
+		}
+		result, ok := entry.AssessmentResult(attempt)
+		if !ok {
+			continue
+		}
+
+		key := [2]string{entry.ContentId, entry.UserId}
+		latest := entry.LatestActivity()
+		if results[entry.ContentId] == nil {
+			results[entry.ContentId] = make(map[string]client.AssessmentResult)
+		}
+		if previous, seen := results[entry.ContentId][entry.UserId]; seen {
+			// Rows count attempts up to their own, so the most any row
+			// reports is the learner's total.
+			attempts := max(result.Attempts, previous.Attempts)
+			if (attempt == client.AttemptLatest && latest.Before(activity[key])) ||
+				(attempt == client.AttemptBest && result.Score < previous.Score) {
+				result, latest = previous, activity[key]
+			}
+			result.Attempts = attempts
+		}
+		results[entry.ContentId][entry.UserId] = result
+		activity[key] = latest
+	}
+	return results
+}
+
+// assessmentOptions returns the assessment configuration.
+func (d *Connector) assessmentOptions() AssessmentOptions {
+	if d == nil {
+		return AssessmentOptions{}
+	}
+	return d.assessments
+}
+
+// assessmentResults returns the results for a course. It returns nil when no
+// report is loaded or the course has no scores.
+func (d *Connector) assessmentResults(ctx context.Context, courseId string) map[string]client.AssessmentResult {
+	if d == nil || !d.reportLoaded() {
+		return nil
+	}
+	return d.index(ctx).assessments[courseId]
+}
+
+// isAssessment reports whether a course is graded, because it is an
+// assessment or has scores in the report.
+func (d *Connector) isAssessment(ctx context.Context, courseId string) bool {
+	if d == nil || !d.reportLoaded() {
+		return false
+	}
+	index := d.index(ctx)
+	if _, ok := index.assessments[courseId]; ok {
+		return true
+	}
+	course, ok := index.course(courseId)
+	return ok && (&client.ReportEntry{ContentType: course.ContentType}).IsAssessment()
+}
+
+// assessmentGrant returns the passed or failed grant for a result, with the
+// score it was graded by attached.
+func (o AssessmentOptions) assessmentGrant(resource *v2.Resource, principalId *v2.ResourceId, result client.AssessmentResult) (*v2.Grant, string) {
+	outcome := failedEntitlement
+	if result.Passed(o.passScore()) {
+		outcome = passedEntitlement
+	}
+	passScore := result.PassingScore
+	if passScore <= 0 {
+		passScore = o.passScore()
+	}
+
+	metadata := map[string]interface{}{
+		"score":      result.Score,
+		"pass_score": passScore,
+		"attempt":    result.Attempt,
+	}
+	if result.Attempts > 0 {
+		metadata["attempts"] = result.Attempts
+	}
+	return grant.NewGrant(resource, outcome, principalId, grant.WithGrantMetadata(metadata)), outcome
+}
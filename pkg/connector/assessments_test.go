@@ -0,0 +1,144 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assessmentReport has Michael, who passed on his second try and only has
+// latest scores, Milton, who failed against the report's own threshold, and
+// a course without scores.
+func assessmentReport() *client.Report {
+	return &client.Report{
+		{
+			UserId:      "michael.bolton@initech.com",
+			ContentId:   "assessment1",
+			ContentType: "Assessment",
+			Status:      "Started",
+			LastScore:   "60",
+			Attempts:    "1",
+			LastAccess:  "2025-06-01T00:00:00.000Z",
+		},
+		{
+			UserId:        "michael.bolton@initech.com",
+			ContentId:     "assessment1",
+			ContentType:   "Assessment",
+			Status:        "Completed",
+			LastScore:     "85",
+			Attempts:      "2",
+			CompletedDate: "2025-06-20T00:00:00.000Z",
+		},
+		{
+			UserId:       "milton.waddams@initech.com",
+			ContentId:    "assessment1",
+			ContentType:  "Assessment",
+			Status:       "Completed",
+			HighScore:    "85",
+			PassingScore: "90",
+		},
+		{
+			UserId:      "peter.gibbons@initech.com",
+			ContentId:   "assessment1",
+			ContentType: "Assessment",
+			Status:      "Started",
+		},
+		{
+			UserId:    "peter.gibbons@initech.com",
+			ContentId: "course1",
+			Status:    "Completed",
+		},
+	}
+}
+
+func TestBuildAssessmentIndex(t *testing.T) {
+	t.Run("should score learners by their best attempt", func(t *testing.T) {
+		results := buildAssessmentIndex(assessmentReport(), AssessmentOptions{})
+		assert.Equal(t, assessmentResults{
+			"assessment1": {
+				"michael.bolton@initech.com": {Attempt: client.AttemptLatest, Score: 85, Attempts: 2},
+				"milton.waddams@initech.com": {Attempt: client.AttemptBest, Score: 85, PassingScore: 90},
+			},
+		}, results)
+	})
+
+	t.Run("should score learners by their latest attempt", func(t *testing.T) {
+		report := assessmentReport()
+		(*report)[0].LastAccess = "2025-07-01T00:00:00.000Z"
+
+		results := buildAssessmentIndex(report, AssessmentOptions{Attempt: client.AttemptLatest})
+		assert.Equal(t, client.AssessmentResult{Attempt: client.AttemptLatest, Score: 60, Attempts: 2},
+			results["assessment1"]["michael.bolton@initech.com"])
+	})
+}
+
+func TestAssessmentOptions(t *testing.T) {
+	assert.NoError(t, AssessmentOptions{}.validate())
+	assert.NoError(t, AssessmentOptions{PassScore: 70, Attempt: client.AttemptLatest}.validate())
+	assert.Error(t, AssessmentOptions{Attempt: "first"}.validate())
+	assert.Error(t, AssessmentOptions{PassScore: -1}.validate())
+	assert.Equal(t, float64(defaultPassScore), AssessmentOptions{}.passScore())
+}
+
+func TestAssessmentEntitlementsAndGrants(t *testing.T) {
+	ctx := context.Background()
+	assessment := &v2.Resource{
+		DisplayName: "Data Privacy (Assessment)",
+		Id:          &v2.ResourceId{ResourceType: "course", Resource: "assessment1"},
+	}
+
+	t.Run("should add passed and failed entitlements to graded assessments", func(t *testing.T) {
+		connector := newLoadedConnector(t, "https://api.example.com", assessmentReport(), WithAssessments(AssessmentOptions{}))
+		c := newCourseBuilder(connector.client, connector.report, connector)
+
+		entitlements, _, _, err := c.Entitlements(ctx, assessment, &pagination.Token{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{completedEntitlement, inProgressEntitlement, passedEntitlement, failedEntitlement}, entitlementSlugs(entitlements))
+
+		course := &v2.Resource{DisplayName: "Course", Id: &v2.ResourceId{ResourceType: "course", Resource: "course1"}}
+		entitlements, _, _, err = c.Entitlements(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{completedEntitlement}, entitlementSlugs(entitlements))
+	})
+
+	t.Run("should grant passed or failed with the score attached", func(t *testing.T) {
+		connector := newLoadedConnector(t, "https://api.example.com", assessmentReport(), WithAssessments(AssessmentOptions{PassScore: 80}))
+		c := newCourseBuilder(connector.client, connector.report, connector)
+
+		grants, _, _, err := c.Grants(ctx, assessment, &pagination.Token{})
+		require.NoError(t, err)
+
+		outcomes := make(map[string]*v2.Grant)
+		for _, g := range grants {
+			if g.Entitlement.Id == "course:assessment1:passed" || g.Entitlement.Id == "course:assessment1:failed" {
+				outcomes[g.Principal.Id.Resource] = g
+			}
+		}
+		require.Len(t, outcomes, 2)
+		assert.Len(t, grants, 5)
+
+		michael := outcomes["michael.bolton@initech.com"]
+		assert.Equal(t, "course:assessment1:passed", michael.Entitlement.Id)
+		metadata := &v2.GrantMetadata{}
+		annos := annotations.Annotations(michael.Annotations)
+		ok, err := annos.Pick(metadata)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, map[string]interface{}{
+			"score":      float64(85),
+			"pass_score": float64(80),
+			"attempt":    client.AttemptLatest,
+			"attempts":   float64(2),
+		}, metadata.Metadata.AsMap())
+
+		milton := outcomes["milton.waddams@initech.com"]
+		assert.Equal(t, "course:assessment1:failed", milton.Entitlement.Id)
+	})
+}
@@ -0,0 +1,270 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"go.uber.org/zap"
+)
+
+const (
+	overdueEntitlement         = "overdue"
+	defaultAssignmentsPageSize = 1000
+	assignmentsStateKey        = "assignments"
+)
+
+// assignmentDirectory is the assignment data fetched for a sync.
+type assignmentDirectory struct {
+	fetchedAt   time.Time
+	assignments []client.Assignment
+}
+
+// courseAssignments maps course IDs to Percipio user IDs to the assignment
+// they are due by.
+type courseAssignments map[string]map[string]client.Assignment
+
+// loadAssignments fetches the content assigned to learners from the Content
+// Assignment service. When the fetch fails, the last good assignments are
+// used if the report fallback allows it; otherwise the sync fails, since
+// publishing courses without assignments would revoke every assigned and
+// overdue grant.
+func (d *Connector) loadAssignments(ctx context.Context) error {
+	if !d.assignmentsEnabled {
+		return nil
+	}
+
+	logger := logging.Extract(ctx)
+	fetchStart := time.Now()
+	assignments, err := d.fetchAssignments(ctx)
+	if err != nil {
+		cached, fetchedAt, fallbackErr := loadFallbackDirectory[client.Assignment](d, assignmentsStateKey)
+		if fallbackErr != nil {
+			logger.Debug("Assignment fallback not used", zap.Error(fallbackErr))
+			return fmt.Errorf("failed to fetch assignments: %w", err)
+		}
+		logger.Warn("Serving stale assignments because the content assignment service could not be reached",
+			zap.Error(err),
+			zap.Time("assignments_fetched_at", fetchedAt),
+			zap.Int("assignments", len(cached)))
+		d.assignments = &assignmentDirectory{fetchedAt: fetchedAt, assignments: cached}
+		return nil
+	}
+	d.assignments = &assignmentDirectory{fetchedAt: time.Now().UTC(), assignments: assignments}
+	saveLastGoodDirectory(ctx, d, assignmentsStateKey, d.assignments.fetchedAt, assignments)
+
+	logger.Info("Assignments fetched",
+		zap.Int("assignments", len(assignments)),
+		zap.Duration("duration", time.Since(fetchStart)))
+	return nil
+}
+
+// fetchAssignments pages through every assignment.
+func (d *Connector) fetchAssignments(ctx context.Context) ([]client.Assignment, error) {
+	var assignments []client.Assignment
+	for {
+		page, total, _, err := d.client.GetAssignmentsPage(ctx, len(assignments), defaultAssignmentsPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch assignments at offset %d: %w", len(assignments), err)
+		}
+		assignments = append(assignments, page...)
+		if len(page) == 0 || len(assignments) >= total {
+			return assignments, nil
+		}
+	}
+}
+
+// buildAssignmentIndex groups assignments by course and learner, moving the
+// assignments of merged users to the surviving user. A learner assigned the
+// same content more than once is held to the earliest due date.
+func buildAssignmentIndex(directory *assignmentDirectory, survivors map[string]string) courseAssignments {
+	if directory == nil {
+		return nil
+	}
+
+	index := make(courseAssignments)
+	for _, assignment := range directory.assignments {
+		if assignment.ContentId == "" || assignment.UserId == "" {
+			continue
+		}
+		if survivor, ok := survivors[assignment.UserId]; ok {
+			assignment.UserId = survivor
+		}
+		if index[assignment.ContentId] == nil {
+			index[assignment.ContentId] = make(map[string]client.Assignment)
+		}
+		previous, seen := index[assignment.ContentId][assignment.UserId]
+		if seen && !dueBefore(assignment, previous) {
+			continue
+		}
+		index[assignment.ContentId][assignment.UserId] = assignment
+	}
+	return index
+}
+
+// buildAssignedUsers returns the learners assigned content who have no
+// learning activity and aren't otherwise published, so their assigned and
+// overdue grants have a principal. Like users added for their roles, they can
+// only be matched when users are identified by Percipio user ID; the others
+// are counted and logged. Their names and emails come from user management
+// when roles are loaded, and learners it lists as inactive are left out.
+func buildAssignedUsers(
+	ctx context.Context,
+	assignments courseAssignments,
+	users []client.User,
+	userResourceIds map[string]string,
+	directory *roleDirectory,
+) []client.User {
+	published := make(map[string]bool, len(users))
+	for _, user := range users {
+		published[user.Id] = true
+	}
+	managedUsers := make(map[string]client.ManagedUser)
+	if directory != nil {
+		for _, managedUser := range directory.users {
+			managedUsers[managedUser.Id] = managedUser
+		}
+	}
+
+	var (
+		added     []client.User
+		unmatched = make(map[string]bool)
+		inactive  int
+	)
+	for _, learners := range assignments {
+		for userId := range learners {
+			if userResourceIds != nil {
+				if _, ok := userResourceIds[userId]; !ok {
+					unmatched[userId] = true
+				}
+				continue
+			}
+			if published[userId] {
+				continue
+			}
+			published[userId] = true
+
+			user := client.User{Id: userId, PercipioUserId: userId}
+			if managedUser, ok := managedUsers[userId]; ok {
+				if !managedUser.IsActive {
+					inactive++
+					continue
+				}
+				user = managedUser.ToUser()
+			}
+			added = append(added, user)
+		}
+	}
+
+	logger := logging.Extract(ctx)
+	if len(unmatched) > 0 {
+		logger.Warn("Assigned learners have no learning activity and can't be matched to a user identifier, so their assignments aren't granted",
+			zap.Int("unmatched_users", len(unmatched)))
+	}
+	if len(added) > 0 || inactive > 0 {
+		logger.Info("Published assigned learners without learning activity",
+			zap.Int("users_without_activity", len(added)),
+			zap.Int("inactive_users", inactive))
+	}
+	return added
+}
+
+// buildAssignedCourses returns the content learners are assigned that has no
+// learning activity in the report, so the learners who haven't started it
+// yet still get their assigned and overdue grants. Only the content ID is
+// known; titles and types come from the catalog when it's loaded, see
+// titleAssignedCourses.
+func buildAssignedCourses(assignments courseAssignments, courses []client.Course) []client.Course {
+	listed := make(map[string]bool, len(courses))
+	for _, course := range courses {
+		listed[course.Id] = true
+	}
+	var added []client.Course
+	for courseId := range assignments {
+		if courseId == "" || listed[courseId] {
+			continue
+		}
+		added = append(added, client.Course{Id: courseId})
+	}
+	return added
+}
+
+// titleAssignedCourses titles the assigned courses the catalog didn't
+// describe with their content ID, so they aren't synced without a name.
+func titleAssignedCourses(courses []client.Course, assigned []client.Course) {
+	if len(assigned) == 0 {
+		return
+	}
+	untitled := make(map[string]bool, len(assigned))
+	for _, course := range assigned {
+		untitled[course.Id] = true
+	}
+	for i, course := range courses {
+		if course.CourseTitle == "" && untitled[course.Id] {
+			courses[i].CourseTitle = course.Id
+		}
+	}
+}
+
+// dueBefore reports whether a is due before b. Assignments without a due
+// date are due last.
+func dueBefore(a, b client.Assignment) bool {
+	dueA, dueB := a.DueAt(), b.DueAt()
+	switch {
+	case dueA.IsZero():
+		return false
+	case dueB.IsZero():
+		return true
+	default:
+		return dueA.Before(dueB)
+	}
+}
+
+// isOverdue reports whether an assignment is past due at now without having
+// been completed.
+func isOverdue(assignment client.Assignment, status string, now time.Time) bool {
+	due := assignment.DueAt()
+	return !due.IsZero() && now.After(due) && status != completedEntitlement
+}
+
+// courseAssignments returns the assignments for a course. It returns nil when
+// no report is loaded or nobody is assigned the course.
+func (d *Connector) courseAssignments(ctx context.Context, courseId string) map[string]client.Assignment {
+	if d == nil || !d.assignmentsEnabled || !d.reportLoaded() {
+		return nil
+	}
+	return d.index(ctx).assignments[courseId]
+}
+
+// publishedUser reports whether a user resource is published, so grants are
+// only made to users that exist.
+func (d *Connector) publishedUser(ctx context.Context, resourceId string) bool {
+	if d == nil || !d.reportLoaded() {
+		return false
+	}
+	_, ok := d.index(ctx).user(resourceId)
+	return ok
+}
+
+// assignmentGrant returns a grant of the assigned or overdue entitlement,
+// with the assignment attached.
+func assignmentGrant(resource *v2.Resource, slug string, principalId *v2.ResourceId, assignment client.Assignment) *v2.Grant {
+	metadata := map[string]interface{}{
+		"assignment_id": assignment.Id,
+	}
+	if assignment.Name != "" {
+		metadata["assignment_name"] = assignment.Name
+	}
+	if assignment.AssignedDate != "" {
+		metadata["assigned_date"] = client.FormatDate(assignment.AssignedDate)
+	}
+	if assignment.DueDate != "" {
+		metadata["due_date"] = client.FormatDate(assignment.DueDate)
+	}
+	return grant.NewGrant(resource, slug, principalId, grant.WithGrantMetadata(metadata))
+}
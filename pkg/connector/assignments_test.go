@@ -0,0 +1,253 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assignmentServer serves Michael's completed and Milton's overdue
+// assignments of course1, and two for Peter, who has no activity, including
+// course2, which nobody has started.
+func assignmentServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/content-assignment/v1/organizations/test-org/assignments", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("x-total-count", "5")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[
+			{"id": "a1", "name": "Compliance 2025", "userId": "michael.bolton@initech.com", "contentId": "course1", "dueDate": "2025-03-31"},
+			{"id": "a1", "name": "Compliance 2025", "userId": "milton.waddams@initech.com", "contentId": "course1", "assignedDate": "2025-01-01", "dueDate": "2025-03-31"},
+			{"id": "a2", "name": "Onboarding", "userId": "milton.waddams@initech.com", "contentId": "course1"},
+			{"id": "a1", "name": "Compliance 2025", "userId": "peter.gibbons@initech.com", "contentId": "course1", "dueDate": "2025-03-31"},
+			{"id": "a3", "name": "Security Basics", "userId": "peter.gibbons@initech.com", "contentId": "course2", "dueDate": "2025-03-31"}
+		]`))
+	}))
+}
+
+func assignmentReport() *client.Report {
+	return &client.Report{
+		{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Completed"},
+		{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Started"},
+	}
+}
+
+func TestBuildAssignmentIndex(t *testing.T) {
+	directory := &assignmentDirectory{assignments: []client.Assignment{
+		{Id: "a2", UserId: "michael.bolton@initech.com", ContentId: "course1"},
+		{Id: "a1", UserId: "michael.bolton@initech.com", ContentId: "course1", DueDate: "2025-03-31"},
+		{Id: "a3", UserId: "mbolton@initech.com", ContentId: "course2", DueDate: "2025-06-30"},
+		{Id: "a4", UserId: "michael.bolton@initech.com", ContentId: ""},
+	}}
+
+	index := buildAssignmentIndex(directory, map[string]string{"mbolton@initech.com": "michael.bolton@initech.com"})
+	assert.Equal(t, "a1", index["course1"]["michael.bolton@initech.com"].Id)
+	assert.Equal(t, "a3", index["course2"]["michael.bolton@initech.com"].Id)
+	assert.Len(t, index, 2)
+	assert.Nil(t, buildAssignmentIndex(nil, nil))
+}
+
+func TestIsOverdue(t *testing.T) {
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	assignment := client.Assignment{DueDate: "2025-03-31"}
+
+	assert.True(t, isOverdue(assignment, inProgressEntitlement, now))
+	assert.True(t, isOverdue(assignment, "", now))
+	assert.False(t, isOverdue(assignment, completedEntitlement, now))
+	assert.False(t, isOverdue(assignment, inProgressEntitlement, now.AddDate(0, 0, -2)))
+	assert.False(t, isOverdue(client.Assignment{}, inProgressEntitlement, now))
+}
+
+func TestAssignmentGrants(t *testing.T) {
+	ctx := context.Background()
+	server := assignmentServer(t)
+	defer server.Close()
+
+	connector := newLoadedConnector(t, server.URL, assignmentReport(), WithAssignments(true))
+	require.NotNil(t, connector.assignments)
+	c := newCourseBuilder(connector.client, connector.report, connector)
+	course := &v2.Resource{DisplayName: "Compliance", Id: &v2.ResourceId{ResourceType: "course", Resource: "course1"}}
+
+	t.Run("should add the assigned and overdue entitlements", func(t *testing.T) {
+		entitlements, _, _, err := c.Entitlements(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{assignedEntitlement, completedEntitlement, inProgressEntitlement, overdueEntitlement}, entitlementSlugs(entitlements))
+	})
+
+	t.Run("should grant assigned and overdue to assigned learners", func(t *testing.T) {
+		grants, _, _, err := c.Grants(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+
+		byEntitlement := make(map[string][]string)
+		for _, g := range grants {
+			byEntitlement[g.Entitlement.Id] = append(byEntitlement[g.Entitlement.Id], g.Principal.Id.Resource)
+		}
+		assert.Equal(t, map[string][]string{
+			"course:course1:completed":   {"michael.bolton@initech.com"},
+			"course:course1:in_progress": {"milton.waddams@initech.com"},
+			"course:course1:assigned":    {"michael.bolton@initech.com", "milton.waddams@initech.com", "peter.gibbons@initech.com"},
+			"course:course1:overdue":     {"milton.waddams@initech.com", "peter.gibbons@initech.com"},
+		}, byEntitlement)
+
+		var overdue *v2.Grant
+		for _, g := range grants {
+			if g.Entitlement.Id == "course:course1:overdue" && g.Principal.Id.Resource == "milton.waddams@initech.com" {
+				overdue = g
+			}
+		}
+		require.NotNil(t, overdue)
+		metadata := &v2.GrantMetadata{}
+		annos := annotations.Annotations(overdue.Annotations)
+		ok, err := annos.Pick(metadata)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, map[string]interface{}{
+			"assignment_id":   "a1",
+			"assignment_name": "Compliance 2025",
+			"assigned_date":   "2025-01-01T00:00:00Z",
+			"due_date":        "2025-03-31T00:00:00Z",
+		}, metadata.Metadata.AsMap())
+	})
+
+	t.Run("should page assigned learners among learners with statuses", func(t *testing.T) {
+		all, _, _, err := c.Grants(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		var allIds []string
+		for _, g := range all {
+			allIds = append(allIds, g.Id)
+		}
+
+		var paged []string
+		var principals []string
+		token := ""
+		for {
+			grants, nextToken, _, err := c.Grants(ctx, course, &pagination.Token{Token: token, Size: 1})
+			require.NoError(t, err)
+			for _, g := range grants {
+				paged = append(paged, g.Id)
+			}
+			principals = append(principals, grants[0].Principal.Id.Resource)
+			if nextToken == "" {
+				break
+			}
+			token = nextToken
+		}
+		assert.Equal(t, []string{"michael.bolton@initech.com", "milton.waddams@initech.com", "peter.gibbons@initech.com"}, principals)
+		assert.ElementsMatch(t, allIds, paged)
+	})
+
+	t.Run("should list assigned courses nobody has started", func(t *testing.T) {
+		courses, _, _, err := c.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		var ids []string
+		for _, course := range courses {
+			ids = append(ids, course.Id.Resource)
+		}
+		assert.Equal(t, []string{"course1", "course2"}, ids)
+		assert.Equal(t, "course2", courses[1].DisplayName)
+
+		grants, _, _, err := c.Grants(ctx, courses[1], &pagination.Token{})
+		require.NoError(t, err)
+		var granted []string
+		for _, g := range grants {
+			granted = append(granted, g.Entitlement.Id+"="+g.Principal.Id.Resource)
+		}
+		assert.ElementsMatch(t, []string{
+			"course:course2:assigned=peter.gibbons@initech.com",
+			"course:course2:overdue=peter.gibbons@initech.com",
+		}, granted)
+	})
+
+	t.Run("should publish assigned learners without activity", func(t *testing.T) {
+		user, ok := connector.index(ctx).user("peter.gibbons@initech.com")
+		require.True(t, ok)
+		assert.Equal(t, "peter.gibbons@initech.com", user.PercipioUserId)
+	})
+
+	t.Run("should fail when assignments can't be fetched", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer failing.Close()
+
+		connector := newLoadedConnector(t, failing.URL, assignmentReport())
+		connector.assignmentsEnabled = true
+		err := connector.loadAssignments(ctx)
+		assert.ErrorIs(t, err, client.ErrForbidden)
+		assert.Nil(t, connector.assignments)
+	})
+
+	t.Run("should fall back on the last assignments fetched", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer failing.Close()
+
+		stateDir := t.TempDir()
+		good := newLoadedConnector(t, server.URL, assignmentReport(), WithAssignments(true), WithStateDir(stateDir), WithReportFallback(time.Hour))
+		require.NotNil(t, good.assignments)
+
+		connector := newLoadedConnector(t, server.URL, assignmentReport(), WithStateDir(stateDir), WithReportFallback(time.Hour))
+		connector.client, _ = client.New(ctx, failing.URL, "test-org", "test-token")
+		connector.assignmentsEnabled = true
+		require.NoError(t, connector.loadAssignments(ctx))
+		require.NotNil(t, connector.assignments)
+		assert.Equal(t, good.assignments.assignments, connector.assignments.assignments)
+	})
+}
+
+func TestBuildAssignedCourses(t *testing.T) {
+	assignments := courseAssignments{
+		"course1": {"michael.bolton@initech.com": {Id: "a1"}},
+		"course2": {"peter.gibbons@initech.com": {Id: "a2"}},
+	}
+
+	added := buildAssignedCourses(assignments, []client.Course{{Id: "course1", CourseTitle: "Compliance"}})
+	assert.Equal(t, []client.Course{{Id: "course2"}}, added)
+	assert.Empty(t, buildAssignedCourses(nil, nil))
+
+	courses := []client.Course{{Id: "course1"}, {Id: "course2"}, {Id: "course3", CourseTitle: "Security Basics"}}
+	titleAssignedCourses(courses, []client.Course{{Id: "course2"}, {Id: "course3"}})
+	assert.Equal(t, []client.Course{{Id: "course1"}, {Id: "course2", CourseTitle: "course2"}, {Id: "course3", CourseTitle: "Security Basics"}}, courses)
+}
+
+func TestBuildAssignedUsers(t *testing.T) {
+	ctx := context.Background()
+	assignments := courseAssignments{
+		"course1": {
+			"michael.bolton@initech.com": {Id: "a1"},
+			"peter.gibbons@initech.com":  {Id: "a1"},
+			"bob.slydell@initech.com":    {Id: "a1"},
+		},
+		"course2": {
+			"peter.gibbons@initech.com": {Id: "a2"},
+		},
+	}
+	users := []client.User{{Id: "michael.bolton@initech.com"}}
+	directory := &roleDirectory{users: []client.ManagedUser{
+		{Id: "peter.gibbons@initech.com", FirstName: "Peter", LastName: "Gibbons", Role: learnerRole, IsActive: true},
+		{Id: "bob.slydell@initech.com", Role: learnerRole, IsActive: false},
+	}}
+
+	t.Run("should add active assigned learners once", func(t *testing.T) {
+		added := buildAssignedUsers(ctx, assignments, users, nil, directory)
+		require.Len(t, added, 1)
+		assert.Equal(t, "peter.gibbons@initech.com", added[0].Id)
+		assert.Equal(t, "Peter", added[0].FirstName)
+	})
+
+	t.Run("should add nobody when users have another identifier", func(t *testing.T) {
+		added := buildAssignedUsers(ctx, assignments, users, map[string]string{"michael.bolton@initech.com": "E100"}, directory)
+		assert.Empty(t, added)
+	})
+}
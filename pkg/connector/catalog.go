@@ -0,0 +1,183 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+const (
+	catalogStateKey        = "catalog"
+	defaultCatalogPageSize = 1000
+)
+
+// CatalogOptions controls enrichment of courses from the Content Discovery
+// catalog.
+type CatalogOptions struct {
+	// Enabled fetches the catalog after each report is loaded.
+	Enabled bool
+	// PublishInactive also lists catalog courses nobody has activity on.
+	PublishInactive bool
+	// CacheMaxAge is how long a fetched catalog is reused, in memory and in
+	// the state directory, before it is fetched again.
+	CacheMaxAge time.Duration
+}
+
+// cachedCatalog is a fetched catalog, kept on disk so each sync doesn't have
+// to page through the whole catalog again.
+type cachedCatalog struct {
+	FetchedAt time.Time               `json:"fetched_at"`
+	Items     []client.CatalogContent `json:"items"`
+}
+
+// catalogIndex looks catalog items up by ID or by course code, since the
+// report may identify content by either.
+type catalogIndex struct {
+	fetchedAt time.Time
+	items     []client.CatalogContent
+	byId      map[string]int
+}
+
+func newCatalogIndex(items []client.CatalogContent, fetchedAt time.Time) *catalogIndex {
+	index := &catalogIndex{
+		fetchedAt: fetchedAt,
+		items:     items,
+		byId:      make(map[string]int, 2*len(items)),
+	}
+	for i, item := range items {
+		if item.Id != "" {
+			index.byId[item.Id] = i
+		}
+		if item.Code != "" {
+			index.byId[item.Code] = i
+		}
+	}
+	return index
+}
+
+// loadCatalog makes the catalog available for enrichment, reusing the one in
+// memory or in the state directory while it is fresh enough. Failures are
+// logged and leave courses unenriched rather than failing the sync.
+func (d *Connector) loadCatalog(ctx context.Context) {
+	if !d.catalogOptions.Enabled {
+		return
+	}
+
+	logger := logging.Extract(ctx)
+	if d.catalog != nil && time.Since(d.catalog.fetchedAt) <= d.catalogOptions.CacheMaxAge {
+		return
+	}
+
+	if d.state.Enabled() {
+		var cached cachedCatalog
+		found, err := d.state.Load(catalogStateKey, &cached)
+		if err != nil {
+			logger.Warn("Failed to load cached catalog", zap.Error(err))
+		}
+		if found && time.Since(cached.FetchedAt) <= d.catalogOptions.CacheMaxAge {
+			d.catalog = newCatalogIndex(cached.Items, cached.FetchedAt)
+			logger.Debug("Using cached catalog",
+				zap.Int("catalog_items", len(cached.Items)),
+				zap.Time("fetched_at", cached.FetchedAt))
+			return
+		}
+	}
+
+	fetchStart := time.Now()
+	items, err := d.fetchCatalog(ctx)
+	if err != nil {
+		logger.Warn("Failed to fetch catalog, courses will not be enriched", zap.Error(err))
+		return
+	}
+	fetchedAt := time.Now().UTC()
+	d.catalog = newCatalogIndex(items, fetchedAt)
+
+	logger.Info("Catalog fetched",
+		zap.Int("catalog_items", len(items)),
+		zap.Duration("duration", time.Since(fetchStart)))
+
+	if d.state.Enabled() {
+		err := d.state.Save(catalogStateKey, cachedCatalog{FetchedAt: fetchedAt, Items: items})
+		if err != nil {
+			logger.Warn("Failed to save catalog cache", zap.Error(err))
+		}
+	}
+}
+
+// fetchCatalog pages through the whole Content Discovery catalog.
+func (d *Connector) fetchCatalog(ctx context.Context) ([]client.CatalogContent, error) {
+	var (
+		items           []client.CatalogContent
+		pagingRequestId string
+	)
+	for {
+		page, nextPagingRequestId, total, _, err := d.client.GetCatalogPage(ctx, len(items), defaultCatalogPageSize, pagingRequestId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch catalog page at offset %d: %w", len(items), err)
+		}
+		items = append(items, page...)
+		if len(page) == 0 || len(items) >= total {
+			return items, nil
+		}
+		if nextPagingRequestId != "" {
+			pagingRequestId = nextPagingRequestId
+		}
+	}
+}
+
+// enrichCourses fills in catalog metadata for the courses from the report and,
+// if configured, adds the catalog courses nobody has activity on. Titles and
+// content types from the report are kept, since that is what learners saw.
+func (d *Connector) enrichCourses(courses []client.Course) []client.Course {
+	if d.catalog == nil {
+		return courses
+	}
+
+	matched := make([]bool, len(d.catalog.items))
+	for i, course := range courses {
+		n, ok := d.catalog.byId[course.Id]
+		if !ok {
+			continue
+		}
+		matched[n] = true
+		courses[i] = mergeCatalogCourse(course, d.catalog.items[n].ToCourse(course.Id))
+	}
+
+	if !d.catalogOptions.PublishInactive {
+		return courses
+	}
+
+	for n, item := range d.catalog.items {
+		if matched[n] || item.Id == "" {
+			continue
+		}
+		courses = append(courses, item.ToCourse(item.Id))
+	}
+	// A stable sort keeps report courses ahead of any catalog item that
+	// happens to share their ID, so compacting drops the catalog duplicate.
+	slices.SortStableFunc(courses, func(a, b client.Course) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+	return slices.CompactFunc(courses, func(a, b client.Course) bool {
+		return a.Id == b.Id
+	})
+}
+
+// mergeCatalogCourse combines a course from the report with the same course
+// from the catalog.
+func mergeCatalogCourse(course client.Course, catalogCourse client.Course) client.Course {
+	if course.CourseTitle != "" {
+		catalogCourse.CourseTitle = course.CourseTitle
+	}
+	if course.ContentType != "" {
+		catalogCourse.ContentType = course.ContentType
+	}
+	return catalogCourse
+}
@@ -0,0 +1,193 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// catalogServer serves a two item catalog one item per page, counting the
+// pages requested.
+func catalogServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	pages := []string{
+		`[{
+			"id": "7f1c5a4e-6c1d-4b8e-9a43-2c0b3f6f9a10",
+			"code": "bs_adg02_a23_enus",
+			"contentType": {"displayLabel": "Course"},
+			"localizedMetadata": [
+				{"localeCode": "en-US", "title": "Case Studies: Data Privacy", "description": "Explore real-world data privacy programs."},
+				{"localeCode": "fr-FR", "title": "Études de cas : confidentialité des données"}
+			],
+			"duration": "PT25M3S",
+			"lifecycle": {"status": "ACTIVE"}
+		}]`,
+		`[{
+			"id": "0d9a3c2b-1e4f-4a6b-8c7d-5e6f7a8b9c0d",
+			"code": "it_sdgo01_a01_enus",
+			"contentType": {"displayLabel": "Course"},
+			"localizedMetadata": [{"localeCode": "en-US", "title": "Secure Development"}],
+			"lifecycle": {"status": "RETIRED", "plannedRetirementDate": "2025-01-31"}
+		}]`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		require.NoError(t, err)
+		if offset > 0 {
+			assert.Equal(t, "paging-123", r.URL.Query().Get("pagingRequestId"))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("x-total-count", strconv.Itoa(len(pages)))
+		w.Header().Set("x-paging-request-id", "paging-123")
+		w.WriteHeader(http.StatusOK)
+		if offset < len(pages) {
+			_, _ = w.Write([]byte(pages[offset]))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+}
+
+func TestLoadCatalog(t *testing.T) {
+	ctx := context.Background()
+
+	newConnector := func(t *testing.T, serverURL string, stateDir string) *Connector {
+		percipioClient, err := client.New(ctx, serverURL, "test-org", "test-token")
+		require.NoError(t, err)
+		return &Connector{
+			client:         percipioClient,
+			state:          state.New(stateDir),
+			catalogOptions: CatalogOptions{Enabled: true, CacheMaxAge: time.Hour},
+		}
+	}
+
+	t.Run("should page through the catalog", func(t *testing.T) {
+		var requests atomic.Int32
+		server := catalogServer(t, &requests)
+		defer server.Close()
+
+		connector := newConnector(t, server.URL, "")
+		items, err := connector.fetchCatalog(ctx)
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, "bs_adg02_a23_enus", items[0].Code)
+		assert.Equal(t, "it_sdgo01_a01_enus", items[1].Code)
+	})
+
+	t.Run("should reuse a fresh catalog from the state directory", func(t *testing.T) {
+		var requests atomic.Int32
+		server := catalogServer(t, &requests)
+		defer server.Close()
+		stateDir := t.TempDir()
+
+		connector := newConnector(t, server.URL, stateDir)
+		connector.loadCatalog(ctx)
+		require.NotNil(t, connector.catalog)
+		assert.Equal(t, int32(2), requests.Load())
+
+		// Reloading in memory is a no-op while fresh.
+		connector.loadCatalog(ctx)
+		assert.Equal(t, int32(2), requests.Load())
+
+		// So is a new connector sharing the state directory.
+		connector = newConnector(t, server.URL, stateDir)
+		connector.loadCatalog(ctx)
+		require.NotNil(t, connector.catalog)
+		assert.Len(t, connector.catalog.items, 2)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("should leave courses unenriched when the catalog can't be fetched", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		connector := newConnector(t, server.URL, "")
+		connector.loadCatalog(ctx)
+		assert.Nil(t, connector.catalog)
+	})
+
+	t.Run("should do nothing unless enabled", func(t *testing.T) {
+		var requests atomic.Int32
+		server := catalogServer(t, &requests)
+		defer server.Close()
+
+		connector := newConnector(t, server.URL, "")
+		connector.catalogOptions.Enabled = false
+		connector.loadCatalog(ctx)
+		assert.Nil(t, connector.catalog)
+		assert.Equal(t, int32(0), requests.Load())
+	})
+}
+
+func TestEnrichCourses(t *testing.T) {
+	items := []client.CatalogContent{
+		{
+			Id:                "7f1c5a4e-6c1d-4b8e-9a43-2c0b3f6f9a10",
+			Code:              "bs_adg02_a23_enus",
+			ContentType:       client.CatalogContentType{DisplayLabel: "Course"},
+			LocalizedMetadata: []client.CatalogLocalizedMetadata{{LocaleCode: "en-US", Title: "Data Privacy", Description: "Explore data privacy."}},
+			Duration:          "PT25M3S",
+			Lifecycle:         client.CatalogLifecycle{Status: client.CatalogStatusActive},
+		},
+		{
+			Id:                "0d9a3c2b-1e4f-4a6b-8c7d-5e6f7a8b9c0d",
+			Code:              "it_sdgo01_a01_enus",
+			ContentType:       client.CatalogContentType{DisplayLabel: "Course"},
+			LocalizedMetadata: []client.CatalogLocalizedMetadata{{LocaleCode: "en-US", Title: "Secure Development"}},
+			Lifecycle:         client.CatalogLifecycle{Status: client.CatalogStatusRetired},
+		},
+	}
+	reportCourses := func() []client.Course {
+		return []client.Course{
+			{Id: "bs_adg02_a23_enus", CourseTitle: "Case Studies: Data Privacy", ContentType: "Course"},
+			{Id: "not_in_catalog", CourseTitle: "Custom Content", ContentType: "Link"},
+		}
+	}
+
+	t.Run("should fill in catalog metadata and keep report titles", func(t *testing.T) {
+		connector := &Connector{catalog: newCatalogIndex(items, time.Now())}
+
+		courses := connector.enrichCourses(reportCourses())
+		require.Len(t, courses, 2)
+		assert.Equal(t, "bs_adg02_a23_enus", courses[0].Id)
+		assert.Equal(t, "Case Studies: Data Privacy", courses[0].CourseTitle)
+		assert.Equal(t, "Explore data privacy.", courses[0].Description)
+		assert.Equal(t, "PT25M3S", courses[0].Duration)
+		assert.Equal(t, client.CatalogStatusActive, courses[0].Status)
+		assert.Equal(t, client.Course{Id: "not_in_catalog", CourseTitle: "Custom Content", ContentType: "Link"}, courses[1])
+	})
+
+	t.Run("should publish catalog courses without activity", func(t *testing.T) {
+		connector := &Connector{
+			catalog:        newCatalogIndex(items, time.Now()),
+			catalogOptions: CatalogOptions{PublishInactive: true},
+		}
+
+		courses := connector.enrichCourses(reportCourses())
+		require.Len(t, courses, 3)
+		assert.Equal(t, "0d9a3c2b-1e4f-4a6b-8c7d-5e6f7a8b9c0d", courses[0].Id)
+		assert.Equal(t, "Secure Development", courses[0].CourseTitle)
+		assert.Equal(t, client.CatalogStatusRetired, courses[0].Status)
+		assert.Equal(t, "bs_adg02_a23_enus", courses[1].Id)
+		assert.Equal(t, "not_in_catalog", courses[2].Id)
+	})
+
+	t.Run("should leave courses alone without a catalog", func(t *testing.T) {
+		connector := &Connector{}
+		assert.Equal(t, reportCourses(), connector.enrichCourses(reportCourses()))
+	})
+}
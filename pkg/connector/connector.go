@@ -4,15 +4,18 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
-	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/conductorone/baton-sdk/pkg/types"
 	"go.uber.org/zap"
 )
 
@@ -33,15 +36,65 @@ type Connector struct {
 	reportState    ReportState
 	reportMutex    sync.RWMutex
 	reportError    error
+	state          *state.Store
+	guardrails     Guardrails
+	fallbackMaxAge time.Duration
+	pageSize       int
+	pageTokens     *pageTokens
+	reportIndex    *reportIndex
+	indexMutex     sync.Mutex
+	catalogOptions CatalogOptions
+	catalog        *catalogIndex
+	userAttributes map[string]string
+	identity       UserIdentity
+	mergeUsersBy   []string
+	dormancyWindow time.Duration
+	groupOptions   GroupOptions
+	rolesEnabled   bool
+	roles          *roleDirectory
+	assessments    AssessmentOptions
+	entitlements   EntitlementOptions
+	// entitlementTemplates are parsed from entitlements in New.
+	entitlementTemplates *entitlementTemplates
+
+	everCompletedEnabled bool
+	statusStore          client.StatusStoreOptions
+	stateEncryption      state.EncryptionOptions
+	logRedaction         logging.RedactionOptions
+
+	assignmentsEnabled bool
+	assignments        *assignmentDirectory
+	// mergedUserIds maps the Percipio user IDs merged into another user to
+	// the surviving user's ID.
+	mergedUserIds map[string]string
+
+	// pendingBaseline holds the stats of a report that passed the guardrails
+	// until its sync succeeds and the server's Cleanup promotes it.
+	pendingBaseline *reportStats
+
+	// Status changes since the previous sync, served by the event feed.
+	statusChanges   []statusChange
+	statusChangesAt time.Time
+	// statusChangesServed is how many of statusChanges the event feed has
+	// served and are no longer saved as pending.
+	statusChangesServed int
+	statusChangesMutex  sync.Mutex
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
 func (d *Connector) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
 	_ = ctx // This method returns static resource syncers
-	return []connectorbuilder.ResourceSyncer{
+	syncers := []connectorbuilder.ResourceSyncer{
 		newUserBuilder(d.client, d.report, d),
 		newCourseBuilder(d.client, d.report, d),
 	}
+	if d.groupOptions.enabled() {
+		syncers = append(syncers, newGroupBuilder(d.client, d))
+	}
+	if d.rolesEnabled {
+		syncers = append(syncers, newRoleBuilder(d.client, d))
+	}
+	return syncers
 }
 
 // Asset takes an input AssetRef and attempts to fetch it using the connector's authenticated http client
@@ -102,19 +155,19 @@ func (d *Connector) generateReport(ctx context.Context) error {
 	// If currently in progress or failed, reset and try again
 	d.reportState = ReportInProgress
 	d.reportError = nil
+	d.pendingBaseline = nil
 
-	logger := ctxzap.Extract(ctx)
+	logger := logging.Extract(ctx)
 	logger.Info("Starting learning activity report generation for sync")
 	reportGenStart := time.Now()
+	d.restoreStatusHistory(ctx)
 
 	_, err := d.client.GenerateLearningActivityReport(ctx, d.reportLookback)
 	if err != nil {
-		d.reportState = ReportFailed
-		d.reportError = fmt.Errorf("failed to generate learning activity report: %w", err)
 		logger.Error("Failed to generate learning activity report",
 			zap.Error(err),
 			zap.Duration("duration", time.Since(reportGenStart)))
-		return d.reportError
+		return d.fallBackOrFail(ctx, fmt.Errorf("failed to generate learning activity report: %w", err))
 	}
 
 	logger.Debug("Report generation request submitted",
@@ -123,13 +176,11 @@ func (d *Connector) generateReport(ctx context.Context) error {
 	reportLoadStart := time.Now()
 	_, err = d.client.GetLearningActivityReport(ctx)
 	if err != nil {
-		d.reportState = ReportFailed
-		d.reportError = fmt.Errorf("failed to retrieve learning activity report: %w", err)
 		logger.Error("Failed to retrieve learning activity report",
 			zap.Error(err),
 			zap.Duration("generation_duration", time.Since(reportGenStart)),
 			zap.Duration("load_duration", time.Since(reportLoadStart)))
-		return d.reportError
+		return d.fallBackOrFail(ctx, fmt.Errorf("failed to retrieve learning activity report: %w", err))
 	}
 
 	// Store the loaded report data
@@ -145,18 +196,121 @@ func (d *Connector) generateReport(ctx context.Context) error {
 		zap.Duration("total_duration", time.Since(reportGenStart)),
 		zap.Duration("load_duration", time.Since(reportLoadStart)))
 
+	if err := d.enforceGuardrails(ctx); err != nil {
+		d.reportState = ReportFailed
+		d.reportError = err
+		return d.reportError
+	}
+
+	d.saveLastGoodReport(ctx)
+	if err := d.resolveIdentities(ctx); err != nil {
+		logger.Error("Failed to merge duplicate users", zap.Error(err))
+		d.reportState = ReportFailed
+		d.reportError = err
+		return d.reportError
+	}
+	d.loadCatalog(ctx)
+	if err := d.loadRoles(ctx); err != nil {
+		logger.Error("Failed to load user roles", zap.Error(err))
+		d.reportState = ReportFailed
+		d.reportError = toGRPCError(err)
+		return d.reportError
+	}
+	if err := d.loadAssignments(ctx); err != nil {
+		logger.Error("Failed to load assignments", zap.Error(err))
+		d.reportState = ReportFailed
+		d.reportError = toGRPCError(err)
+		return d.reportError
+	}
+
+	// Changes are recorded once the index is complete, as they are resolved
+	// against it.
+	d.recordStatusChanges(ctx)
+	d.saveStatusHistory(ctx)
 	d.reportState = ReportCompleted
 	return nil
 }
 
+// Close releases the loaded report and its statuses store, removing the store
+// from disk if it is kept there. The next sync generates a fresh report.
+func (d *Connector) Close() error {
+	d.reportMutex.Lock()
+	defer d.reportMutex.Unlock()
+
+	d.report = nil
+	d.reportState = ReportNotStarted
+	d.reportError = nil
+	return d.client.Close()
+}
+
+// server is the connector's ConnectorServer. The SDK has no end-of-sync hook
+// for connectors, but the syncer calls Cleanup once a sync has succeeded, so
+// the guardrail baseline is promoted and the connector is closed there.
+type server struct {
+	types.ConnectorServer
+	connector *Connector
+}
+
+// NewServer returns a ConnectorServer for the connector that closes it at
+// the end of every sync.
+func NewServer(ctx context.Context, d *Connector) (types.ConnectorServer, error) {
+	connectorServer, err := connectorbuilder.NewConnector(logging.ToContext(ctx), d)
+	if err != nil {
+		return nil, err
+	}
+	return &server{ConnectorServer: connectorServer, connector: d}, nil
+}
+
+// Cleanup runs the SDK's cleanup and then closes the connector.
+func (s *server) Cleanup(ctx context.Context, request *v2.ConnectorServiceCleanupRequest) (*v2.ConnectorServiceCleanupResponse, error) {
+	response, err := s.ConnectorServer.Cleanup(ctx, request)
+	s.connector.promoteGuardrailBaseline(ctx)
+	if closeErr := s.connector.Close(); closeErr != nil {
+		logging.Extract(ctx).Warn("Failed to release the loaded report", zap.Error(closeErr))
+	}
+	return response, err
+}
+
+// reportColumns returns the report columns the connector reads besides the
+// ones ReportEntry maps: user attributes, identity columns, merge keys and the
+// group-by column.
+func (d *Connector) reportColumns() []string {
+	columns := d.identity.columns()
+	for column := range d.userAttributes {
+		columns = append(columns, column)
+	}
+	for _, key := range d.mergeUsersBy {
+		if key != MergeByEmail {
+			columns = append(columns, key)
+		}
+	}
+	if d.groupOptions.enabled() {
+		columns = append(columns, d.groupOptions.Attribute)
+	}
+	slices.Sort(columns)
+	return slices.Compact(columns)
+}
+
+// configureClient passes the options that shape how the client loads reports
+// on to it.
+func (d *Connector) configureClient() {
+	d.client.KeepStatusHistory = d.everCompletedEnabled
+	d.client.StatusStore = d.statusStore
+	d.client.ReportColumns = d.reportColumns()
+}
+
 // New returns a new instance of the connector.
 func New(
 	ctx context.Context,
 	organizationID string,
 	token string,
 	reportLookback time.Duration,
+	opts ...Option,
 ) (*Connector, error) {
-	logger := ctxzap.Extract(ctx)
+	// The client and the SDK log through ctx, so it carries the redacting
+	// logger.
+	ctx = logging.ToContext(ctx)
+	logger := logging.Extract(ctx)
 	logger.Info("Initializing Percipio connector",
 		zap.String("organizationId", organizationID))
 
@@ -174,6 +328,48 @@ func New(
 	connector := &Connector{
 		client:         percipioClient,
 		reportLookback: reportLookback,
+		state:          state.New(""),
+	}
+	for _, opt := range opts {
+		opt(connector)
+	}
+	if err := logging.Configure(connector.logRedaction); err != nil {
+		return nil, err
+	}
+	if err := connector.identity.validate(); err != nil {
+		return nil, err
+	}
+	if err := connector.assessments.validate(); err != nil {
+		return nil, err
+	}
+	if err := connector.statusStore.Validate(); err != nil {
+		return nil, err
+	}
+	encryption, err := state.NewEncryption(connector.stateEncryption)
+	if err != nil {
+		return nil, err
+	}
+	connector.state.SetEncryption(encryption)
+	if encryption != nil {
+		// The on-disk status store isn't encrypted, so statuses stay in
+		// memory.
+		switch connector.statusStore.Kind {
+		case client.StatusStoreDisk:
+			return nil, fmt.Errorf("invalid status store %q: it is not encrypted, so it can't be used with state encryption", client.StatusStoreDisk)
+		case "", client.StatusStoreAuto:
+			logger.Warn("Keeping course statuses in memory however large the report, as the on-disk status store isn't encrypted",
+				zap.String("status_store", client.StatusStoreAuto))
+		}
+		connector.statusStore.Kind = client.StatusStoreMemory
+	}
+	connector.configureClient()
+	connector.pageTokens, err = newPageTokens(token)
+	if err != nil {
+		return nil, err
+	}
+	connector.entitlementTemplates, err = connector.entitlements.templates()
+	if err != nil {
+		return nil, err
 	}
 
 	return connector, nil
@@ -2,16 +2,84 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"iter"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
 	"github.com/iiiatthew/baton-percipio-report/test"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
+// getStatuses reads a course's statuses from store, failing the test on
+// error.
+func getStatuses(t *testing.T, store client.StatusesStore, courseId string) map[string]string {
+	t.Helper()
+	statuses, err := store.Get(courseId)
+	require.NoError(t, err)
+	return statuses
+}
+
+var errStatusesUnreadable = errors.New("statuses unreadable")
+
+// failingStatusesStore is a StatusesStore whose reads fail, like a disk store
+// whose database is gone.
+type failingStatusesStore struct {
+	client.MapStatusesStore
+}
+
+func (failingStatusesStore) Get(string) (map[string]string, error) {
+	return nil, errStatusesUnreadable
+}
+
+func (failingStatusesStore) Statuses(string, string, func(string, string) bool) error {
+	return errStatusesUnreadable
+}
+
+func (failingStatusesStore) Courses() (iter.Seq[string], error) {
+	return nil, errStatusesUnreadable
+}
+
+func (failingStatusesStore) Len() (int, error) {
+	return 0, errStatusesUnreadable
+}
+
+func (failingStatusesStore) Merge(map[string]string) (int, error) {
+	return 0, errStatusesUnreadable
+}
+
+// newLoadedConnector returns a connector created with opts whose client talks
+// to serverURL and has report loaded, with the Percipio directories its
+// options call for fetched, as after a report was generated.
+func newLoadedConnector(t *testing.T, serverURL string, report *client.Report, opts ...Option) *Connector {
+	ctx := context.Background()
+	connector, err := New(ctx, "test-org", "test-token", 24*time.Hour, opts...)
+	require.NoError(t, err)
+
+	connector.client, err = client.New(ctx, serverURL, "test-org", "test-token")
+	require.NoError(t, err)
+	connector.configureClient()
+	require.NoError(t, connector.client.LoadReport(ctx, report))
+	connector.report = report
+	connector.reportState = ReportCompleted
+
+	require.NoError(t, connector.loadRoles(ctx))
+	require.NoError(t, connector.loadAssignments(ctx))
+	return connector
+}
+
 func TestConnectorNew(t *testing.T) {
 	ctx := context.Background()
 
@@ -46,6 +114,75 @@ func TestConnectorNew(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotNil(t, connector)
 	})
+
+	t.Run("should pass the status store options to the client", func(t *testing.T) {
+		options := client.StatusStoreOptions{Kind: client.StatusStoreDisk, Dir: t.TempDir()}
+		connector, err := New(ctx, "test-org", "test-token", 24*time.Hour, WithStatusStore(options))
+
+		require.NoError(t, err)
+		assert.Equal(t, options, connector.client.StatusStore)
+	})
+
+	t.Run("should pass the report columns it reads to the client", func(t *testing.T) {
+		connector, err := New(ctx, "test-org", "test-token", 24*time.Hour,
+			WithUserIdentity(UserIdentity{IdField: "employeeNumber", EmailFields: []string{"emailAddress", "personalEmail"}}),
+			WithUserAttributes(map[string]string{"department": "department", "costCenter": "cost_center"}),
+			WithUserMerge([]string{MergeByEmail, "employeeNumber"}),
+			WithGroups(GroupOptions{Attribute: "region"}))
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"costCenter", "department", "emailAddress", "employeeNumber", "personalEmail", "region"},
+			connector.client.ReportColumns)
+	})
+
+	t.Run("should reject an invalid status store", func(t *testing.T) {
+		_, err := New(ctx, "test-org", "test-token", 24*time.Hour,
+			WithStatusStore(client.StatusStoreOptions{Kind: "tape"}))
+
+		assert.ErrorContains(t, err, "invalid status store")
+	})
+
+	t.Run("should encrypt state and keep statuses in memory", func(t *testing.T) {
+		stateDir := t.TempDir()
+		core, logs := observer.New(zapcore.WarnLevel)
+		connector, err := New(ctxzap.ToContext(ctx, zap.New(core)), "test-org", "test-token", 24*time.Hour,
+			WithStateDir(stateDir),
+			WithStateEncryption(state.EncryptionOptions{Passphrase: "hunter2", Required: true}))
+
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(stateDir, guardStateKey+".json.age"), connector.state.Path(guardStateKey))
+		assert.Equal(t, client.StatusStoreMemory, connector.client.StatusStore.Kind)
+		// Downgrading auto is logged.
+		assert.Equal(t, 1, logs.FilterMessageSnippet("on-disk status store isn't encrypted").Len())
+
+		_, err = New(ctxzap.ToContext(ctx, zap.New(core)), "test-org", "test-token", 24*time.Hour,
+			WithStateEncryption(state.EncryptionOptions{Passphrase: "hunter2"}),
+			WithStatusStore(client.StatusStoreOptions{Kind: client.StatusStoreMemory}))
+		require.NoError(t, err)
+		assert.Equal(t, 1, logs.FilterMessageSnippet("on-disk status store isn't encrypted").Len())
+	})
+
+	t.Run("should reject the disk status store with state encryption", func(t *testing.T) {
+		_, err := New(ctx, "test-org", "test-token", 24*time.Hour,
+			WithStateEncryption(state.EncryptionOptions{Passphrase: "hunter2"}),
+			WithStatusStore(client.StatusStoreOptions{Kind: client.StatusStoreDisk}))
+
+		assert.ErrorContains(t, err, "state encryption")
+	})
+
+	t.Run("should reject required state encryption without a key", func(t *testing.T) {
+		_, err := New(ctx, "test-org", "test-token", 24*time.Hour,
+			WithStateEncryption(state.EncryptionOptions{Required: true}))
+
+		assert.ErrorContains(t, err, "encryption is required")
+	})
+
+	t.Run("should reject an invalid log redaction", func(t *testing.T) {
+		_, err := New(ctx, "test-org", "test-token", 24*time.Hour,
+			WithLogRedaction(logging.RedactionOptions{Mode: "shred"}))
+
+		assert.ErrorContains(t, err, "invalid log redaction")
+	})
 }
 
 func TestConnectorResourceSyncers(t *testing.T) {
@@ -215,6 +352,45 @@ func TestConnectorGenerateReport(t *testing.T) {
 	})
 }
 
+func TestConnectorClose(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should release the report when a sync is cleaned up", func(t *testing.T) {
+		server := test.FixturesServer()
+		defer server.Close()
+
+		connector, err := New(ctx, "test-org", "test-token", 24*time.Hour, WithStatusStore(client.StatusStoreOptions{Kind: client.StatusStoreDisk, Dir: t.TempDir()}))
+		require.NoError(t, err)
+		connector.client, err = client.New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		connector.configureClient()
+		require.NoError(t, connector.generateReport(ctx))
+		_, onDisk := connector.client.StatusesStore.(*client.DiskStatusesStore)
+		require.True(t, onDisk)
+
+		connectorServer, err := NewServer(ctx, connector)
+		require.NoError(t, err)
+		_, err = connectorServer.Cleanup(ctx, &v2.ConnectorServiceCleanupRequest{})
+		require.NoError(t, err)
+
+		assert.Equal(t, ReportNotStarted, connector.reportState)
+		assert.Nil(t, connector.report)
+		_, onDisk = connector.client.StatusesStore.(*client.DiskStatusesStore)
+		assert.False(t, onDisk)
+
+		// The next sync generates a fresh report.
+		require.NoError(t, connector.generateReport(ctx))
+		assert.Equal(t, ReportCompleted, connector.reportState)
+	})
+
+	t.Run("should fail the sync when statuses can't be read", func(t *testing.T) {
+		connector := newLoadedConnector(t, "https://api.example.com", roleReport())
+		connector.client.StatusesStore = failingStatusesStore{}
+		err := connector.enforceGuardrails(ctx)
+		assert.ErrorIs(t, err, errStatusesUnreadable)
+	})
+}
+
 func TestConnectorValidate(t *testing.T) {
 	ctx := context.Background()
 
@@ -3,17 +3,22 @@ package connector
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
-	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	"github.com/conductorone/baton-sdk/pkg/types/grant"
 	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
-	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -36,14 +41,86 @@ func (o *courseBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return o.resourceType
 }
 
+// getCourseDisplayName returns "title (type)", or just the title when the
+// content type isn't known.
+func getCourseDisplayName(course client.Course) string {
+	if course.ContentType == "" {
+		return course.CourseTitle
+	}
+	return fmt.Sprintf("%s (%s)", course.CourseTitle, course.ContentType)
+}
+
+// localeFromContentId derives a locale from the language suffix Percipio
+// puts on content IDs, e.g. "bs_adg02_a23_enus" is "en-US". It returns an
+// empty string for IDs without one, such as UUIDs.
+func localeFromContentId(contentId string) string {
+	i := strings.LastIndex(contentId, "_")
+	if i < 0 {
+		return ""
+	}
+	suffix := contentId[i+1:]
+	if len(suffix) != 4 {
+		return ""
+	}
+	for _, r := range suffix {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+	return suffix[:2] + "-" + strings.ToUpper(suffix[2:])
+}
+
 // Create a new connector resource for a Percipio course.
+// Courses include an AppTrait so their profile shows up in ConductorOne.
 func courseResource(course client.Course, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	locale := course.Locale
+	if locale == "" {
+		locale = localeFromContentId(course.Id)
+	}
+
+	profile := map[string]interface{}{
+		"id":           course.Id,
+		"title":        course.CourseTitle,
+		"content_type": course.ContentType,
+	}
+	if locale != "" {
+		profile["locale"] = locale
+		profile["language"], _, _ = strings.Cut(locale, "-")
+	}
+	if course.Duration != "" {
+		profile["duration"] = course.Duration
+	}
+	if course.Provider != "" {
+		profile["provider"] = course.Provider
+	}
+	if course.Description != "" {
+		profile["description"] = course.Description
+	}
+	if course.Status != "" {
+		profile["status"] = course.Status
+		profile["retired"] = course.Status == client.CatalogStatusRetired
+	}
+	if course.PlannedRetirementDate != "" {
+		profile["planned_retirement_date"] = client.FormatDate(course.PlannedRetirementDate)
+	}
+	if len(course.LocalizedTitles) > 0 {
+		localizedTitles := make(map[string]interface{}, len(course.LocalizedTitles))
+		for locale, title := range course.LocalizedTitles {
+			localizedTitles[locale] = title
+		}
+		profile["localized_titles"] = localizedTitles
+	}
+
 	resourceOpts := []resourceSdk.ResourceOption{
 		resourceSdk.WithParentResourceID(parentResourceID),
+		resourceSdk.WithAppTrait(resourceSdk.WithAppProfile(profile)),
+	}
+	if course.Description != "" {
+		resourceOpts = append(resourceOpts, resourceSdk.WithDescription(course.Description))
 	}
 
 	resource, err := resourceSdk.NewResource(
-		course.CourseTitle,
+		getCourseDisplayName(course),
 		courseResourceType,
 		course.Id,
 		resourceOpts...,
@@ -55,17 +132,87 @@ func courseResource(course client.Course, parentResourceID *v2.ResourceId) (*v2.
 	return resource, nil
 }
 
+// buildCourseIndex extracts the unique courses from the report, sorted by
+// course ID.
+func buildCourseIndex(ctx context.Context, report *client.Report) []client.Course {
+	if report == nil || len(*report) == 0 {
+		return nil
+	}
+
+	extractor := newCourseExtractor(ctx)
+	for i := range *report {
+		extractor.add(&(*report)[i])
+	}
+	return extractor.finish(len(*report))
+}
+
+// courseExtractor collects the courses of a report one row at a time, so
+// users and courses can be extracted in the same pass; see buildCourseIndex.
+type courseExtractor struct {
+	logger    *zap.Logger
+	courseMap map[string]client.Course
+}
+
+func newCourseExtractor(ctx context.Context) *courseExtractor {
+	return &courseExtractor{
+		logger:    logging.Extract(ctx),
+		courseMap: make(map[string]client.Course),
+	}
+}
+
+// add takes in a report row.
+func (e *courseExtractor) add(entry *client.ReportEntry) {
+	courseId := entry.ContentId
+
+	// Skip entries with empty contentId
+	if courseId == "" {
+		return
+	}
+
+	if _, exists := e.courseMap[courseId]; !exists {
+		e.courseMap[courseId] = client.Course{
+			Id:          courseId,
+			CourseTitle: entry.ContentTitle,
+			ContentType: entry.ContentType,
+		}
+	}
+}
+
+// finish returns the courses of the rows added, sorted by ID. rows is the
+// number of rows in the report, for logging.
+func (e *courseExtractor) finish(rows int) []client.Course {
+	courses := make([]client.Course, 0, len(e.courseMap))
+	for _, course := range e.courseMap {
+		courses = append(courses, course)
+	}
+	slices.SortFunc(courses, func(a, b client.Course) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	// Log deduplication statistics
+	totalDuplicates := rows - len(courses)
+	e.logger.Info("Course extraction completed",
+		zap.Int("total_report_entries", rows),
+		zap.Int("unique_courses", len(courses)),
+		zap.Int("duplicate_entries", totalDuplicates),
+		zap.Float64("deduplication_ratio", float64(totalDuplicates)/float64(rows)))
+
+	return courses
+}
+
+// List returns a page of the courses from the learning activity report,
+// ordered by course ID.
 func (o *courseBuilder) List(
 	ctx context.Context,
 	parentResourceID *v2.ResourceId,
-	_ *pagination.Token,
+	pToken *pagination.Token,
 ) (
 	[]*v2.Resource,
 	string,
 	annotations.Annotations,
 	error,
 ) {
-	logger := ctxzap.Extract(ctx)
+	logger := logging.Extract(ctx)
 	logger.Debug("Starting Courses List from Report Data")
 
 	outputResources := make([]*v2.Resource, 0)
@@ -81,28 +228,17 @@ func (o *courseBuilder) List(
 		return outputResources, "", outputAnnotations, nil
 	}
 
-	// Extract unique courses from report
-	courseMap := make(map[string]client.Course)
-	for _, entry := range *o.connector.report {
-		courseId := entry.ContentId
-
-		// Skip entries with empty contentId
-		if courseId == "" {
-			continue
-		}
-
-		if _, exists := courseMap[courseId]; !exists {
-			displayName := fmt.Sprintf("%s (%s)", entry.ContentTitle, entry.ContentType)
-
-			courseMap[courseId] = client.Course{
-				Id:          courseId,
-				CourseTitle: displayName,
-			}
-		}
+	courses, nextToken, err := paginate(
+		o.connector,
+		o.connector.index(ctx).courses,
+		func(course client.Course) string { return course.Id },
+		pToken,
+	)
+	if err != nil {
+		return nil, "", outputAnnotations, err
 	}
 
-	// Convert map to resources
-	for _, course := range courseMap {
+	for _, course := range courses {
 		courseResource0, err := courseResource(course, parentResourceID)
 		if err != nil {
 			return nil, "", outputAnnotations, err
@@ -110,20 +246,13 @@ func (o *courseBuilder) List(
 		outputResources = append(outputResources, courseResource0)
 	}
 
-	// Log deduplication statistics
-	totalDuplicates := len(*o.connector.report) - len(courseMap)
-	logger.Info("Course extraction completed",
-		zap.Int("total_report_entries", len(*o.connector.report)),
-		zap.Int("unique_courses", len(outputResources)),
-		zap.Int("duplicate_entries", totalDuplicates),
-		zap.Float64("deduplication_ratio", float64(totalDuplicates)/float64(len(*o.connector.report))))
-
-	// No pagination needed since we're returning all courses from the report
-	return outputResources, "", outputAnnotations, nil
+	return outputResources, nextToken, outputAnnotations, nil
 }
 
+// Entitlements returns the entitlements of a course: those granted on it, or
+// the configured list.
 func (o *courseBuilder) Entitlements(
-	_ context.Context,
+	ctx context.Context,
 	resource *v2.Resource,
 	_ *pagination.Token,
 ) (
@@ -132,83 +261,110 @@ func (o *courseBuilder) Entitlements(
 	annotations.Annotations,
 	error,
 ) {
-	return []*v2.Entitlement{
-		entitlement.NewAssignmentEntitlement(
-			resource,
-			assignedEntitlement,
-			entitlement.WithGrantableTo(userResourceType),
-			entitlement.WithDisplayName(fmt.Sprintf("Course %s %s", resource.DisplayName, assignedEntitlement)),
-			entitlement.WithDescription(fmt.Sprintf("Assigned course %s in Percipio", resource.DisplayName)),
-		),
-		entitlement.NewAssignmentEntitlement(
-			resource,
-			completedEntitlement,
-			entitlement.WithGrantableTo(userResourceType),
-			entitlement.WithDisplayName(fmt.Sprintf("Course %s %s", resource.DisplayName, completedEntitlement)),
-			entitlement.WithDescription(fmt.Sprintf("Completed course %s in Percipio", resource.DisplayName)),
-		),
-		entitlement.NewAssignmentEntitlement(
-			resource,
-			inProgressEntitlement,
-			entitlement.WithGrantableTo(userResourceType),
-			entitlement.WithDisplayName(fmt.Sprintf("Course %s %s", resource.DisplayName, inProgressEntitlement)),
-			entitlement.WithDescription(fmt.Sprintf("In progress course %s in Percipio", resource.DisplayName)),
-		),
-		entitlement.NewAssignmentEntitlement(
-			resource,
-			noStatusReportedEntitlement,
-			entitlement.WithGrantableTo(userResourceType),
-			entitlement.WithDisplayName(fmt.Sprintf("Course %s %s", resource.DisplayName, noStatusReportedEntitlement)),
-			entitlement.WithDescription(fmt.Sprintf("No status reported for course %s in Percipio", resource.DisplayName)),
-		),
-		entitlement.NewAssignmentEntitlement(
-			resource,
-			statusUndefinedEntitlement,
-			entitlement.WithGrantableTo(userResourceType),
-			entitlement.WithDisplayName(fmt.Sprintf("Course %s %s", resource.DisplayName, statusUndefinedEntitlement)),
-			entitlement.WithDescription(fmt.Sprintf("Status undefined for course %s in Percipio", resource.DisplayName)),
-		),
-	}, "", nil, nil
-}
-
-// Grants returns the grants for a course resource based on the pre-loaded report data.
+	slugs, err := o.courseEntitlementSlugs(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	entitlements := make([]*v2.Entitlement, 0, len(slugs))
+	for _, slug := range slugs {
+		entitlements = append(entitlements, o.connector.courseEntitlement(resource, slug))
+	}
+	return entitlements, "", nil, nil
+}
+
+// Grants returns a page of the grants for a course resource based on the
+// pre-loaded report data, ordered by user resource ID.
 func (o *courseBuilder) Grants(
 	ctx context.Context,
 	resource *v2.Resource,
-	_ *pagination.Token,
+	pToken *pagination.Token,
 ) (
 	[]*v2.Grant,
 	string,
 	annotations.Annotations,
 	error,
 ) {
-	logger := ctxzap.Extract(ctx)
+	logger := logging.Extract(ctx)
 	var outputAnnotations annotations.Annotations
 
-	// Report is already loaded during sync initialization
-	// Just get the status map for this course
-	statusesMap := o.client.StatusesStore.Get(resource.Id.Resource)
+	results := o.connector.assessmentResults(ctx, resource.Id.Resource)
+	assignments := o.connector.courseAssignments(ctx, resource.Id.Resource)
+	resourceIds, grantees, nextToken, err := o.courseGrantees(ctx, resource.Id.Resource, assignments, pToken)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
 
 	logger.Debug("Looking up grants for course",
 		zap.String("course_id", resource.Id.Resource),
 		zap.String("course_name", resource.DisplayName),
-		zap.Int("grant_count", len(statusesMap)))
+		zap.Int("assignment_count", len(assignments)),
+		zap.Int("page_principal_count", len(resourceIds)))
 
-	grants := make([]*v2.Grant, 0)
+	grants := make([]*v2.Grant, 0, len(resourceIds))
 	statusCounts := make(map[string]int)
+	// Only entitlements the course publishes are granted, so a configured
+	// list leaves out grants for the entitlements it doesn't name. Without
+	// one, the course publishes everything granted on it.
+	var published []string
+	if len(o.connector.entitlementOptions().Entitlements) > 0 {
+		published, err = o.courseEntitlementSlugs(ctx, resource.Id.Resource)
+		if err != nil {
+			return nil, "", outputAnnotations, err
+		}
+	}
+	now := time.Now()
 
-	for userId, status := range statusesMap {
-		principalId, err := resourceSdk.NewResourceID(userResourceType, userId)
+	for _, resourceId := range resourceIds {
+		principalId, err := resourceSdk.NewResourceID(userResourceType, resourceId)
 		if err != nil {
 			logger.Error("Failed to create principal ID",
 				zap.Error(err),
-				zap.String("user_id", userId),
+				zap.String("user_id", resourceId),
 				zap.String("course_id", resource.Id.Resource))
 			return nil, "", outputAnnotations, err
 		}
-		nextGrant := grant.NewGrant(resource, status, principalId)
-		grants = append(grants, nextGrant)
-		statusCounts[status]++
+		granted := make(map[string]bool)
+		grantable := func(slug string) bool {
+			if (published != nil && !slices.Contains(published, slug)) || granted[slug] {
+				return false
+			}
+			granted[slug] = true
+			return true
+		}
+
+		for _, g := range grantees[resourceId] {
+			userId, status := g.userId, g.status
+			if g.hasStatus && grantable(status) {
+				grants = append(grants, grant.NewGrant(resource, status, principalId))
+				statusCounts[status]++
+			}
+
+			if o.connector.everCompleted(resource.Id.Resource, userId) && grantable(everCompletedEntitlement) {
+				grants = append(grants, everCompletedGrant(resource, principalId, o.client.StatusHistory, userId))
+				statusCounts[everCompletedEntitlement]++
+			}
+
+			if result, ok := results[userId]; ok {
+				outcomeGrant, outcome := o.connector.assessmentOptions().assessmentGrant(resource, principalId, result)
+				if grantable(outcome) {
+					grants = append(grants, outcomeGrant)
+					statusCounts[outcome]++
+				}
+			}
+
+			if assignment, ok := assignments[userId]; ok {
+				slugs := []string{assignedEntitlement}
+				if isOverdue(assignment, status, now) {
+					slugs = append(slugs, overdueEntitlement)
+				}
+				for _, slug := range slugs {
+					if grantable(slug) {
+						grants = append(grants, assignmentGrant(resource, slug, principalId, assignment))
+						statusCounts[slug]++
+					}
+				}
+			}
+		}
 	}
 
 	if len(grants) > 0 {
@@ -218,7 +374,152 @@ func (o *courseBuilder) Grants(
 			zap.Any("status_distribution", statusCounts))
 	}
 
-	return grants, "", outputAnnotations, nil
+	return grants, nextToken, outputAnnotations, nil
+}
+
+// grantee is a Percipio user granted something on a course, with their
+// status on it if they have one.
+type grantee struct {
+	userId    string
+	status    string
+	hasStatus bool
+}
+
+// courseGrantees returns the page of user resource IDs to grant on a course
+// after the page token, the users behind each, ordered by Percipio user ID,
+// and the token for the next page. Users are those with a status on the
+// course and published assigned learners.
+//
+// Percipio users sharing an identifier share grants too, so pages are made
+// of user resource IDs: all the Percipio users behind a principal land on the
+// same page, and their grants are deduplicated there. When user resource IDs
+// are Percipio user IDs, the page is read from the statuses store starting
+// at the token; otherwise every user of the course is read to group them.
+func (o *courseBuilder) courseGrantees(
+	ctx context.Context,
+	courseId string,
+	assignments map[string]client.Assignment,
+	pToken *pagination.Token,
+) ([]string, map[string][]grantee, string, error) {
+	grantees := make(map[string][]grantee)
+	if o.connector == nil || o.connector.identity.usesPercipioId() {
+		after, size, err := o.connector.pageBounds(pToken)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		// One more than a page is read, so the last one bounds the
+		// assigned learners that can be on this page.
+		var userIds []string
+		err = o.client.StatusesStore.Statuses(courseId, after, func(userId string, status string) bool {
+			grantees[userId] = []grantee{{userId: userId, status: status, hasStatus: true}}
+			userIds = append(userIds, userId)
+			return len(userIds) <= size
+		})
+		if err != nil {
+			return nil, nil, "", err
+		}
+		bounded := len(userIds) > size
+		for userId := range assignments {
+			if userId <= after || (bounded && userId > userIds[len(userIds)-1]) {
+				continue
+			}
+			if _, ok := grantees[userId]; ok || !o.connector.publishedUser(ctx, userId) {
+				continue
+			}
+			grantees[userId] = []grantee{{userId: userId}}
+			userIds = append(userIds, userId)
+		}
+		slices.Sort(userIds)
+		if len(userIds) <= size {
+			return userIds, grantees, "", nil
+		}
+		nextToken, err := o.connector.nextPageToken(userIds[size-1])
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return userIds[:size], grantees, nextToken, nil
+	}
+
+	add := func(g grantee) {
+		resourceId, ok := o.connector.userResourceId(ctx, g.userId)
+		if !ok {
+			return
+		}
+		// Assigned learners without activity are only granted if published.
+		if !g.hasStatus && !o.connector.publishedUser(ctx, resourceId) {
+			return
+		}
+		grantees[resourceId] = append(grantees[resourceId], g)
+	}
+	withStatus := make(map[string]bool)
+	err := o.client.StatusesStore.Statuses(courseId, "", func(userId string, status string) bool {
+		if _, ok := assignments[userId]; ok {
+			withStatus[userId] = true
+		}
+		add(grantee{userId: userId, status: status, hasStatus: true})
+		return true
+	})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	for _, userId := range slices.Sorted(maps.Keys(assignments)) {
+		if !withStatus[userId] {
+			add(grantee{userId: userId})
+		}
+	}
+	for _, users := range grantees {
+		slices.SortFunc(users, func(a, b grantee) int {
+			return strings.Compare(a.userId, b.userId)
+		})
+	}
+
+	resourceIds := slices.Sorted(maps.Keys(grantees))
+	resourceIds, nextToken, err := paginate(o.connector, resourceIds, func(resourceId string) string { return resourceId }, pToken)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return resourceIds, grantees, nextToken, nil
+}
+
+// Get returns a single course by ID. Once a report is loaded the answer comes
+// from the report index, so Get and List agree; before that the course is
+// looked up in the Percipio catalog.
+func (o *courseBuilder) Get(
+	ctx context.Context,
+	resourceId *v2.ResourceId,
+	parentResourceId *v2.ResourceId,
+) (
+	*v2.Resource,
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	var course *client.Course
+	if o.connector.reportLoaded() {
+		if indexed, ok := o.connector.index(ctx).course(resourceId.Resource); ok {
+			course = &indexed
+		}
+	} else {
+		found, ratelimitData, err := o.client.GetCourse(ctx, resourceId.Resource)
+		if ratelimitData != nil {
+			outputAnnotations.WithRateLimiting(ratelimitData)
+		}
+		if err != nil {
+			return nil, outputAnnotations, toGRPCError(err)
+		}
+		course = found
+	}
+
+	if course == nil {
+		return nil, outputAnnotations, status.Errorf(codes.NotFound, "course %s not found", resourceId.Resource)
+	}
+
+	resource, err := courseResource(*course, parentResourceId)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+	return resource, outputAnnotations, nil
 }
 
 func newCourseBuilder(client *client.Client, report *client.Report, connector *Connector) *courseBuilder {
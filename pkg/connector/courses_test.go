@@ -2,16 +2,21 @@ package connector
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/iiiatthew/baton-percipio-report/pkg/client"
 	"github.com/iiiatthew/baton-percipio-report/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestCoursesList(t *testing.T) {
@@ -77,6 +82,31 @@ func TestCoursesList(t *testing.T) {
 		assert.Equal(t, "Advanced Go Patterns (Assessment)", course2.DisplayName)
 	})
 
+	t.Run("should paginate courses in ID order", func(t *testing.T) {
+		connector := &Connector{
+			reportState: ReportCompleted,
+			pageSize:    1,
+			report: &client.Report{
+				{UserId: "michael.bolton@initech.com", ContentId: "course_b", ContentTitle: "B", ContentType: "Course"},
+				{UserId: "michael.bolton@initech.com", ContentId: "course_a", ContentTitle: "A", ContentType: "Course"},
+				{UserId: "milton.waddams@initech.com", ContentId: "course_b", ContentTitle: "B", ContentType: "Course"},
+			},
+		}
+		c := newCourseBuilder(nil, nil, connector)
+
+		firstPage, nextToken, _, err := c.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, firstPage, 1)
+		assert.Equal(t, "course_a", firstPage[0].Id.Resource)
+		assert.Equal(t, "course_a", pageKey(t, connector, nextToken))
+
+		secondPage, nextToken, _, err := c.List(ctx, nil, &pagination.Token{Token: nextToken})
+		require.NoError(t, err)
+		require.Len(t, secondPage, 1)
+		assert.Equal(t, "course_b", secondPage[0].Id.Resource)
+		assert.Empty(t, nextToken)
+	})
+
 	t.Run("should handle missing contentId", func(t *testing.T) {
 		connector := &Connector{
 			reportState: ReportCompleted,
@@ -161,10 +191,25 @@ func TestCoursesList(t *testing.T) {
 	})
 }
 
+// entitlementSlugs returns the slugs of entitlements, in order.
+func entitlementSlugs(entitlements []*v2.Entitlement) []string {
+	slugs := make([]string, len(entitlements))
+	for i, ent := range entitlements {
+		slugs[i] = ent.Slug
+	}
+	return slugs
+}
+
 func TestCoursesEntitlements(t *testing.T) {
 	ctx := context.Background()
 
-	c := newCourseBuilder(nil, nil, nil)
+	statusStore := client.MapStatusesStore{
+		"bs_adg02_a23_enus": {
+			"michael.bolton@initech.com": "completed",
+			"milton.waddams@initech.com": "status_undefined",
+			"peter.gibbons@initech.com":  "completed",
+		},
+	}
 	course := &v2.Resource{
 		DisplayName: "Case Studies: Successful Data Privacy Implementations (Course)",
 		Id: &v2.ResourceId{
@@ -173,29 +218,57 @@ func TestCoursesEntitlements(t *testing.T) {
 		},
 	}
 
-	entitlements, nextToken, annotations, err := c.Entitlements(ctx, course, &pagination.Token{})
+	t.Run("should only have entitlements for statuses learners have", func(t *testing.T) {
+		c := newCourseBuilder(&client.Client{StatusesStore: statusStore}, nil, nil)
 
-	require.NoError(t, err)
-	assert.Empty(t, nextToken)
-	assert.Nil(t, annotations)
-	require.Len(t, entitlements, 5)
+		entitlements, nextToken, annotations, err := c.Entitlements(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		assert.Empty(t, nextToken)
+		assert.Nil(t, annotations)
+		assert.Equal(t, []string{"completed", "status_undefined"}, entitlementSlugs(entitlements))
+		assert.Equal(t, "Course Case Studies: Successful Data Privacy Implementations (Course) completed", entitlements[0].DisplayName)
+		assert.Equal(t, "Completed course Case Studies: Successful Data Privacy Implementations (Course) in Percipio", entitlements[0].Description)
 
-	entitlementSlugs := make([]string, len(entitlements))
-	for i, ent := range entitlements {
-		entitlementSlugs[i] = ent.Slug
-	}
-	assert.Contains(t, entitlementSlugs, "assigned")
-	assert.Contains(t, entitlementSlugs, "completed")
-	assert.Contains(t, entitlementSlugs, "in_progress")
-	assert.Contains(t, entitlementSlugs, "no_status_reported")
-	assert.Contains(t, entitlementSlugs, "status_undefined")
+		empty := &v2.Resource{DisplayName: "Empty", Id: &v2.ResourceId{ResourceType: "course", Resource: "empty-course"}}
+		entitlements, _, _, err = c.Entitlements(ctx, empty, &pagination.Token{})
+		require.NoError(t, err)
+		assert.Empty(t, entitlements)
+	})
+
+	t.Run("should publish the configured entitlements with templated names", func(t *testing.T) {
+		options := EntitlementOptions{
+			Entitlements:        []string{"in_progress", "completed", "passed"},
+			DisplayNameTemplate: "{{.Course}}: {{.Entitlement}}",
+			DescriptionTemplate: "{{.Description}} ({{.CourseId}})",
+		}
+		templates, err := options.templates()
+		require.NoError(t, err)
+		connector := &Connector{entitlements: options, entitlementTemplates: templates}
+		c := newCourseBuilder(&client.Client{StatusesStore: statusStore}, nil, connector)
+
+		entitlements, _, _, err := c.Entitlements(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		// Passed is only for assessments.
+		assert.Equal(t, []string{"completed", "in_progress"}, entitlementSlugs(entitlements))
+		assert.Equal(t, "Case Studies: Successful Data Privacy Implementations (Course): in_progress", entitlements[1].DisplayName)
+		assert.Equal(t, "In progress course Case Studies: Successful Data Privacy Implementations (Course) in Percipio (bs_adg02_a23_enus)", entitlements[1].Description)
+	})
+
+	t.Run("should reject invalid entitlement options", func(t *testing.T) {
+		_, err := EntitlementOptions{Entitlements: []string{"enrolled"}}.templates()
+		assert.ErrorContains(t, err, "enrolled")
+		_, err = EntitlementOptions{DisplayNameTemplate: "{{.Course"}.templates()
+		assert.ErrorContains(t, err, "display name")
+		_, err = EntitlementOptions{DescriptionTemplate: "{{.Title}}"}.templates()
+		assert.ErrorContains(t, err, "description")
+	})
 }
 
 func TestCoursesGrants(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("should return grants for course", func(t *testing.T) {
-		statusStore := make(client.StatusesStore)
+		statusStore := make(client.MapStatusesStore)
 		statusStore["bs_adg02_a23_enus"] = map[string]string{
 			"michael.bolton@initech.com": "completed",
 			"milton.waddams@initech.com": "in_progress",
@@ -238,9 +311,95 @@ func TestCoursesGrants(t *testing.T) {
 		assert.Equal(t, "status_undefined", grantsByUser["bill.lumbergh@initech.com"])
 	})
 
+	t.Run("should paginate grants in user ID order", func(t *testing.T) {
+		statusStore := make(client.MapStatusesStore)
+		statusStore["bs_adg02_a23_enus"] = map[string]string{
+			"michael.bolton@initech.com": "completed",
+			"milton.waddams@initech.com": "in_progress",
+			"peter.gibbons@initech.com":  "no_status_reported",
+			"bill.lumbergh@initech.com":  "status_undefined",
+		}
+
+		c := newCourseBuilder(&client.Client{StatusesStore: statusStore}, nil, &Connector{pageSize: 3})
+		course := &v2.Resource{
+			DisplayName: "Case Studies: Successful Data Privacy Implementations (Course)",
+			Id: &v2.ResourceId{
+				ResourceType: "course",
+				Resource:     "bs_adg02_a23_enus",
+			},
+		}
+
+		firstPage, nextToken, _, err := c.Grants(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, firstPage, 3)
+		assert.Equal(t, "milton.waddams@initech.com", pageKey(t, c.connector, nextToken))
+
+		secondPage, nextToken, _, err := c.Grants(ctx, course, &pagination.Token{Token: nextToken})
+		require.NoError(t, err)
+		require.Len(t, secondPage, 1)
+		assert.Empty(t, nextToken)
+
+		var principals []string
+		for _, grant := range append(firstPage, secondPage...) {
+			principals = append(principals, grant.Principal.Id.Resource)
+		}
+		assert.Equal(t, []string{
+			"bill.lumbergh@initech.com",
+			"michael.bolton@initech.com",
+			"milton.waddams@initech.com",
+			"peter.gibbons@initech.com",
+		}, principals)
+	})
+
+	t.Run("should only grant the configured entitlements", func(t *testing.T) {
+		statusStore := client.MapStatusesStore{
+			"bs_adg02_a23_enus": {
+				"michael.bolton@initech.com": "completed",
+				"milton.waddams@initech.com": "in_progress",
+				"peter.gibbons@initech.com":  "no_status_reported",
+			},
+		}
+		options := EntitlementOptions{Entitlements: []string{"completed", "in_progress"}}
+		templates, err := options.templates()
+		require.NoError(t, err)
+		connector := &Connector{entitlements: options, entitlementTemplates: templates}
+		c := newCourseBuilder(&client.Client{StatusesStore: statusStore}, nil, connector)
+		course := &v2.Resource{
+			DisplayName: "Case Studies: Successful Data Privacy Implementations (Course)",
+			Id: &v2.ResourceId{
+				ResourceType: "course",
+				Resource:     "bs_adg02_a23_enus",
+			},
+		}
+
+		entitlements, _, _, err := c.Entitlements(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		published := make(map[string]bool)
+		for _, e := range entitlements {
+			published[e.Id] = true
+		}
+
+		grants, _, _, err := c.Grants(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 2)
+		for _, g := range grants {
+			assert.True(t, published[g.Entitlement.Id], g.Entitlement.Id)
+		}
+	})
+
+	t.Run("should fail when statuses can't be read", func(t *testing.T) {
+		c := newCourseBuilder(&client.Client{StatusesStore: failingStatusesStore{}}, nil, nil)
+		course := &v2.Resource{Id: &v2.ResourceId{ResourceType: "course", Resource: "bs_adg02_a23_enus"}}
+
+		_, _, _, err := c.Grants(ctx, course, &pagination.Token{})
+		assert.ErrorIs(t, err, errStatusesUnreadable)
+		_, _, _, err = c.Entitlements(ctx, course, &pagination.Token{})
+		assert.ErrorIs(t, err, errStatusesUnreadable)
+	})
+
 	t.Run("should handle course with no grants", func(t *testing.T) {
 		percipioClient := &client.Client{
-			StatusesStore: make(client.StatusesStore),
+			StatusesStore: make(client.MapStatusesStore),
 		}
 
 		c := newCourseBuilder(percipioClient, nil, nil)
@@ -285,4 +444,152 @@ func TestCourseResource(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "", resource.DisplayName)
 	})
+
+	t.Run("should carry a profile with report and catalog metadata", func(t *testing.T) {
+		course := client.Course{
+			Id:          "bs_adg02_a23_enus",
+			CourseTitle: "Case Studies: Successful Data Privacy Implementations",
+			ContentType: "Course",
+			Duration:    "PT25M3S",
+			Provider:    "Skillsoft",
+			Description: "Explore real-world data privacy programs.",
+		}
+
+		resource, err := courseResource(course, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Case Studies: Successful Data Privacy Implementations (Course)", resource.DisplayName)
+		assert.Equal(t, "Explore real-world data privacy programs.", resource.Description)
+
+		appTrait, err := resourceSdk.GetAppTrait(resource)
+		require.NoError(t, err)
+		profile := appTrait.Profile.AsMap()
+		assert.Equal(t, "bs_adg02_a23_enus", profile["id"])
+		assert.Equal(t, "Case Studies: Successful Data Privacy Implementations", profile["title"])
+		assert.Equal(t, "Course", profile["content_type"])
+		assert.Equal(t, "en-US", profile["locale"])
+		assert.Equal(t, "en", profile["language"])
+		assert.Equal(t, "PT25M3S", profile["duration"])
+		assert.Equal(t, "Skillsoft", profile["provider"])
+	})
+
+	t.Run("should flag retired courses and list localized titles", func(t *testing.T) {
+		course := client.Course{
+			Id:                    "it_sdgo01_a01_enus",
+			CourseTitle:           "Secure Development",
+			ContentType:           "Course",
+			Status:                client.CatalogStatusRetired,
+			PlannedRetirementDate: "2025-01-31",
+			LocalizedTitles:       map[string]string{"en-US": "Secure Development", "fr-FR": "Développement sécurisé"},
+		}
+
+		resource, err := courseResource(course, nil)
+		require.NoError(t, err)
+
+		appTrait, err := resourceSdk.GetAppTrait(resource)
+		require.NoError(t, err)
+		profile := appTrait.Profile.AsMap()
+		assert.Equal(t, "RETIRED", profile["status"])
+		assert.Equal(t, true, profile["retired"])
+		assert.Equal(t, "2025-01-31T00:00:00Z", profile["planned_retirement_date"])
+		assert.Equal(t, map[string]interface{}{"en-US": "Secure Development", "fr-FR": "Développement sécurisé"}, profile["localized_titles"])
+	})
+
+	t.Run("should leave out metadata that isn't known", func(t *testing.T) {
+		course := client.Course{
+			Id:          "3b6e1f8c-8d1a-4c55-9a3e-6a1f0d2c7b11",
+			CourseTitle: "Advanced Go Patterns",
+			ContentType: "Assessment",
+		}
+
+		resource, err := courseResource(course, nil)
+		require.NoError(t, err)
+
+		appTrait, err := resourceSdk.GetAppTrait(resource)
+		require.NoError(t, err)
+		profile := appTrait.Profile.AsMap()
+		assert.Equal(t, "Assessment", profile["content_type"])
+		assert.NotContains(t, profile, "locale")
+		assert.NotContains(t, profile, "duration")
+		assert.NotContains(t, profile, "provider")
+		assert.NotContains(t, profile, "description")
+	})
+}
+
+func TestLocaleFromContentId(t *testing.T) {
+	testCases := []struct {
+		contentId string
+		expected  string
+	}{
+		{"bs_adg02_a23_enus", "en-US"},
+		{"it_sdgo01_a01_frfr", "fr-FR"},
+		{"it_sdgo01_a01_ptbr", "pt-BR"},
+		{"it_sdgo01_a01", ""},
+		{"it_sdgo01_a01_en", ""},
+		{"it_sdgo01_a01_EnUs", ""},
+		{"3b6e1f8c-8d1a-4c55-9a3e-6a1f0d2c7b11", ""},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.contentId, func(t *testing.T) {
+			assert.Equal(t, tc.expected, localeFromContentId(tc.contentId))
+		})
+	}
+}
+
+func TestCoursesGet(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should answer from the loaded report", func(t *testing.T) {
+		connector := &Connector{
+			reportState: ReportCompleted,
+			report: &client.Report{
+				{
+					UserId:       "michael.bolton@initech.com",
+					ContentId:    "bs_adg02_a23_enus",
+					ContentTitle: "Case Studies: Successful Data Privacy Implementations",
+					ContentType:  "Course",
+					Status:       "Completed",
+				},
+			},
+		}
+		c := newCourseBuilder(nil, nil, connector)
+
+		resource, _, err := c.Get(ctx, &v2.ResourceId{ResourceType: "course", Resource: "bs_adg02_a23_enus"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Case Studies: Successful Data Privacy Implementations (Course)", resource.DisplayName)
+
+		_, _, err = c.Get(ctx, &v2.ResourceId{ResourceType: "course", Resource: "missing"}, nil)
+		require.Error(t, err)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("should look up the course when no report is loaded", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if !strings.HasSuffix(r.URL.Path, "/catalog-content/bs_adg02_a23_enus") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{
+				"code": "bs_adg02_a23_enus",
+				"contentType": {"displayLabel": "Course"},
+				"localizedMetadata": [{"localeCode": "en-US", "title": "Case Studies: Successful Data Privacy Implementations"}]
+			}`))
+		}))
+		defer server.Close()
+
+		percipioClient, err := client.New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		c := newCourseBuilder(percipioClient, nil, &Connector{client: percipioClient})
+
+		resource, _, err := c.Get(ctx, &v2.ResourceId{ResourceType: "course", Resource: "bs_adg02_a23_enus"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Case Studies: Successful Data Privacy Implementations (Course)", resource.DisplayName)
+
+		_, _, err = c.Get(ctx, &v2.ResourceId{ResourceType: "course", Resource: "missing"}, nil)
+		require.Error(t, err)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
 }
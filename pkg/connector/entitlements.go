@@ -0,0 +1,240 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+)
+
+const (
+	// DefaultEntitlementDisplayName is the default template for course
+	// entitlement display names.
+	DefaultEntitlementDisplayName = "Course {{.Course}} {{.Entitlement}}"
+	// DefaultEntitlementDescription is the default template for course
+	// entitlement descriptions.
+	DefaultEntitlementDescription = "{{.Description}}"
+)
+
+// CourseEntitlements lists every course entitlement, in the order they are
+// published.
+var CourseEntitlements = []string{
+	assignedEntitlement,
+	completedEntitlement,
+	everCompletedEntitlement,
+	inProgressEntitlement,
+	noStatusReportedEntitlement,
+	statusUndefinedEntitlement,
+	overdueEntitlement,
+	passedEntitlement,
+	failedEntitlement,
+}
+
+// entitlementDescriptions are the built-in descriptions of the course
+// entitlements, formatted with the course display name.
+var entitlementDescriptions = map[string]string{
+	assignedEntitlement:         "Assigned course %s in Percipio",
+	completedEntitlement:        "Completed course %s in Percipio",
+	everCompletedEntitlement:    "Completed course %s in Percipio at least once",
+	inProgressEntitlement:       "In progress course %s in Percipio",
+	noStatusReportedEntitlement: "No status reported for course %s in Percipio",
+	statusUndefinedEntitlement:  "Status undefined for course %s in Percipio",
+	overdueEntitlement:          "Overdue assignment of course %s in Percipio",
+	passedEntitlement:           "Passed assessment %s in Percipio",
+	failedEntitlement:           "Failed assessment %s in Percipio",
+}
+
+// EntitlementOptions controls which entitlements courses have and how they
+// are named.
+type EntitlementOptions struct {
+	// Entitlements, when set, are published for every course, whether or
+	// not they are granted. Passed and failed are only published for
+	// assessments. When empty, each course only has the entitlements that
+	// are granted on it.
+	Entitlements []string
+	// DisplayNameTemplate and DescriptionTemplate are text/template
+	// templates for entitlement display names and descriptions. They are
+	// given .Course (the course display name), .CourseId, .Entitlement
+	// (e.g. in_progress) and .Description (the built-in description).
+	// Empty means DefaultEntitlementDisplayName and
+	// DefaultEntitlementDescription.
+	DisplayNameTemplate string
+	DescriptionTemplate string
+}
+
+// entitlementTemplateData is what entitlement templates are executed with.
+type entitlementTemplateData struct {
+	Course      string
+	CourseId    string
+	Entitlement string
+	Description string
+}
+
+// entitlementTemplates are the parsed entitlement templates.
+type entitlementTemplates struct {
+	displayName *template.Template
+	description *template.Template
+}
+
+var defaultEntitlementTemplates = &entitlementTemplates{
+	displayName: template.Must(parseEntitlementTemplate("display name", DefaultEntitlementDisplayName)),
+	description: template.Must(parseEntitlementTemplate("description", DefaultEntitlementDescription)),
+}
+
+func parseEntitlementTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Parse(text)
+}
+
+// templates parses and checks the configured templates.
+func (o EntitlementOptions) templates() (*entitlementTemplates, error) {
+	for _, slug := range o.Entitlements {
+		if !slices.Contains(CourseEntitlements, slug) {
+			return nil, fmt.Errorf("invalid course entitlement %q: expected one of %v", slug, CourseEntitlements)
+		}
+	}
+
+	templates := *defaultEntitlementTemplates
+	for _, t := range []struct {
+		name   string
+		text   string
+		target **template.Template
+	}{
+		{"display name", o.DisplayNameTemplate, &templates.displayName},
+		{"description", o.DescriptionTemplate, &templates.description},
+	} {
+		if t.text == "" {
+			continue
+		}
+		parsed, err := parseEntitlementTemplate(t.name, t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entitlement %s template: %w", t.name, err)
+		}
+		// Execute once so unknown fields are caught at startup.
+		if err := parsed.Execute(&strings.Builder{}, entitlementTemplateData{}); err != nil {
+			return nil, fmt.Errorf("invalid entitlement %s template: %w", t.name, err)
+		}
+		*t.target = parsed
+	}
+	return &templates, nil
+}
+
+// renderEntitlementTemplate executes a template, falling back to the default
+// one if it fails.
+func renderEntitlementTemplate(tmpl *template.Template, fallback *template.Template, data entitlementTemplateData) string {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err == nil {
+		return out.String()
+	}
+	out.Reset()
+	_ = fallback.Execute(&out, data)
+	return out.String()
+}
+
+// courseEntitlement returns a course entitlement named by the configured
+// templates.
+func (d *Connector) courseEntitlement(resource *v2.Resource, slug string) *v2.Entitlement {
+	templates := defaultEntitlementTemplates
+	if d != nil && d.entitlementTemplates != nil {
+		templates = d.entitlementTemplates
+	}
+
+	data := entitlementTemplateData{
+		Course:      resource.DisplayName,
+		CourseId:    resource.Id.Resource,
+		Entitlement: slug,
+		Description: fmt.Sprintf(entitlementDescriptions[slug], resource.DisplayName),
+	}
+	return entitlement.NewAssignmentEntitlement(
+		resource,
+		slug,
+		entitlement.WithGrantableTo(userResourceType),
+		entitlement.WithDisplayName(renderEntitlementTemplate(templates.displayName, defaultEntitlementTemplates.displayName, data)),
+		entitlement.WithDescription(renderEntitlementTemplate(templates.description, defaultEntitlementTemplates.description, data)),
+	)
+}
+
+// courseEntitlementSlugs returns the entitlements of a course: the configured
+// ones, or otherwise the ones granted on it.
+func (o *courseBuilder) courseEntitlementSlugs(ctx context.Context, courseId string) ([]string, error) {
+	if configured := o.connector.entitlementOptions().Entitlements; len(configured) > 0 {
+		assessment := o.connector.isAssessment(ctx, courseId)
+		slugs := make([]string, 0, len(configured))
+		for _, slug := range CourseEntitlements {
+			if !slices.Contains(configured, slug) {
+				continue
+			}
+			if (slug == passedEntitlement || slug == failedEntitlement) && !assessment {
+				continue
+			}
+			slugs = append(slugs, slug)
+		}
+		return slugs, nil
+	}
+
+	granted := make(map[string]bool)
+	now := time.Now()
+	assignments := o.connector.courseAssignments(ctx, courseId)
+	// assignedWithStatus are the assigned users the scan saw.
+	assignedWithStatus := make(map[string]bool)
+	if o.client != nil {
+		err := o.client.StatusesStore.Statuses(courseId, "", func(userId string, status string) bool {
+			granted[status] = true
+			if !granted[everCompletedEntitlement] && o.connector.everCompleted(courseId, userId) {
+				granted[everCompletedEntitlement] = true
+			}
+			if assignment, ok := assignments[userId]; ok {
+				assignedWithStatus[userId] = true
+				if isOverdue(assignment, status, now) {
+					granted[overdueEntitlement] = true
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(assignments) > 0 {
+		granted[assignedEntitlement] = true
+	}
+	// Assigned learners without a status can be overdue too.
+	if !granted[overdueEntitlement] {
+		for userId, assignment := range assignments {
+			if !assignedWithStatus[userId] && isOverdue(assignment, "", now) {
+				granted[overdueEntitlement] = true
+				break
+			}
+		}
+	}
+
+	passScore := o.connector.assessmentOptions().passScore()
+	for _, result := range o.connector.assessmentResults(ctx, courseId) {
+		if result.Passed(passScore) {
+			granted[passedEntitlement] = true
+		} else {
+			granted[failedEntitlement] = true
+		}
+	}
+
+	slugs := make([]string, 0, len(granted))
+	for _, slug := range CourseEntitlements {
+		if granted[slug] {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs, nil
+}
+
+// entitlementOptions returns the entitlement configuration.
+func (d *Connector) entitlementOptions() EntitlementOptions {
+	if d == nil {
+		return EntitlementOptions{}
+	}
+	return d.entitlements
+}
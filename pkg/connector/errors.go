@@ -0,0 +1,69 @@
+package connector
+
+import (
+	"errors"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcError carries a gRPC status for a classified client error while keeping
+// the original error chain intact for errors.Is/errors.As.
+type grpcError struct {
+	status *status.Status
+	err    error
+}
+
+func (e *grpcError) Error() string {
+	return e.err.Error()
+}
+
+func (e *grpcError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+func (e *grpcError) Unwrap() error {
+	return e.err
+}
+
+// toGRPCError converts errors classified by the client into gRPC status
+// errors, so the SDK retries outages (Unavailable, DeadlineExceeded) and
+// surfaces credential problems (Unauthenticated, PermissionDenied) instead of
+// treating everything as Unknown. Unclassified errors are returned unchanged.
+func toGRPCError(err error) error {
+	var clientErr *client.Error
+	if err == nil || !errors.As(err, &clientErr) {
+		return err
+	}
+
+	var code codes.Code
+	switch {
+	case errors.Is(clientErr.Kind, client.ErrUnauthenticated):
+		code = codes.Unauthenticated
+	case errors.Is(clientErr.Kind, client.ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(clientErr.Kind, client.ErrOrganizationNotFound):
+		code = codes.NotFound
+	case errors.Is(clientErr.Kind, client.ErrRateLimited),
+		errors.Is(clientErr.Kind, client.ErrUpstreamUnavailable):
+		code = codes.Unavailable
+	case errors.Is(clientErr.Kind, client.ErrReportTimedOut):
+		code = codes.DeadlineExceeded
+	case errors.Is(clientErr.Kind, client.ErrReportFailed):
+		code = codes.Aborted
+	default:
+		return err
+	}
+
+	st := status.New(code, err.Error())
+	if clientErr.RateLimit != nil {
+		// The SDK's retryer reads the reset time from this detail.
+		if withDetails, detailErr := st.WithDetails(clientErr.RateLimit); detailErr == nil {
+			st = withDetails
+		}
+	}
+
+	return &grpcError{status: st, err: err}
+}
@@ -0,0 +1,58 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToGRPCError(t *testing.T) {
+	testCases := []struct {
+		kind     error
+		expected codes.Code
+	}{
+		{client.ErrUnauthenticated, codes.Unauthenticated},
+		{client.ErrForbidden, codes.PermissionDenied},
+		{client.ErrOrganizationNotFound, codes.NotFound},
+		{client.ErrRateLimited, codes.Unavailable},
+		{client.ErrUpstreamUnavailable, codes.Unavailable},
+		{client.ErrReportTimedOut, codes.DeadlineExceeded},
+		{client.ErrReportFailed, codes.Aborted},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.kind.Error(), func(t *testing.T) {
+			clientErr := &client.Error{Kind: tc.kind, Err: errors.New("cause")}
+			err := toGRPCError(fmt.Errorf("failed to generate learning activity report: %w", clientErr))
+
+			assert.Equal(t, tc.expected, status.Code(err))
+			assert.ErrorIs(t, err, tc.kind)
+			assert.Contains(t, err.Error(), "failed to generate learning activity report")
+		})
+	}
+
+	t.Run("should attach rate limit details", func(t *testing.T) {
+		rateLimit := &v2.RateLimitDescription{Limit: 10, Status: v2.RateLimitDescription_STATUS_OVERLIMIT}
+		err := toGRPCError(&client.Error{Kind: client.ErrRateLimited, RateLimit: rateLimit, Err: errors.New("429")})
+
+		st, ok := status.FromError(err)
+		require.True(t, ok)
+		require.Len(t, st.Details(), 1)
+		detail, ok := st.Details()[0].(*v2.RateLimitDescription)
+		require.True(t, ok)
+		assert.Equal(t, int64(10), detail.Limit)
+	})
+
+	t.Run("should leave unclassified errors unchanged", func(t *testing.T) {
+		plain := errors.New("plain")
+		assert.Equal(t, plain, toGRPCError(plain))
+		assert.Nil(t, toGRPCError(nil))
+	})
+}
@@ -0,0 +1,388 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	completionFeedId       = "percipio_course_completions"
+	statusSnapshotStateKey = "status-snapshot"
+	statusChangesStateKey  = "status-changes"
+	defaultEventsPageSize  = 100
+	eventCursorSeparator   = "/"
+)
+
+// statusSnapshot is the statuses store of the last fresh report, kept on
+// disk so the next sync can tell which statuses changed in between.
+type statusSnapshot struct {
+	RecordedAt time.Time               `json:"recorded_at"`
+	Statuses   client.MapStatusesStore `json:"statuses"`
+}
+
+// statusChange is a user whose status on a course differs from the previous
+// snapshot. Previous is empty when the user had no status on the course.
+type statusChange struct {
+	CourseId   string    `json:"course_id"`
+	UserId     string    `json:"user_id"`
+	Previous   string    `json:"previous,omitempty"`
+	Current    string    `json:"current"`
+	OccurredAt time.Time `json:"occurred_at"`
+
+	// User and Course are what the change is published against, resolved
+	// when it is recorded so the feed can serve it once the report is
+	// released.
+	User   *client.User   `json:"user,omitempty"`
+	Course *client.Course `json:"course,omitempty"`
+}
+
+// diffStatuses returns the changes from previous to current, ordered by course
+// and user ID. Users who only appear in previous have aged out of the report
+// window rather than lost anything, so they produce no change.
+func diffStatuses(previous client.MapStatusesStore, current client.StatusesStore) ([]statusChange, error) {
+	courses, err := current.Courses()
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]statusChange, 0)
+	for _, courseId := range slices.Sorted(courses) {
+		previousStatuses := previous[courseId]
+		err := current.Statuses(courseId, "", func(userId string, status string) bool {
+			if previousStatus := previousStatuses[userId]; previousStatus != status {
+				changes = append(changes, statusChange{
+					CourseId: courseId,
+					UserId:   userId,
+					Previous: previousStatus,
+					Current:  status,
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// carryStatusChanges adds the changes the event feed hasn't served yet to the
+// ones just detected, ordered by course and user ID. A user whose status
+// changed again keeps the status they had before the pending change, and has
+// no change left if they are back to it.
+func carryStatusChanges(pending []statusChange, detected []statusChange) []statusChange {
+	if len(pending) == 0 {
+		return detected
+	}
+
+	detectedAt := make(map[[2]string]int, len(detected))
+	for i, change := range detected {
+		detectedAt[[2]string{change.CourseId, change.UserId}] = i
+	}
+	changes := make([]statusChange, 0, len(pending)+len(detected))
+	for _, change := range pending {
+		if i, ok := detectedAt[[2]string{change.CourseId, change.UserId}]; ok {
+			detected[i].Previous = change.Previous
+			continue
+		}
+		changes = append(changes, change)
+	}
+	for _, change := range detected {
+		if change.Previous != change.Current {
+			changes = append(changes, change)
+		}
+	}
+	slices.SortFunc(changes, func(a, b statusChange) int {
+		if c := strings.Compare(a.CourseId, b.CourseId); c != 0 {
+			return c
+		}
+		return strings.Compare(a.UserId, b.UserId)
+	})
+	return changes
+}
+
+// recordStatusChanges diffs the freshly loaded statuses against the previous
+// snapshot, keeps the changes for the event feed and saves the new snapshot.
+// Changes the feed hasn't served yet are saved too and carried into the next
+// sync's, so a snapshot never moves past changes nobody read. The first sync
+// only records a baseline. It is a no-op without a state directory.
+func (d *Connector) recordStatusChanges(ctx context.Context) {
+	if !d.state.Enabled() || d.client == nil {
+		return
+	}
+
+	logger := logging.Extract(ctx)
+	recordedAt := time.Now().UTC()
+
+	var previous statusSnapshot
+	found, err := d.state.Load(statusSnapshotStateKey, &previous)
+	if err != nil {
+		logger.Warn("Failed to load previous status snapshot", zap.Error(err))
+	}
+
+	var pending []statusChange
+	if _, err := d.state.Load(statusChangesStateKey, &pending); err != nil {
+		logger.Warn("Failed to load pending status changes", zap.Error(err))
+	}
+
+	changes := pending
+	if found {
+		detected, err := diffStatuses(previous.Statuses, d.client.StatusesStore)
+		if err != nil {
+			logger.Warn("Failed to diff statuses, keeping the previous status snapshot", zap.Error(err))
+			return
+		}
+		d.setOccurredAt(detected, recordedAt)
+		changes = carryStatusChanges(pending, detected)
+		changes = d.resolveStatusChanges(ctx, changes)
+		logger.Info("Detected course status changes since previous sync",
+			zap.Int("changes", len(detected)),
+			zap.Int("pending_changes", len(pending)),
+			zap.Time("previous_sync", previous.RecordedAt))
+	}
+	d.statusChanges = changes
+	d.statusChangesAt = recordedAt
+	d.statusChangesServed = 0
+
+	// The changes are saved before the snapshot that no longer holds them.
+	if err := d.state.Save(statusChangesStateKey, changes); err != nil {
+		logger.Warn("Failed to save pending status changes, keeping the previous status snapshot", zap.Error(err))
+		return
+	}
+
+	current, err := client.CopyStatuses(d.client.StatusesStore)
+	if err != nil {
+		logger.Warn("Failed to read statuses, keeping the previous status snapshot", zap.Error(err))
+		return
+	}
+	err = d.state.Save(statusSnapshotStateKey, statusSnapshot{
+		RecordedAt: recordedAt,
+		Statuses:   current,
+	})
+	if err != nil {
+		logger.Warn("Failed to save status snapshot", zap.Error(err))
+	}
+}
+
+// resolveStatusChanges attaches its user and course to each change that
+// doesn't have them yet, leaving out the changes of users who aren't
+// published.
+func (d *Connector) resolveStatusChanges(ctx context.Context, changes []statusChange) []statusChange {
+	index := d.index(ctx)
+	resolved := changes[:0]
+	for _, change := range changes {
+		if change.User == nil {
+			resourceId, ok := d.userResourceId(ctx, change.UserId)
+			if !ok {
+				continue
+			}
+			user, ok := index.user(resourceId)
+			if !ok {
+				user = client.User{Id: resourceId}
+			}
+			change.User = &user
+		}
+		if change.Course == nil {
+			course, ok := index.course(change.CourseId)
+			if !ok {
+				course = client.Course{Id: change.CourseId, CourseTitle: change.CourseId}
+			}
+			change.Course = &course
+		}
+		resolved = append(resolved, change)
+	}
+	return resolved
+}
+
+// markStatusChangesServed saves the status changes after the first served
+// ones as the pending ones, once the event feed has been asked for the page
+// after them.
+func (d *Connector) markStatusChangesServed(ctx context.Context, served int) {
+	if !d.state.Enabled() {
+		return
+	}
+
+	d.statusChangesMutex.Lock()
+	defer d.statusChangesMutex.Unlock()
+	if served <= d.statusChangesServed {
+		return
+	}
+	if err := d.state.Save(statusChangesStateKey, d.statusChanges[served:]); err != nil {
+		logging.Extract(ctx).Warn("Failed to save pending status changes", zap.Error(err))
+		return
+	}
+	d.statusChangesServed = served
+}
+
+// setOccurredAt dates each change by the completion date reported for it,
+// falling back to when the change was detected.
+func (d *Connector) setOccurredAt(changes []statusChange, detectedAt time.Time) {
+	if len(changes) == 0 || d.report == nil {
+		return
+	}
+
+	completedDates := make(map[[2]string]time.Time, len(changes))
+	for _, change := range changes {
+		completedDates[[2]string{change.CourseId, change.UserId}] = time.Time{}
+	}
+	for i := range *d.report {
+		entry := &(*d.report)[i]
+		key := [2]string{entry.ContentId, entry.UserId}
+		if _, ok := completedDates[key]; !ok {
+			continue
+		}
+		if completedAt, err := entry.CompletedAt(); err == nil && !completedAt.IsZero() {
+			completedDates[key] = completedAt
+		}
+	}
+
+	for i := range changes {
+		changes[i].OccurredAt = detectedAt
+		completedAt := completedDates[[2]string{changes[i].CourseId, changes[i].UserId}]
+		if changes[i].Current == completedEntitlement && !completedAt.IsZero() {
+			changes[i].OccurredAt = completedAt
+		}
+	}
+}
+
+// EventFeeds exposes course status changes between syncs as an event feed.
+func (d *Connector) EventFeeds(_ context.Context) []connectorbuilder.EventFeed {
+	return []connectorbuilder.EventFeed{&completionFeed{connector: d}}
+}
+
+// completionFeed emits a grant for every new course status found by the last
+// report and a revoke for the status it replaced.
+type completionFeed struct {
+	connector *Connector
+}
+
+func (f *completionFeed) EventFeedMetadata(_ context.Context) *v2.EventFeedMetadata {
+	return &v2.EventFeedMetadata{
+		Id:                  completionFeedId,
+		SupportedEventTypes: []v2.EventType{v2.EventType_EVENT_TYPE_UNSPECIFIED},
+	}
+}
+
+// ListEvents returns a page of the status changes recorded by the last sync.
+// It never generates a report or changes the sync's report state. The cursor names the batch of changes and the offset
+// into it, so a cursor left over from an earlier report starts the new batch
+// from the beginning. Being asked for the page at an offset means the
+// changes before it were received, so they stop being pending.
+func (f *completionFeed) ListEvents(
+	ctx context.Context,
+	earliestEvent *timestamppb.Timestamp,
+	pToken *pagination.StreamToken,
+) (
+	[]*v2.Event,
+	*pagination.StreamState,
+	annotations.Annotations,
+	error,
+) {
+	d := f.connector
+	d.reportMutex.RLock()
+	defer d.reportMutex.RUnlock()
+
+	batch := strconv.FormatInt(d.statusChangesAt.UnixNano(), 10)
+	offset := 0
+	if pToken != nil && pToken.Cursor != "" {
+		cursorBatch, cursorOffset, ok := strings.Cut(pToken.Cursor, eventCursorSeparator)
+		if ok && cursorBatch == batch {
+			parsed, err := strconv.Atoi(cursorOffset)
+			if err != nil || parsed < 0 {
+				return nil, nil, nil, fmt.Errorf("invalid event cursor %q", pToken.Cursor)
+			}
+			offset = min(parsed, len(d.statusChanges))
+		}
+	}
+	d.markStatusChangesServed(ctx, offset)
+
+	pageSize := defaultEventsPageSize
+	if pToken != nil && pToken.Size > 0 {
+		pageSize = pToken.Size
+	}
+	end := min(offset+pageSize, len(d.statusChanges))
+
+	events := make([]*v2.Event, 0)
+	for _, change := range d.statusChanges[offset:end] {
+		if earliestEvent != nil && change.OccurredAt.Before(earliestEvent.AsTime()) {
+			continue
+		}
+		changeEvents, err := statusChangeEvents(change)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		events = append(events, changeEvents...)
+	}
+
+	return events, &pagination.StreamState{
+		Cursor:  batch + eventCursorSeparator + strconv.Itoa(end),
+		HasMore: end < len(d.statusChanges),
+	}, nil, nil
+}
+
+// statusChangeEvents builds the grant of the new status and, when it
+// replaced one, the revoke of the old status.
+func statusChangeEvents(change statusChange) ([]*v2.Event, error) {
+	course := client.Course{Id: change.CourseId, CourseTitle: change.CourseId}
+	if change.Course != nil {
+		course = *change.Course
+	}
+	courseResource0, err := courseResource(course, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	user := client.User{Id: change.UserId}
+	if change.User != nil {
+		user = *change.User
+	}
+	userResource0, err := userResource(user, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	eventId := fmt.Sprintf("%s:%s:%s:%d", change.CourseId, user.Id, change.Current, change.OccurredAt.UnixNano())
+	occurredAt := timestamppb.New(change.OccurredAt)
+
+	events := []*v2.Event{
+		{
+			Id:         eventId + ":grant",
+			OccurredAt: occurredAt,
+			Event: &v2.Event_GrantEvent{
+				GrantEvent: &v2.GrantEvent{
+					Grant: grant.NewGrant(courseResource0, change.Current, userResource0.Id),
+				},
+			},
+		},
+	}
+
+	if change.Previous != "" {
+		events = append(events, &v2.Event{
+			Id:         eventId + ":revoke",
+			OccurredAt: occurredAt,
+			Event: &v2.Event_RevokeEvent{
+				RevokeEvent: &v2.RevokeEvent{
+					Entitlement: entitlement.NewAssignmentEntitlement(courseResource0, change.Previous),
+					Principal:   userResource0,
+				},
+			},
+		})
+	}
+
+	return events, nil
+}
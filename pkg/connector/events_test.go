@@ -0,0 +1,272 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDiffStatuses(t *testing.T) {
+	previous := client.MapStatusesStore{
+		"course1": {
+			"michael.bolton@initech.com": "in_progress",
+			"milton.waddams@initech.com": "completed",
+			"peter.gibbons@initech.com":  "in_progress",
+		},
+	}
+	current := client.MapStatusesStore{
+		"course1": {
+			"michael.bolton@initech.com": "completed",
+			"milton.waddams@initech.com": "completed",
+		},
+		"course2": {
+			"bill.lumbergh@initech.com": "in_progress",
+		},
+	}
+
+	changes, err := diffStatuses(previous, current)
+	require.NoError(t, err)
+
+	assert.Equal(t, []statusChange{
+		{CourseId: "course1", UserId: "michael.bolton@initech.com", Previous: "in_progress", Current: "completed"},
+		{CourseId: "course2", UserId: "bill.lumbergh@initech.com", Current: "in_progress"},
+	}, changes)
+}
+
+func TestCompletionFeed(t *testing.T) {
+	ctx := context.Background()
+	stateStore := state.New(t.TempDir())
+
+	newConnector := func(report *client.Report) *Connector {
+		percipioClient, err := client.New(ctx, "https://api.example.com", "test-org", "test-token")
+		require.NoError(t, err)
+		require.NoError(t, percipioClient.LoadReport(ctx, report))
+
+		connector := &Connector{
+			client:      percipioClient,
+			report:      report,
+			reportState: ReportCompleted,
+			state:       stateStore,
+		}
+		connector.recordStatusChanges(ctx)
+		return connector
+	}
+
+	t.Run("should only record a baseline on the first sync", func(t *testing.T) {
+		connector := newConnector(&client.Report{
+			{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Started"},
+			{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Started"},
+		})
+
+		feed := connector.EventFeeds(ctx)[0]
+		events, streamState, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{})
+		require.NoError(t, err)
+		assert.Empty(t, events)
+		assert.False(t, streamState.HasMore)
+	})
+
+	t.Run("should emit completions and status changes since the previous sync", func(t *testing.T) {
+		connector := newConnector(&client.Report{
+			{
+				UserId:        "michael.bolton@initech.com",
+				FirstName:     "Michael",
+				LastName:      "Bolton",
+				ContentId:     "course1",
+				ContentTitle:  "Advanced Go Patterns",
+				ContentType:   "Course",
+				Status:        "Completed",
+				CompletedDate: "2025-06-20T00:00:00.000Z",
+			},
+			{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Started"},
+			{UserId: "peter.gibbons@initech.com", ContentId: "course1", Status: "Started"},
+		})
+
+		feed := connector.EventFeeds(ctx)[0]
+		events, streamState, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{Size: 1})
+		require.NoError(t, err)
+		require.True(t, streamState.HasMore)
+		require.Len(t, events, 2)
+
+		grantEvent := events[0].GetGrantEvent()
+		require.NotNil(t, grantEvent)
+		assert.Equal(t, "course:course1:completed", grantEvent.Grant.Entitlement.Id)
+		assert.Equal(t, "course1", grantEvent.Grant.Entitlement.Resource.Id.Resource)
+		assert.Equal(t, "michael.bolton@initech.com", grantEvent.Grant.Principal.Id.Resource)
+		assert.Equal(t, time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC), events[0].OccurredAt.AsTime())
+
+		revokeEvent := events[1].GetRevokeEvent()
+		require.NotNil(t, revokeEvent)
+		assert.Equal(t, "in_progress", revokeEvent.Entitlement.Slug)
+		assert.Equal(t, "Michael Bolton", revokeEvent.Principal.DisplayName)
+
+		events, streamState, _, err = feed.ListEvents(ctx, nil, &pagination.StreamToken{Size: 1, Cursor: streamState.Cursor})
+		require.NoError(t, err)
+		assert.False(t, streamState.HasMore)
+		require.Len(t, events, 1)
+		assert.Equal(t, "peter.gibbons@initech.com", events[0].GetGrantEvent().Grant.Principal.Id.Resource)
+		assert.Equal(t, "course:course1:in_progress", events[0].GetGrantEvent().Grant.Entitlement.Id)
+
+		events, streamState, _, err = feed.ListEvents(ctx, nil, &pagination.StreamToken{Size: 1, Cursor: streamState.Cursor})
+		require.NoError(t, err)
+		assert.Empty(t, events)
+		assert.False(t, streamState.HasMore)
+	})
+
+	t.Run("should skip events before the earliest requested", func(t *testing.T) {
+		connector := newConnector(&client.Report{
+			{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Started", CompletedDate: "2025-06-20T00:00:00.000Z"},
+			{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Completed", CompletedDate: "2025-06-20T00:00:00.000Z"},
+			{UserId: "peter.gibbons@initech.com", ContentId: "course1", Status: "Started"},
+		})
+
+		feed := connector.EventFeeds(ctx)[0]
+		earliest := timestamppb.New(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC))
+		events, streamState, _, err := feed.ListEvents(ctx, earliest, &pagination.StreamToken{})
+		require.NoError(t, err)
+
+		// Milton's completion is dated by the report; Michael's regression is
+		// dated when it was detected.
+		require.Len(t, events, 2)
+		assert.Equal(t, "michael.bolton@initech.com", events[0].GetGrantEvent().Grant.Principal.Id.Resource)
+		assert.Equal(t, "course:course1:in_progress", events[0].GetGrantEvent().Grant.Entitlement.Id)
+
+		_, _, _, err = feed.ListEvents(ctx, earliest, &pagination.StreamToken{Cursor: streamState.Cursor})
+		require.NoError(t, err)
+	})
+
+	t.Run("should restart a batch for a stale cursor", func(t *testing.T) {
+		connector := newConnector(&client.Report{
+			{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Completed"},
+		})
+
+		feed := connector.EventFeeds(ctx)[0]
+		events, _, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{Cursor: "12345/1"})
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+	})
+}
+
+func TestPendingStatusChanges(t *testing.T) {
+	ctx := context.Background()
+
+	newConnector := func(stateStore *state.Store, report *client.Report) *Connector {
+		percipioClient, err := client.New(ctx, "https://api.example.com", "test-org", "test-token")
+		require.NoError(t, err)
+		require.NoError(t, percipioClient.LoadReport(ctx, report))
+
+		connector := &Connector{
+			client:      percipioClient,
+			report:      report,
+			reportState: ReportCompleted,
+			state:       stateStore,
+		}
+		connector.recordStatusChanges(ctx)
+		return connector
+	}
+	listAll := func(connector *Connector, cursor string) ([]string, string) {
+		feed := connector.EventFeeds(ctx)[0]
+		var eventIds []string
+		for {
+			events, streamState, _, err := feed.ListEvents(ctx, nil, &pagination.StreamToken{Size: 1, Cursor: cursor})
+			require.NoError(t, err)
+			for _, event := range events {
+				if grantEvent := event.GetGrantEvent(); grantEvent != nil {
+					eventIds = append(eventIds, grantEvent.Grant.Id)
+				}
+			}
+			cursor = streamState.Cursor
+			if !streamState.HasMore {
+				return eventIds, cursor
+			}
+		}
+	}
+	started := &client.Report{
+		{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Started"},
+		{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Started"},
+	}
+	completed := &client.Report{
+		{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Completed"},
+		{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Started"},
+	}
+
+	t.Run("should carry changes the feed didn't serve into the next sync", func(t *testing.T) {
+		stateStore := state.New(t.TempDir())
+		newConnector(stateStore, started)
+		newConnector(stateStore, completed)
+
+		eventIds, _ := listAll(newConnector(stateStore, completed), "")
+		assert.Equal(t, []string{"course:course1:completed:user:michael.bolton@initech.com"}, eventIds)
+	})
+
+	t.Run("should not repeat changes the feed served", func(t *testing.T) {
+		stateStore := state.New(t.TempDir())
+		newConnector(stateStore, started)
+		connector := newConnector(stateStore, completed)
+		eventIds, cursor := listAll(connector, "")
+		assert.Len(t, eventIds, 1)
+		// Asking for the page after the last one acknowledges it.
+		eventIds, _ = listAll(connector, cursor)
+		assert.Empty(t, eventIds)
+
+		eventIds, _ = listAll(newConnector(stateStore, completed), "")
+		assert.Empty(t, eventIds)
+	})
+
+	t.Run("should keep unacknowledged pages pending", func(t *testing.T) {
+		stateStore := state.New(t.TempDir())
+		newConnector(stateStore, started)
+		eventIds, _ := listAll(newConnector(stateStore, completed), "")
+		assert.Len(t, eventIds, 1)
+
+		eventIds, _ = listAll(newConnector(stateStore, completed), "")
+		assert.Equal(t, []string{"course:course1:completed:user:michael.bolton@initech.com"}, eventIds)
+	})
+
+	t.Run("should serve recorded changes without a report", func(t *testing.T) {
+		stateStore := state.New(t.TempDir())
+		newConnector(stateStore, started)
+		connector := newConnector(stateStore, completed)
+		require.NoError(t, connector.Close())
+
+		eventIds, _ := listAll(connector, "")
+		assert.Equal(t, []string{"course:course1:completed:user:michael.bolton@initech.com"}, eventIds)
+		assert.Equal(t, ReportNotStarted, connector.reportState)
+		assert.Nil(t, connector.report)
+	})
+
+	t.Run("should drop a pending change that was undone", func(t *testing.T) {
+		stateStore := state.New(t.TempDir())
+		newConnector(stateStore, started)
+		newConnector(stateStore, completed)
+
+		eventIds, _ := listAll(newConnector(stateStore, started), "")
+		assert.Empty(t, eventIds)
+	})
+}
+
+func TestCarryStatusChanges(t *testing.T) {
+	pending := []statusChange{
+		{CourseId: "course1", UserId: "michael.bolton@initech.com", Previous: "in_progress", Current: "completed"},
+		{CourseId: "course1", UserId: "peter.gibbons@initech.com", Current: "in_progress"},
+		{CourseId: "course2", UserId: "milton.waddams@initech.com", Previous: "completed", Current: "in_progress"},
+	}
+	detected := []statusChange{
+		{CourseId: "course1", UserId: "bill.lumbergh@initech.com", Current: "completed"},
+		{CourseId: "course1", UserId: "peter.gibbons@initech.com", Previous: "in_progress", Current: "completed"},
+		{CourseId: "course2", UserId: "milton.waddams@initech.com", Previous: "in_progress", Current: "completed"},
+	}
+
+	assert.Equal(t, []statusChange{
+		{CourseId: "course1", UserId: "bill.lumbergh@initech.com", Current: "completed"},
+		{CourseId: "course1", UserId: "michael.bolton@initech.com", Previous: "in_progress", Current: "completed"},
+		{CourseId: "course1", UserId: "peter.gibbons@initech.com", Current: "completed"},
+	}, carryStatusChanges(pending, detected))
+}
@@ -0,0 +1,162 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+const lastReportStateKey = "last-report"
+
+// cachedReport is the last report that passed the guardrails, kept on disk so
+// a failed generation doesn't have to fail the whole sync. Report is kept
+// encoded so it is read back with client.DecodeReport, which keeps the
+// connector's report columns.
+type cachedReport struct {
+	LoadedAt time.Time       `json:"loaded_at"`
+	Lookback time.Duration   `json:"lookback"`
+	Report   json.RawMessage `json:"report"`
+}
+
+// saveLastGoodReport persists the current report for use as a fallback. It is
+// a no-op unless the fallback is enabled.
+func (d *Connector) saveLastGoodReport(ctx context.Context) {
+	if d.fallbackMaxAge <= 0 || !d.state.Enabled() || d.report == nil {
+		return
+	}
+
+	logger := logging.Extract(ctx)
+	report, err := json.Marshal(d.report)
+	if err == nil {
+		err = d.state.Save(lastReportStateKey, cachedReport{
+			LoadedAt: time.Now().UTC(),
+			Lookback: d.reportLookback,
+			Report:   report,
+		})
+	}
+	if err != nil {
+		logger.Warn("Failed to save report for fallback", zap.Error(err))
+		return
+	}
+	logger.Debug("Saved report for fallback", zap.Int("report_entries", len(*d.report)))
+}
+
+// loadFallbackReport tries to serve the last good report after generation
+// failed with cause. It returns an error explaining why no fallback was
+// possible, which callers should only log: cause remains the sync's error.
+func (d *Connector) loadFallbackReport(ctx context.Context, cause error) error {
+	if d.fallbackMaxAge <= 0 || !d.state.Enabled() {
+		return errors.New("report fallback is disabled")
+	}
+
+	// Credential and configuration problems won't fix themselves; serving old
+	// data would only hide them.
+	if errors.Is(cause, client.ErrUnauthenticated) ||
+		errors.Is(cause, client.ErrForbidden) ||
+		errors.Is(cause, client.ErrOrganizationNotFound) {
+		return fmt.Errorf("not falling back on a configuration error: %w", cause)
+	}
+
+	var cached cachedReport
+	found, err := d.state.Load(lastReportStateKey, &cached)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("no previous report is available")
+	}
+
+	age := time.Since(cached.LoadedAt)
+	if age > d.fallbackMaxAge {
+		return fmt.Errorf("previous report is %s old, older than the %s limit", age.Round(time.Minute), d.fallbackMaxAge)
+	}
+	if cached.Lookback != d.reportLookback {
+		return fmt.Errorf("previous report used a %s lookback, not %s", cached.Lookback, d.reportLookback)
+	}
+
+	report, err := client.DecodeReport(cached.Report, d.client.ReportColumns)
+	if err != nil {
+		return fmt.Errorf("failed to decode previous report: %w", err)
+	}
+	if err := d.client.LoadReport(ctx, &report); err != nil {
+		return err
+	}
+	d.report = d.client.GetLoadedReport()
+	if err := d.resolveIdentities(ctx); err != nil {
+		return err
+	}
+	if err := d.loadRoles(ctx); err != nil {
+		return err
+	}
+	if err := d.loadAssignments(ctx); err != nil {
+		return err
+	}
+
+	logging.Extract(ctx).Warn("Serving stale learning activity report because a fresh one could not be generated",
+		zap.Error(cause),
+		zap.Time("report_loaded_at", cached.LoadedAt),
+		zap.Duration("report_age", age.Round(time.Second)),
+		zap.Duration("max_age", d.fallbackMaxAge),
+		zap.Int("report_entries", len(report)))
+	return nil
+}
+
+// fallBackOrFail marks report generation as failed with err, unless the last
+// good report can be served instead. Must be called with reportMutex held.
+func (d *Connector) fallBackOrFail(ctx context.Context, err error) error {
+	if fallbackErr := d.loadFallbackReport(ctx, err); fallbackErr != nil {
+		logging.Extract(ctx).Debug("Report fallback not used", zap.Error(fallbackErr))
+		d.reportState = ReportFailed
+		d.reportError = toGRPCError(err)
+		return d.reportError
+	}
+
+	d.reportState = ReportCompleted
+	return nil
+}
+
+// cachedDirectory is the last data fetched from a Percipio service, kept on
+// disk so a failed fetch can fall back on it like a failed report does.
+type cachedDirectory[T any] struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Items     []T       `json:"items"`
+}
+
+// saveLastGoodDirectory persists items fetched at fetchedAt under key for use
+// as a fallback. It is a no-op unless the fallback is enabled.
+func saveLastGoodDirectory[T any](ctx context.Context, d *Connector, key string, fetchedAt time.Time, items []T) {
+	if d.fallbackMaxAge <= 0 || !d.state.Enabled() {
+		return
+	}
+	if err := d.state.Save(key, cachedDirectory[T]{FetchedAt: fetchedAt, Items: items}); err != nil {
+		logging.Extract(ctx).Warn("Failed to save directory for fallback", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// loadFallbackDirectory returns the items saved under key and when they were
+// fetched, or an error explaining why no fallback was possible.
+func loadFallbackDirectory[T any](d *Connector, key string) ([]T, time.Time, error) {
+	if d.fallbackMaxAge <= 0 || !d.state.Enabled() {
+		return nil, time.Time{}, errors.New("fallback is disabled")
+	}
+
+	var cached cachedDirectory[T]
+	found, err := d.state.Load(key, &cached)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !found {
+		return nil, time.Time{}, errors.New("no previous data is available")
+	}
+	if age := time.Since(cached.FetchedAt); age > d.fallbackMaxAge {
+		return nil, time.Time{}, fmt.Errorf("previous data is %s old, older than the %s limit", age.Round(time.Minute), d.fallbackMaxAge)
+	}
+	return cached.Items, cached.FetchedAt, nil
+}
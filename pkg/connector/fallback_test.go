@@ -0,0 +1,159 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
+	"github.com/iiiatthew/baton-percipio-report/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingReportServer accepts the report request and then reports the
+// generation as FAILED, or rejects the token when unauthorized is set.
+func failingReportServer(unauthorized bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if unauthorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if strings.Contains(r.URL.Path, "learning-activity") {
+			_, _ = w.Write([]byte(`{"id": "report-123", "status": "PENDING"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": "report-123", "status": "FAILED", "error": "internal error"}`))
+	}))
+}
+
+func newFallbackConnector(t *testing.T, serverURL string, stateDir string, maxAge time.Duration, opts ...Option) *Connector {
+	ctx := context.Background()
+	opts = append([]Option{WithStateDir(stateDir), WithReportFallback(maxAge)}, opts...)
+	connector, err := New(ctx, "test-org", "test-token", 24*time.Hour, opts...)
+	require.NoError(t, err)
+
+	connector.client, err = client.New(ctx, serverURL, "test-org", "test-token")
+	require.NoError(t, err)
+	connector.configureClient()
+	return connector
+}
+
+// saveFallbackReport saves a fresh last good report in stateDir.
+func saveFallbackReport(t *testing.T, stateDir string) {
+	require.NoError(t, state.New(stateDir).Save(lastReportStateKey, cachedReport{
+		LoadedAt: time.Now(),
+		Lookback: 24 * time.Hour,
+		Report:   json.RawMessage(`[{"userId": "michael.bolton@initech.com", "contentId": "course1", "status": "Completed"}]`),
+	}))
+}
+
+func TestReportFallback(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should serve the last good report when generation fails", func(t *testing.T) {
+		stateDir := t.TempDir()
+
+		server := test.FixturesServer()
+		good := newFallbackConnector(t, server.URL, stateDir, time.Hour)
+		require.NoError(t, good.generateReport(ctx))
+		server.Close()
+
+		failing := failingReportServer(false)
+		defer failing.Close()
+
+		connector := newFallbackConnector(t, failing.URL, stateDir, time.Hour)
+		require.NoError(t, connector.generateReport(ctx))
+		assert.Equal(t, ReportCompleted, connector.reportState)
+		require.NotNil(t, connector.report)
+		assert.Equal(t, len(*good.report), len(*connector.report))
+		assert.Equal(t, "completed", getStatuses(t, connector.client.StatusesStore, "bs_adg02_a23_enus")["michael.bolton@initech.com"])
+	})
+
+	t.Run("should fail when the last good report is too old", func(t *testing.T) {
+		stateDir := t.TempDir()
+		require.NoError(t, state.New(stateDir).Save(lastReportStateKey, cachedReport{
+			LoadedAt: time.Now().Add(-2 * time.Hour),
+			Lookback: 24 * time.Hour,
+			Report:   json.RawMessage(`[{"userId": "michael.bolton@initech.com", "contentId": "course1"}]`),
+		}))
+
+		failing := failingReportServer(false)
+		defer failing.Close()
+
+		connector := newFallbackConnector(t, failing.URL, stateDir, time.Hour)
+		err := connector.generateReport(ctx)
+		assert.ErrorIs(t, err, client.ErrReportFailed)
+		assert.Equal(t, ReportFailed, connector.reportState)
+	})
+
+	t.Run("should not hide credential problems", func(t *testing.T) {
+		stateDir := t.TempDir()
+		require.NoError(t, state.New(stateDir).Save(lastReportStateKey, cachedReport{
+			LoadedAt: time.Now(),
+			Lookback: 24 * time.Hour,
+			Report:   json.RawMessage(`[{"userId": "michael.bolton@initech.com", "contentId": "course1"}]`),
+		}))
+
+		failing := failingReportServer(true)
+		defer failing.Close()
+
+		connector := newFallbackConnector(t, failing.URL, stateDir, time.Hour)
+		err := connector.generateReport(ctx)
+		assert.ErrorIs(t, err, client.ErrUnauthenticated)
+		assert.Equal(t, ReportFailed, connector.reportState)
+	})
+
+	t.Run("should load the last good roles with the last good report", func(t *testing.T) {
+		stateDir := t.TempDir()
+		saveFallbackReport(t, stateDir)
+		require.NoError(t, state.New(stateDir).Save(rolesStateKey, cachedDirectory[client.ManagedUser]{
+			FetchedAt: time.Now(),
+			Items:     []client.ManagedUser{{Id: "bill.lumbergh@initech.com", Role: "Admin", IsActive: true}},
+		}))
+
+		failing := failingReportServer(false)
+		defer failing.Close()
+
+		connector := newFallbackConnector(t, failing.URL, stateDir, time.Hour, WithRoles(true))
+		require.NoError(t, connector.generateReport(ctx))
+		require.NotNil(t, connector.roles)
+		admin, ok := connector.index(ctx).role("admin")
+		require.True(t, ok)
+		assert.Equal(t, []string{"bill.lumbergh@initech.com"}, admin.Members)
+	})
+
+	t.Run("should fail without roles to serve with the last good report", func(t *testing.T) {
+		stateDir := t.TempDir()
+		saveFallbackReport(t, stateDir)
+
+		failing := failingReportServer(false)
+		defer failing.Close()
+
+		connector := newFallbackConnector(t, failing.URL, stateDir, time.Hour, WithRoles(true))
+		err := connector.generateReport(ctx)
+		assert.ErrorIs(t, err, client.ErrReportFailed)
+		assert.Equal(t, ReportFailed, connector.reportState)
+	})
+
+	t.Run("should not save reports when disabled", func(t *testing.T) {
+		stateDir := t.TempDir()
+		server := test.FixturesServer()
+		defer server.Close()
+
+		connector := newFallbackConnector(t, server.URL, stateDir, 0)
+		require.NoError(t, connector.generateReport(ctx))
+
+		var cached cachedReport
+		found, err := state.New(stateDir).Load(lastReportStateKey, &cached)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+}
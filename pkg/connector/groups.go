@@ -0,0 +1,350 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const memberEntitlement = "member"
+
+// GroupOptions controls the group resources built from a report column.
+type GroupOptions struct {
+	// Attribute is the report column users are grouped by, such as a
+	// department, cost center or audience column. Groups are disabled when
+	// it is empty.
+	Attribute string
+	// Separator splits a column holding several groups, e.g. ";" for
+	// "Sales;EMEA". Values are not split when it is empty.
+	Separator string
+}
+
+// enabled reports whether groups are published.
+func (o GroupOptions) enabled() bool {
+	return o.Attribute != ""
+}
+
+// values returns the groups named in a column value.
+func (o GroupOptions) values(value string) []string {
+	parts := []string{value}
+	if o.Separator != "" {
+		parts = strings.Split(value, o.Separator)
+	}
+	groups := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" && !slices.Contains(groups, part) {
+			groups = append(groups, part)
+		}
+	}
+	return groups
+}
+
+type groupBuilder struct {
+	client       *client.Client
+	resourceType *v2.ResourceType
+	connector    *Connector
+}
+
+func (o *groupBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	_ = ctx // This method returns a static resource type
+	return o.resourceType
+}
+
+// groupResource creates a connector resource for a group, with its
+// completion counts in the profile.
+func groupResource(group client.Group, attribute string, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"id":              group.Id,
+		"group_by":        attribute,
+		"members":         len(group.Members),
+		"enrollments":     group.Enrollments,
+		"completed":       group.Completed,
+		"in_progress":     group.InProgress,
+		"completion_rate": math.Round(group.CompletionRate()*10) / 10,
+	}
+
+	return resourceSdk.NewGroupResource(
+		group.Id,
+		groupResourceType,
+		group.Id,
+		[]resourceSdk.GroupTraitOption{resourceSdk.WithGroupProfile(profile)},
+		resourceSdk.WithParentResourceID(parentResourceID),
+		resourceSdk.WithDescription(fmt.Sprintf("Percipio users with %s %s", attribute, group.Id)),
+	)
+}
+
+// buildGroupIndex groups the published users by the configured column, taking
+// each user's value from their most recent row where it isn't empty, and
+// counts their course statuses. Groups are sorted by ID and their members by
+// user resource ID.
+func buildGroupIndex(
+	ctx context.Context,
+	report *client.Report,
+	statuses client.StatusesStore,
+	users []client.User,
+	userResourceIds map[string]string,
+	options GroupOptions,
+) ([]client.Group, error) {
+	if !options.enabled() || report == nil {
+		return nil, nil
+	}
+
+	type latestValue struct {
+		value string
+		date  time.Time
+	}
+	values := make(map[string]latestValue)
+	for i := range *report {
+		entry := &(*report)[i]
+		value := entry.Column(options.Attribute)
+		if entry.UserId == "" || value == "" {
+			continue
+		}
+		date := entry.LatestActivity()
+		if latest, seen := values[entry.UserId]; seen && !date.After(latest.date) {
+			continue
+		}
+		values[entry.UserId] = latestValue{value: value, date: date}
+	}
+
+	published := make(map[string]bool, len(users))
+	for _, user := range users {
+		published[user.Id] = true
+	}
+
+	groupsById := make(map[string]*client.Group)
+	members := make(map[string]map[string]struct{})
+	memberships := make(map[string][]*client.Group)
+	for percipioUserId, latest := range values {
+		resourceId := percipioUserId
+		if userResourceIds != nil {
+			resourceId = userResourceIds[percipioUserId]
+		}
+		if !published[resourceId] {
+			continue
+		}
+		for _, id := range options.values(latest.value) {
+			group, ok := groupsById[id]
+			if !ok {
+				group = &client.Group{Id: id}
+				groupsById[id] = group
+				members[id] = make(map[string]struct{})
+			}
+			// Users merged into one resource are members once.
+			if _, ok := members[id][resourceId]; !ok {
+				members[id][resourceId] = struct{}{}
+				group.Members = append(group.Members, resourceId)
+			}
+			memberships[percipioUserId] = append(memberships[percipioUserId], group)
+		}
+	}
+
+	if statuses != nil {
+		courses, err := statuses.Courses()
+		if err != nil {
+			return nil, fmt.Errorf("failed to count group course statuses: %w", err)
+		}
+		for courseId := range courses {
+			err := statuses.Statuses(courseId, "", func(percipioUserId string, courseStatus string) bool {
+				for _, group := range memberships[percipioUserId] {
+					group.Enrollments++
+					switch courseStatus {
+					case completedEntitlement:
+						group.Completed++
+					case inProgressEntitlement:
+						group.InProgress++
+					}
+				}
+				return true
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to count group course statuses: %w", err)
+			}
+		}
+	}
+
+	groups := make([]client.Group, 0, len(groupsById))
+	for _, group := range groupsById {
+		slices.Sort(group.Members)
+		groups = append(groups, *group)
+	}
+	slices.SortFunc(groups, func(a, b client.Group) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	logging.Extract(ctx).Info("Group extraction completed",
+		zap.String("group_by", options.Attribute),
+		zap.Int("unique_groups", len(groups)),
+		zap.Int("grouped_users", len(values)))
+
+	return groups, nil
+}
+
+// group returns the indexed group with the given ID.
+func (i *reportIndex) group(id string) (client.Group, bool) {
+	n, found := slices.BinarySearchFunc(i.groups, id, func(group client.Group, id string) int {
+		return strings.Compare(group.Id, id)
+	})
+	if !found {
+		return client.Group{}, false
+	}
+	return i.groups[n], true
+}
+
+// List returns a page of the groups found in the report, ordered by ID.
+func (o *groupBuilder) List(
+	ctx context.Context,
+	parentResourceID *v2.ResourceId,
+	pToken *pagination.Token,
+) (
+	[]*v2.Resource,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	if err := o.connector.waitForReport(ctx); err != nil {
+		return nil, "", outputAnnotations, err
+	}
+	index := o.connector.index(ctx)
+	if index.groupsErr != nil {
+		return nil, "", outputAnnotations, index.groupsErr
+	}
+
+	groups, nextToken, err := paginate(
+		o.connector,
+		index.groups,
+		func(group client.Group) string { return group.Id },
+		pToken,
+	)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	outputResources := make([]*v2.Resource, 0, len(groups))
+	for _, group := range groups {
+		resource, err := groupResource(group, o.connector.groupOptions.Attribute, parentResourceID)
+		if err != nil {
+			return nil, "", outputAnnotations, err
+		}
+		outputResources = append(outputResources, resource)
+	}
+
+	return outputResources, nextToken, outputAnnotations, nil
+}
+
+// Entitlements returns the membership entitlement of a group.
+func (o *groupBuilder) Entitlements(
+	_ context.Context,
+	resource *v2.Resource,
+	_ *pagination.Token,
+) (
+	[]*v2.Entitlement,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	return []*v2.Entitlement{
+		entitlement.NewAssignmentEntitlement(
+			resource,
+			memberEntitlement,
+			entitlement.WithGrantableTo(userResourceType),
+			entitlement.WithDisplayName(fmt.Sprintf("Group %s %s", resource.DisplayName, memberEntitlement)),
+			entitlement.WithDescription(fmt.Sprintf("Member of group %s in Percipio", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+// Grants returns a page of a group's members, ordered by user ID.
+func (o *groupBuilder) Grants(
+	ctx context.Context,
+	resource *v2.Resource,
+	pToken *pagination.Token,
+) (
+	[]*v2.Grant,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	group, ok := o.connector.index(ctx).group(resource.Id.Resource)
+	if !ok {
+		return nil, "", outputAnnotations, nil
+	}
+
+	members, nextToken, err := paginate(o.connector, group.Members, func(userId string) string { return userId }, pToken)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	grants := make([]*v2.Grant, 0, len(members))
+	for _, userId := range members {
+		principalId, err := resourceSdk.NewResourceID(userResourceType, userId)
+		if err != nil {
+			return nil, "", outputAnnotations, err
+		}
+		grants = append(grants, grant.NewGrant(resource, memberEntitlement, principalId))
+	}
+
+	return grants, nextToken, outputAnnotations, nil
+}
+
+// Get returns a single group by ID. Groups only exist in the report, so a
+// report must be loaded.
+func (o *groupBuilder) Get(
+	ctx context.Context,
+	resourceId *v2.ResourceId,
+	parentResourceId *v2.ResourceId,
+) (
+	*v2.Resource,
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	if !o.connector.reportLoaded() {
+		return nil, outputAnnotations, status.Errorf(codes.Unavailable,
+			"groups come from the learning activity report, which is not loaded yet")
+	}
+
+	index := o.connector.index(ctx)
+	if index.groupsErr != nil {
+		return nil, outputAnnotations, index.groupsErr
+	}
+	group, ok := index.group(resourceId.Resource)
+	if !ok {
+		return nil, outputAnnotations, status.Errorf(codes.NotFound, "group %s not found", resourceId.Resource)
+	}
+
+	resource, err := groupResource(group, o.connector.groupOptions.Attribute, parentResourceId)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+	return resource, outputAnnotations, nil
+}
+
+func newGroupBuilder(client *client.Client, connector *Connector) *groupBuilder {
+	return &groupBuilder{
+		client:       client,
+		resourceType: groupResourceType,
+		connector:    connector,
+	}
+}
@@ -0,0 +1,163 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// groupReport has Michael, who moved from Sales to Engineering, Milton in
+// Engineering and Peter in two audiences.
+func groupReport() *client.Report {
+	return &client.Report{
+		{
+			UserId:        "michael.bolton@initech.com",
+			ContentId:     "course1",
+			Status:        "Completed",
+			CompletedDate: "2025-01-10T00:00:00.000Z",
+			Attributes:    map[string]string{"department": "Sales"},
+		},
+		{
+			UserId:     "michael.bolton@initech.com",
+			ContentId:  "course2",
+			Status:     "Started",
+			LastAccess: "2025-06-20T00:00:00.000Z",
+			Attributes: map[string]string{"department": "Engineering", "audiences": "Developers"},
+		},
+		{
+			UserId:     "milton.waddams@initech.com",
+			ContentId:  "course1",
+			Status:     "",
+			Attributes: map[string]string{"department": "Engineering"},
+		},
+		{
+			UserId:     "peter.gibbons@initech.com",
+			ContentId:  "course1",
+			Status:     "Completed",
+			Attributes: map[string]string{"audiences": "Developers; Managers"},
+		},
+	}
+}
+
+func TestBuildGroupIndex(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should group users by their latest value", func(t *testing.T) {
+		connector := newLoadedConnector(t, "https://api.example.com", groupReport(), WithGroups(GroupOptions{Attribute: "department"}))
+
+		groups := connector.index(ctx).groups
+		assert.Equal(t, []client.Group{
+			{
+				Id:          "Engineering",
+				Members:     []string{"michael.bolton@initech.com", "milton.waddams@initech.com"},
+				Enrollments: 3,
+				Completed:   1,
+				InProgress:  1,
+			},
+		}, groups)
+		assert.InDelta(t, 33.33, groups[0].CompletionRate(), 0.01)
+	})
+
+	t.Run("should split multi-valued columns", func(t *testing.T) {
+		connector := newLoadedConnector(t, "https://api.example.com", groupReport(), WithGroups(GroupOptions{Attribute: "audiences", Separator: ";"}))
+
+		groups := connector.index(ctx).groups
+		require.Len(t, groups, 2)
+		assert.Equal(t, "Developers", groups[0].Id)
+		assert.Equal(t, []string{"michael.bolton@initech.com", "peter.gibbons@initech.com"}, groups[0].Members)
+		assert.Equal(t, 3, groups[0].Enrollments)
+		assert.Equal(t, 2, groups[0].Completed)
+		assert.Equal(t, "Managers", groups[1].Id)
+		assert.Equal(t, []string{"peter.gibbons@initech.com"}, groups[1].Members)
+	})
+
+	t.Run("should leave out unpublished users", func(t *testing.T) {
+		groups, err := buildGroupIndex(ctx, groupReport(), nil,
+			[]client.User{{Id: "E100"}},
+			map[string]string{"michael.bolton@initech.com": "E100"},
+			GroupOptions{Attribute: "department"})
+		require.NoError(t, err)
+		require.Len(t, groups, 1)
+		assert.Equal(t, []string{"E100"}, groups[0].Members)
+	})
+
+	t.Run("should list users merged into one resource once", func(t *testing.T) {
+		groups, err := buildGroupIndex(ctx, groupReport(), nil,
+			[]client.User{{Id: "E100"}},
+			map[string]string{"michael.bolton@initech.com": "E100", "milton.waddams@initech.com": "E100"},
+			GroupOptions{Attribute: "department"})
+		require.NoError(t, err)
+		require.Len(t, groups, 1)
+		assert.Equal(t, []string{"E100"}, groups[0].Members)
+	})
+
+	t.Run("should build no groups unless configured", func(t *testing.T) {
+		connector := newLoadedConnector(t, "https://api.example.com", groupReport(), WithGroups(GroupOptions{}))
+		assert.Empty(t, connector.index(ctx).groups)
+		assert.Len(t, connector.ResourceSyncers(ctx), 2)
+	})
+}
+
+func TestGroupBuilder(t *testing.T) {
+	ctx := context.Background()
+	connector := newLoadedConnector(t, "https://api.example.com", groupReport(), WithGroups(GroupOptions{Attribute: "department"}))
+	require.Len(t, connector.ResourceSyncers(ctx), 3)
+	g := newGroupBuilder(connector.client, connector)
+
+	t.Run("should list groups with completion aggregates", func(t *testing.T) {
+		resources, nextToken, _, err := g.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		assert.Empty(t, nextToken)
+		require.Len(t, resources, 1)
+		assert.Equal(t, "Engineering", resources[0].DisplayName)
+
+		groupTrait, err := resourceSdk.GetGroupTrait(resources[0])
+		require.NoError(t, err)
+		profile := groupTrait.Profile.AsMap()
+		assert.Equal(t, "department", profile["group_by"])
+		assert.Equal(t, float64(2), profile["members"])
+		assert.Equal(t, float64(3), profile["enrollments"])
+		assert.Equal(t, float64(1), profile["completed"])
+		assert.Equal(t, float64(1), profile["in_progress"])
+		assert.Equal(t, 33.3, profile["completion_rate"])
+	})
+
+	t.Run("should have a member entitlement granted to members", func(t *testing.T) {
+		resource := &v2.Resource{Id: &v2.ResourceId{ResourceType: "group", Resource: "Engineering"}, DisplayName: "Engineering"}
+
+		entitlements, _, _, err := g.Entitlements(ctx, resource, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, entitlements, 1)
+		assert.Equal(t, memberEntitlement, entitlements[0].Slug)
+
+		grants, nextToken, _, err := g.Grants(ctx, resource, &pagination.Token{Size: 1})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		assert.Equal(t, "michael.bolton@initech.com", grants[0].Principal.Id.Resource)
+		assert.Equal(t, "group:Engineering:member", grants[0].Entitlement.Id)
+
+		grants, nextToken, _, err = g.Grants(ctx, resource, &pagination.Token{Size: 1, Token: nextToken})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		assert.Equal(t, "milton.waddams@initech.com", grants[0].Principal.Id.Resource)
+		assert.Empty(t, nextToken)
+	})
+
+	t.Run("should get a group", func(t *testing.T) {
+		resource, _, err := g.Get(ctx, &v2.ResourceId{ResourceType: "group", Resource: "Engineering"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Engineering", resource.Id.Resource)
+
+		_, _, err = g.Get(ctx, &v2.ResourceId{ResourceType: "group", Resource: "Sales"}, nil)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
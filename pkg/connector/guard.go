@@ -0,0 +1,183 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const guardStateKey = "guard-baseline"
+
+// Guardrails stop the connector from publishing a report that would wipe out
+// most users and grants in ConductorOne, e.g. when Percipio hands back an
+// empty or truncated report. Percentages are compared against the baseline
+// recorded by the last sync that passed the guard; 0 disables a check.
+type Guardrails struct {
+	MinRows                  int
+	MaxUserDropPercent       int
+	MaxCourseDropPercent     int
+	MaxCompletionDropPercent int
+}
+
+// reportStats is the baseline persisted between syncs.
+type reportStats struct {
+	Rows        int           `json:"rows"`
+	Users       int           `json:"users"`
+	Courses     int           `json:"courses"`
+	Completions int           `json:"completions"`
+	Lookback    time.Duration `json:"lookback"`
+	RecordedAt  time.Time     `json:"recorded_at"`
+}
+
+func computeReportStats(report *client.Report, store client.StatusesStore, lookback time.Duration) (reportStats, error) {
+	stats := reportStats{
+		Lookback:   lookback,
+		RecordedAt: time.Now().UTC(),
+	}
+	if report == nil {
+		return stats, nil
+	}
+
+	users := make(map[string]struct{})
+	for _, entry := range *report {
+		if entry.UserId != "" {
+			users[entry.UserId] = struct{}{}
+		}
+	}
+
+	stats.Rows = len(*report)
+	stats.Users = len(users)
+	if store == nil {
+		return stats, nil
+	}
+	var err error
+	stats.Courses, err = store.Len()
+	if err != nil {
+		return stats, err
+	}
+	courses, err := store.Courses()
+	if err != nil {
+		return stats, err
+	}
+	for courseId := range courses {
+		err := store.Statuses(courseId, "", func(_ string, status string) bool {
+			if status == completedEntitlement {
+				stats.Completions++
+			}
+			return true
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// check returns a description of every guard the current report trips, or
+// nil if it is safe to publish. previous may be nil on the first sync.
+func (g Guardrails) check(current reportStats, previous *reportStats) []string {
+	var violations []string
+
+	if g.MinRows > 0 && current.Rows < g.MinRows {
+		violations = append(violations, fmt.Sprintf("report has %d rows, fewer than the minimum of %d", current.Rows, g.MinRows))
+	}
+
+	// A different lookback window legitimately changes every count, so the
+	// old baseline is not comparable.
+	if previous == nil || previous.Lookback != current.Lookback {
+		return violations
+	}
+
+	drops := []struct {
+		name     string
+		limit    int
+		previous int
+		current  int
+	}{
+		{"unique users", g.MaxUserDropPercent, previous.Users, current.Users},
+		{"unique courses", g.MaxCourseDropPercent, previous.Courses, current.Courses},
+		{"completed grants", g.MaxCompletionDropPercent, previous.Completions, current.Completions},
+	}
+	for _, drop := range drops {
+		if drop.limit <= 0 || drop.previous == 0 || drop.current >= drop.previous {
+			continue
+		}
+		percent := float64(drop.previous-drop.current) * 100 / float64(drop.previous)
+		if percent > float64(drop.limit) {
+			violations = append(violations, fmt.Sprintf("%s dropped %.1f%% (%d to %d), above the %d%% limit",
+				drop.name, percent, drop.previous, drop.current, drop.limit))
+		}
+	}
+
+	return violations
+}
+
+// enforceGuardrails compares the freshly loaded report with the previous
+// baseline. When a guard trips it returns a FailedPrecondition error and
+// leaves the baseline untouched; otherwise the current report's stats are
+// kept as the pending baseline, which promoteGuardrailBaseline saves once the
+// rest of the sync has succeeded.
+func (d *Connector) enforceGuardrails(ctx context.Context) error {
+	logger := logging.Extract(ctx)
+
+	current, err := computeReportStats(d.report, d.client.StatusesStore, d.reportLookback)
+	if err != nil {
+		return fmt.Errorf("failed to compute report stats: %w", err)
+	}
+
+	var previous *reportStats
+	var baseline reportStats
+	found, err := d.state.Load(guardStateKey, &baseline)
+	if err != nil {
+		// A corrupt baseline shouldn't block syncing forever; it is replaced
+		// below if the current report passes the remaining checks.
+		logger.Warn("Ignoring unreadable guardrail baseline", zap.Error(err))
+	} else if found {
+		previous = &baseline
+	}
+
+	violations := d.guardrails.check(current, previous)
+	if len(violations) > 0 {
+		logger.Error("Report guardrails tripped, refusing to sync",
+			zap.Strings("violations", violations),
+			zap.Any("current", current),
+			zap.Any("previous", previous))
+
+		message := "refusing to publish learning activity report: " + strings.Join(violations, "; ")
+		if d.state.Enabled() {
+			message += fmt.Sprintf(" (if this change is expected, adjust the limits or delete %s)", d.state.Path(guardStateKey))
+		}
+		return status.Error(codes.FailedPrecondition, message)
+	}
+
+	d.pendingBaseline = &current
+
+	logger.Debug("Report passed guardrails",
+		zap.Any("current", current),
+		zap.Any("previous", previous))
+	return nil
+}
+
+// promoteGuardrailBaseline saves the pending baseline once the sync it was
+// computed for has succeeded, so a sync that fails after the guardrails pass
+// doesn't move the baseline.
+func (d *Connector) promoteGuardrailBaseline(ctx context.Context) {
+	d.reportMutex.Lock()
+	defer d.reportMutex.Unlock()
+
+	if d.pendingBaseline == nil {
+		return
+	}
+	if err := d.state.Save(guardStateKey, *d.pendingBaseline); err != nil {
+		logging.Extract(ctx).Warn("Failed to record guardrail baseline", zap.Error(err))
+	}
+	d.pendingBaseline = nil
+}
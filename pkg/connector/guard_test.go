@@ -0,0 +1,179 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
+	"github.com/iiiatthew/baton-percipio-report/test"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGuardrailsCheck(t *testing.T) {
+	guardrails := Guardrails{
+		MinRows:                  1,
+		MaxUserDropPercent:       50,
+		MaxCourseDropPercent:     50,
+		MaxCompletionDropPercent: 50,
+	}
+	previous := &reportStats{Rows: 100, Users: 10, Courses: 4, Completions: 20, Lookback: time.Hour}
+
+	t.Run("should pass on first sync", func(t *testing.T) {
+		violations := guardrails.check(reportStats{Rows: 5, Users: 1, Lookback: time.Hour}, nil)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("should trip on empty report", func(t *testing.T) {
+		violations := guardrails.check(reportStats{Lookback: time.Hour}, nil)
+		require.Len(t, violations, 1)
+		assert.Contains(t, violations[0], "fewer than the minimum")
+	})
+
+	t.Run("should pass small drops", func(t *testing.T) {
+		violations := guardrails.check(reportStats{Rows: 90, Users: 9, Courses: 3, Completions: 15, Lookback: time.Hour}, previous)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("should trip on large drops", func(t *testing.T) {
+		violations := guardrails.check(reportStats{Rows: 20, Users: 2, Courses: 4, Completions: 5, Lookback: time.Hour}, previous)
+		require.Len(t, violations, 2)
+		assert.Contains(t, violations[0], "unique users dropped 80.0% (10 to 2)")
+		assert.Contains(t, violations[1], "completed grants dropped 75.0% (20 to 5)")
+	})
+
+	t.Run("should skip drop checks when lookback changed", func(t *testing.T) {
+		violations := guardrails.check(reportStats{Rows: 1, Users: 1, Lookback: 24 * time.Hour}, previous)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("should skip disabled checks", func(t *testing.T) {
+		violations := Guardrails{}.check(reportStats{Lookback: time.Hour}, previous)
+		assert.Empty(t, violations)
+	})
+}
+
+func TestEnforceGuardrails(t *testing.T) {
+	ctx := context.Background()
+	stateStore := state.New(t.TempDir())
+
+	newConnector := func(report *client.Report) *Connector {
+		statuses := make(client.MapStatusesStore)
+		require.NoError(t, statuses.Load(ctx, report))
+
+		percipioClient, err := client.New(ctx, "https://api.example.com", "test-org", "test-token")
+		require.NoError(t, err)
+		percipioClient.StatusesStore = statuses
+
+		return &Connector{
+			client:         percipioClient,
+			report:         report,
+			reportLookback: time.Hour,
+			state:          stateStore,
+			guardrails:     Guardrails{MinRows: 1, MaxUserDropPercent: 50},
+		}
+	}
+
+	full := &client.Report{
+		{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Completed"},
+		{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Started"},
+		{UserId: "peter.gibbons@initech.com", ContentId: "course1", Status: "Completed"},
+		{UserId: "bill.lumbergh@initech.com", ContentId: "course1", Status: "Completed"},
+	}
+	passed := newConnector(full)
+	require.NoError(t, passed.enforceGuardrails(ctx))
+
+	// The baseline is only saved once the sync succeeds.
+	var baseline reportStats
+	found, err := stateStore.Load(guardStateKey, &baseline)
+	require.NoError(t, err)
+	require.False(t, found)
+	passed.promoteGuardrailBaseline(ctx)
+	found, err = stateStore.Load(guardStateKey, &baseline)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, 4, baseline.Users)
+	assert.Equal(t, 3, baseline.Completions)
+
+	shrunk := &client.Report{
+		{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Completed"},
+	}
+	err = newConnector(shrunk).enforceGuardrails(ctx)
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, err.Error(), "unique users dropped 75.0%")
+	assert.Contains(t, err.Error(), stateStore.Path(guardStateKey))
+
+	// The tripped sync must not overwrite the baseline.
+	found, err = stateStore.Load(guardStateKey, &baseline)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, 4, baseline.Users)
+
+	err = newConnector(&client.Report{}).enforceGuardrails(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fewer than the minimum")
+
+	t.Run("should not move the baseline when the sync fails after the guardrails", func(t *testing.T) {
+		stateDir := t.TempDir()
+		require.NoError(t, state.New(stateDir).Save(guardStateKey, reportStats{Rows: 4, Users: 4, Completions: 3, Lookback: 24 * time.Hour}))
+
+		fixtures := test.FixturesServer()
+		defer fixtures.Close()
+		fixturesURL, err := url.Parse(fixtures.URL)
+		require.NoError(t, err)
+		proxy := httputil.NewSingleHostReverseProxy(fixturesURL)
+		// The report passes the guardrails, but user management is down.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "user-management") {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			proxy.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		connector := newFallbackConnector(t, server.URL, stateDir, 0, WithRoles(true))
+		connector.guardrails = Guardrails{}
+		require.Error(t, connector.generateReport(ctx))
+
+		var baseline reportStats
+		_, err = state.New(stateDir).Load(guardStateKey, &baseline)
+		require.NoError(t, err)
+		assert.Equal(t, 4, baseline.Users)
+	})
+
+	t.Run("should save the baseline once the sync has been cleaned up", func(t *testing.T) {
+		stateDir := t.TempDir()
+		fixtures := test.FixturesServer()
+		defer fixtures.Close()
+		connector := newFallbackConnector(t, fixtures.URL, stateDir, 0, WithGuardrails(Guardrails{MinRows: 1}))
+
+		// Validate generates the report, but the sync can still fail.
+		_, err := connector.Validate(ctx)
+		require.NoError(t, err)
+		found, err := state.New(stateDir).Load(guardStateKey, &reportStats{})
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		connectorServer, err := NewServer(ctx, connector)
+		require.NoError(t, err)
+		_, err = connectorServer.Cleanup(ctx, &v2.ConnectorServiceCleanupRequest{})
+		require.NoError(t, err)
+		var baseline reportStats
+		found, err = state.New(stateDir).Load(guardStateKey, &baseline)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Positive(t, baseline.Rows)
+	})
+}
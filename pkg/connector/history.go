@@ -0,0 +1,73 @@
+package connector
+
+import (
+	"context"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"go.uber.org/zap"
+)
+
+const (
+	everCompletedEntitlement = "ever_completed"
+	statusHistoryStateKey    = "status-history"
+)
+
+// restoreStatusHistory starts the client's status history from the one saved
+// by the last successful sync, so completions that have aged out of the
+// report still count. Without a state directory the history only builds up
+// in memory.
+func (d *Connector) restoreStatusHistory(ctx context.Context) {
+	if !d.everCompletedEnabled || !d.state.Enabled() || d.client == nil {
+		return
+	}
+
+	logger := logging.Extract(ctx)
+	var history client.StatusHistory
+	found, err := d.state.Load(statusHistoryStateKey, &history)
+	if err != nil {
+		logger.Warn("Failed to load saved status history", zap.Error(err))
+	}
+	if !found || err != nil {
+		history = make(client.StatusHistory)
+	}
+	d.client.StatusHistory = history
+}
+
+// saveStatusHistory saves the client's status history for the next sync. It
+// is only called once a sync has succeeded, so a rejected report never joins
+// the history.
+func (d *Connector) saveStatusHistory(ctx context.Context) {
+	if !d.everCompletedEnabled || !d.state.Enabled() || d.client == nil || d.client.StatusHistory == nil {
+		return
+	}
+	if err := d.state.Save(statusHistoryStateKey, d.client.StatusHistory); err != nil {
+		logging.Extract(ctx).Warn("Failed to save status history", zap.Error(err))
+	}
+}
+
+// everCompleted reports whether the ever_completed entitlement is granted to
+// a user on a course, which needs the status history to be kept.
+func (d *Connector) everCompleted(courseId string, userId string) bool {
+	if d == nil || !d.everCompletedEnabled || d.client == nil {
+		return false
+	}
+	return d.client.StatusHistory.EverCompleted(courseId, userId)
+}
+
+// everCompletedGrant returns the ever_completed grant of a user, with when
+// they last completed the course and how many times they did attached.
+func everCompletedGrant(resource *v2.Resource, principalId *v2.ResourceId, history client.StatusHistory, userId string) *v2.Grant {
+	courseId := resource.Id.Resource
+	metadata := map[string]interface{}{
+		"completions": history.Completions(courseId, userId),
+	}
+	if completedAt, ok := history.LastCompleted(courseId, userId); ok && !completedAt.IsZero() {
+		metadata["last_completed_at"] = completedAt.Format(time.RFC3339)
+	}
+	return grant.NewGrant(resource, everCompletedEntitlement, principalId, grant.WithGrantMetadata(metadata))
+}
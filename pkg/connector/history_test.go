@@ -0,0 +1,113 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
+	"github.com/iiiatthew/baton-percipio-report/test"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func historyReport() *client.Report {
+	return &client.Report{
+		{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Completed", CompletedDate: "2021-05-10T00:00:00Z"},
+		{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Started", LastAccess: "2024-03-01T00:00:00Z"},
+		{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Started"},
+	}
+}
+
+func TestEverCompleted(t *testing.T) {
+	ctx := context.Background()
+	course := &v2.Resource{DisplayName: "Compliance", Id: &v2.ResourceId{ResourceType: "course", Resource: "course1"}}
+
+	t.Run("should grant ever completed to users who have since restarted", func(t *testing.T) {
+		connector := newLoadedConnector(t, "https://api.example.com", historyReport(), WithEverCompleted(true))
+		c := newCourseBuilder(connector.client, connector.report, connector)
+
+		entitlements, _, _, err := c.Entitlements(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{everCompletedEntitlement, inProgressEntitlement}, entitlementSlugs(entitlements))
+		assert.Equal(t, "Completed course Compliance in Percipio at least once", entitlements[0].Description)
+
+		grants, _, _, err := c.Grants(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 3)
+		assert.Equal(t, "course:course1:in_progress", grants[0].Entitlement.Id)
+		assert.Equal(t, "course:course1:ever_completed", grants[1].Entitlement.Id)
+		assert.Equal(t, "michael.bolton@initech.com", grants[1].Principal.Id.Resource)
+
+		metadata := &v2.GrantMetadata{}
+		annos := annotations.Annotations(grants[1].Annotations)
+		ok, err := annos.Pick(metadata)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, map[string]interface{}{
+			"completions":       float64(1),
+			"last_completed_at": "2021-05-10T00:00:00Z",
+		}, metadata.Metadata.AsMap())
+	})
+
+	t.Run("should not grant ever completed unless enabled", func(t *testing.T) {
+		connector := newLoadedConnector(t, "https://api.example.com", historyReport(), WithEverCompleted(false))
+		c := newCourseBuilder(connector.client, connector.report, connector)
+
+		grants, _, _, err := c.Grants(ctx, course, &pagination.Token{})
+		require.NoError(t, err)
+		assert.Len(t, grants, 2)
+	})
+}
+
+func TestStatusHistoryAcrossSyncs(t *testing.T) {
+	ctx := context.Background()
+	completedAt := time.Date(2021, 5, 10, 0, 0, 0, 0, time.UTC)
+	saved := client.StatusHistory{
+		"retired-course": {
+			"michael.bolton@initech.com": {{Status: "completed", At: completedAt, Current: true}},
+		},
+	}
+
+	t.Run("should keep completions from earlier syncs", func(t *testing.T) {
+		stateDir := t.TempDir()
+		require.NoError(t, state.New(stateDir).Save(statusHistoryStateKey, saved))
+
+		server := test.FixturesServer()
+		defer server.Close()
+		connector := newFallbackConnector(t, server.URL, stateDir, 0, WithEverCompleted(true))
+		require.NoError(t, connector.generateReport(ctx))
+
+		assert.True(t, connector.everCompleted("retired-course", "michael.bolton@initech.com"))
+		// The saved completion is no longer current: the report doesn't have it.
+		_, ok := connector.client.StatusHistory.Current("retired-course", "michael.bolton@initech.com")
+		assert.False(t, ok)
+
+		var history client.StatusHistory
+		found, err := state.New(stateDir).Load(statusHistoryStateKey, &history)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.True(t, history.EverCompleted("retired-course", "michael.bolton@initech.com"))
+		assert.Greater(t, len(history), 1)
+	})
+
+	t.Run("should not save the history of a failed sync", func(t *testing.T) {
+		stateDir := t.TempDir()
+		require.NoError(t, state.New(stateDir).Save(statusHistoryStateKey, saved))
+
+		failing := failingReportServer(false)
+		defer failing.Close()
+		connector := newFallbackConnector(t, failing.URL, stateDir, 0, WithEverCompleted(true))
+		require.Error(t, connector.generateReport(ctx))
+
+		var history client.StatusHistory
+		_, err := state.New(stateDir).Load(statusHistoryStateKey, &history)
+		require.NoError(t, err)
+		assert.Equal(t, saved, history)
+	})
+}
@@ -0,0 +1,167 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	percipioUserIdColumn = "userId"
+	emailAddressColumn   = "emailAddress"
+
+	quarantineStateKey = "quarantined-users"
+
+	// synthesizedIdPrefix marks resource IDs made up for users whose
+	// identifier column is empty.
+	synthesizedIdPrefix = "percipio:"
+)
+
+// MissingIdPolicy is what happens to users whose identifier column is empty.
+type MissingIdPolicy string
+
+const (
+	// MissingIdSkip leaves the user and their grants out of the sync.
+	MissingIdSkip MissingIdPolicy = "skip"
+	// MissingIdQuarantine leaves them out too, but records them in the state
+	// directory for review.
+	MissingIdQuarantine MissingIdPolicy = "quarantine"
+	// MissingIdSynthesize identifies them by their Percipio user ID instead.
+	MissingIdSynthesize MissingIdPolicy = "synthesize"
+)
+
+// MissingIdPolicies lists the valid missing identifier policies.
+var MissingIdPolicies = []string{
+	string(MissingIdSkip),
+	string(MissingIdQuarantine),
+	string(MissingIdSynthesize),
+}
+
+// UserIdentity configures which report columns identify users and link them
+// to accounts elsewhere. The zero value identifies users by their Percipio
+// user ID and email address, as the report does.
+type UserIdentity struct {
+	// IdField is the column used as the user resource ID.
+	IdField string
+	// LoginField is the column used as the user trait's login.
+	LoginField string
+	// EmailFields are the columns holding email addresses; the first one
+	// set is the primary email.
+	EmailFields []string
+	// EmployeeIdFields are the columns holding employee IDs.
+	EmployeeIdFields []string
+	// MissingId is what happens to users whose IdField is empty.
+	MissingId MissingIdPolicy
+}
+
+func (i UserIdentity) idField() string {
+	if i.IdField == "" {
+		return percipioUserIdColumn
+	}
+	return i.IdField
+}
+
+func (i UserIdentity) emailFields() []string {
+	if len(i.EmailFields) == 0 {
+		return []string{emailAddressColumn}
+	}
+	return i.EmailFields
+}
+
+// usesPercipioId reports whether user resource IDs are Percipio user IDs, so
+// no mapping is needed between the two.
+func (i UserIdentity) usesPercipioId() bool {
+	return i.idField() == percipioUserIdColumn
+}
+
+// columns returns every column the identity reads.
+func (i UserIdentity) columns() []string {
+	columns := []string{i.idField()}
+	if i.LoginField != "" {
+		columns = append(columns, i.LoginField)
+	}
+	columns = append(columns, i.emailFields()...)
+	columns = append(columns, i.EmployeeIdFields...)
+	slices.Sort(columns)
+	return slices.Compact(columns)
+}
+
+// validate checks the identity configuration.
+func (i UserIdentity) validate() error {
+	switch i.MissingId {
+	case "", MissingIdSkip, MissingIdQuarantine, MissingIdSynthesize:
+		return nil
+	default:
+		return fmt.Errorf("invalid missing identifier policy %q: expected one of %v", i.MissingId, MissingIdPolicies)
+	}
+}
+
+// quarantinedUser is a user left out of the sync because their identifier
+// column was empty.
+type quarantinedUser struct {
+	PercipioUserId string `json:"percipio_user_id"`
+	Email          string `json:"email,omitempty"`
+	FirstName      string `json:"first_name,omitempty"`
+	LastName       string `json:"last_name,omitempty"`
+}
+
+// quarantineRecord is the list of quarantined users from the last sync.
+type quarantineRecord struct {
+	RecordedAt time.Time         `json:"recorded_at"`
+	IdField    string            `json:"id_field"`
+	Users      []quarantinedUser `json:"users"`
+}
+
+// reportMissingIds logs the users left out for lacking an identifier and,
+// when quarantining, records them in the state directory.
+func (d *Connector) reportMissingIds(ctx context.Context, missing []quarantinedUser) {
+	logger := logging.Extract(ctx)
+	idField := d.identity.idField()
+
+	if d.identity.MissingId != MissingIdQuarantine {
+		if len(missing) > 0 {
+			logger.Info("Skipped users without an identifier",
+				zap.String("id_field", idField),
+				zap.Int("skipped_users", len(missing)))
+		}
+		return
+	}
+
+	if !d.state.Enabled() {
+		if len(missing) > 0 {
+			logger.Warn("Quarantined users without an identifier; set a state directory to record them",
+				zap.String("id_field", idField),
+				zap.Int("quarantined_users", len(missing)))
+		}
+		return
+	}
+	if len(missing) > 0 {
+		logger.Warn("Quarantined users without an identifier",
+			zap.String("id_field", idField),
+			zap.Int("quarantined_users", len(missing)),
+			zap.String("state_file", d.state.Path(quarantineStateKey)))
+	}
+
+	err := d.state.Save(quarantineStateKey, quarantineRecord{
+		RecordedAt: time.Now().UTC(),
+		IdField:    idField,
+		Users:      missing,
+	})
+	if err != nil {
+		logger.Warn("Failed to save quarantined users", zap.Error(err))
+	}
+}
+
+// userResourceId returns the resource ID of the user with the given Percipio
+// user ID, or false if that user isn't published.
+func (d *Connector) userResourceId(ctx context.Context, percipioUserId string) (string, bool) {
+	if d == nil || d.identity.usesPercipioId() {
+		return percipioUserId, true
+	}
+	resourceId, ok := d.index(ctx).userResourceIds[percipioUserId]
+	return resourceId, ok
+}
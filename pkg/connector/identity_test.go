@@ -0,0 +1,271 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// identityReport has one user with every identifier, one whose latest row
+// lacks some, one without an employee ID and two sharing an employee ID.
+func identityReport() *client.Report {
+	return &client.Report{
+		{
+			UserId:        "b2f4",
+			FirstName:     "Michael",
+			LastName:      "Bolton",
+			EmailAddress:  "michael.bolton@initech.com",
+			ContentId:     "course1",
+			Status:        "Completed",
+			CompletedDate: "2025-01-10T00:00:00.000Z",
+			Attributes:    map[string]string{"employeeId": "E100", "login": "mbolton", "personalEmail": "mb@example.com"},
+		},
+		{
+			UserId:        "b2f4",
+			FirstName:     "Michael",
+			LastName:      "Bolton",
+			ContentId:     "course2",
+			Status:        "Started",
+			CompletedDate: "2025-06-20T00:00:00.000Z",
+		},
+		{
+			UserId:       "c3a5",
+			FirstName:    "Milton",
+			LastName:     "Waddams",
+			EmailAddress: "milton.waddams@initech.com",
+			ContentId:    "course1",
+			Status:       "Started",
+		},
+		{
+			UserId:     "d4b6",
+			FirstName:  "Peter",
+			LastName:   "Gibbons",
+			ContentId:  "course1",
+			Status:     "Completed",
+			Attributes: map[string]string{"employeeId": "E200"},
+		},
+		{
+			UserId:     "e5c7",
+			FirstName:  "Peter",
+			LastName:   "Gibbons",
+			ContentId:  "course2",
+			Status:     "Completed",
+			Attributes: map[string]string{"employeeId": "E200"},
+		},
+	}
+}
+
+func TestBuildUserIndexIdentity(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should identify users by Percipio user ID by default", func(t *testing.T) {
+		users, resourceIds, missing := buildUserIndex(ctx, identityReport(), UserIdentity{}, nil)
+		require.Len(t, users, 4)
+		assert.Nil(t, resourceIds)
+		assert.Empty(t, missing)
+
+		assert.Equal(t, "b2f4", users[0].Id)
+		// The latest row has no email, so the most recent one seen is kept.
+		assert.Equal(t, "michael.bolton@initech.com", users[0].Email)
+		assert.Equal(t, "", users[2].Email)
+	})
+
+	t.Run("should use the configured identifier and linking columns", func(t *testing.T) {
+		identity := UserIdentity{
+			IdField:          "employeeId",
+			LoginField:       "login",
+			EmailFields:      []string{"emailAddress", "personalEmail"},
+			EmployeeIdFields: []string{"employeeId"},
+		}
+		users, resourceIds, missing := buildUserIndex(ctx, identityReport(), identity, nil)
+
+		require.Len(t, users, 2)
+		assert.Equal(t, client.User{
+			Id:               "E100",
+			PercipioUserId:   "b2f4",
+			FirstName:        "Michael",
+			LastName:         "Bolton",
+			Email:            "michael.bolton@initech.com",
+			AdditionalEmails: []string{"mb@example.com"},
+			Login:            "mbolton",
+			EmployeeIds:      []string{"E100"},
+			LastActivity:     time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC),
+		}, users[0])
+		assert.Equal(t, "E200", users[1].Id)
+
+		assert.Equal(t, map[string]string{"b2f4": "E100", "d4b6": "E200", "e5c7": "E200"}, resourceIds)
+		assert.Equal(t, []quarantinedUser{
+			{PercipioUserId: "c3a5", Email: "milton.waddams@initech.com", FirstName: "Milton", LastName: "Waddams"},
+		}, missing)
+	})
+
+	t.Run("should synthesize missing identifiers", func(t *testing.T) {
+		identity := UserIdentity{IdField: "employeeId", MissingId: MissingIdSynthesize}
+		users, resourceIds, missing := buildUserIndex(ctx, identityReport(), identity, nil)
+
+		require.Len(t, users, 3)
+		assert.Empty(t, missing)
+		assert.Equal(t, "percipio:c3a5", resourceIds["c3a5"])
+		assert.Equal(t, "percipio:c3a5", users[2].Id)
+	})
+}
+
+func TestUserResourceIdentity(t *testing.T) {
+	t.Run("should leave out missing emails", func(t *testing.T) {
+		resource, err := userResource(client.User{Id: "c3a5", FirstName: "Milton", LastName: "Waddams"}, nil)
+		require.NoError(t, err)
+
+		userTrait, err := resourceSdk.GetUserTrait(resource)
+		require.NoError(t, err)
+		assert.Empty(t, userTrait.Emails)
+		assert.Empty(t, userTrait.Login)
+	})
+
+	t.Run("should set linking fields", func(t *testing.T) {
+		resource, err := userResource(client.User{
+			Id:               "E100",
+			PercipioUserId:   "b2f4",
+			Email:            "michael.bolton@initech.com",
+			AdditionalEmails: []string{"mb@example.com"},
+			Login:            "mbolton",
+			EmployeeIds:      []string{"E100"},
+		}, nil)
+		require.NoError(t, err)
+
+		userTrait, err := resourceSdk.GetUserTrait(resource)
+		require.NoError(t, err)
+		require.Len(t, userTrait.Emails, 2)
+		assert.Equal(t, "michael.bolton@initech.com", userTrait.Emails[0].Address)
+		assert.True(t, userTrait.Emails[0].IsPrimary)
+		assert.Equal(t, "mb@example.com", userTrait.Emails[1].Address)
+		assert.False(t, userTrait.Emails[1].IsPrimary)
+		assert.Equal(t, "mbolton", userTrait.Login)
+		assert.Equal(t, []string{"E100"}, userTrait.EmployeeIds)
+		assert.Equal(t, "b2f4", userTrait.Profile.AsMap()["percipio_user_id"])
+	})
+}
+
+func TestIdentityGrants(t *testing.T) {
+	ctx := context.Background()
+
+	report := identityReport()
+	percipioClient, err := client.New(ctx, "https://api.example.com", "test-org", "test-token")
+	require.NoError(t, err)
+	require.NoError(t, percipioClient.LoadReport(ctx, report))
+
+	connector := &Connector{
+		client:      percipioClient,
+		report:      report,
+		reportState: ReportCompleted,
+		identity:    UserIdentity{IdField: "employeeId"},
+	}
+	c := newCourseBuilder(percipioClient, nil, connector)
+
+	course := &v2.Resource{Id: &v2.ResourceId{ResourceType: "course", Resource: "course1"}}
+	grants, _, _, err := c.Grants(ctx, course, &pagination.Token{})
+	require.NoError(t, err)
+
+	// Milton has no employee ID, so his grant is left out with him.
+	require.Len(t, grants, 2)
+	assert.Equal(t, "E100", grants[0].Principal.Id.Resource)
+	assert.Equal(t, "E200", grants[1].Principal.Id.Resource)
+
+	course = &v2.Resource{Id: &v2.ResourceId{ResourceType: "course", Resource: "course2"}}
+	grants, _, _, err = c.Grants(ctx, course, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 2)
+	assert.Equal(t, "E100", grants[0].Principal.Id.Resource)
+	assert.Equal(t, "E200", grants[1].Principal.Id.Resource)
+}
+
+func TestIdentityGrantsAcrossPages(t *testing.T) {
+	ctx := context.Background()
+
+	// a1 and c3 share an employee ID but sort apart by Percipio user ID.
+	report := &client.Report{
+		{UserId: "a1", ContentId: "course1", Status: "Completed", Attributes: map[string]string{"employeeId": "E100"}},
+		{UserId: "b2", ContentId: "course1", Status: "Completed", Attributes: map[string]string{"employeeId": "E200"}},
+		{UserId: "c3", ContentId: "course1", Status: "Completed", Attributes: map[string]string{"employeeId": "E100"}},
+	}
+	percipioClient, err := client.New(ctx, "https://api.example.com", "test-org", "test-token")
+	require.NoError(t, err)
+	require.NoError(t, percipioClient.LoadReport(ctx, report))
+
+	connector := &Connector{
+		client:      percipioClient,
+		report:      report,
+		reportState: ReportCompleted,
+		identity:    UserIdentity{IdField: "employeeId"},
+		pageSize:    1,
+	}
+	c := newCourseBuilder(percipioClient, nil, connector)
+	course := &v2.Resource{Id: &v2.ResourceId{ResourceType: "course", Resource: "course1"}}
+
+	var principals []string
+	token := &pagination.Token{}
+	for {
+		grants, nextToken, _, err := c.Grants(ctx, course, token)
+		require.NoError(t, err)
+		for _, g := range grants {
+			principals = append(principals, g.Principal.Id.Resource)
+		}
+		if nextToken == "" {
+			break
+		}
+		token = &pagination.Token{Token: nextToken}
+	}
+	assert.Equal(t, []string{"E100", "E200"}, principals)
+}
+
+func TestReportMissingIds(t *testing.T) {
+	ctx := context.Background()
+	missing := []quarantinedUser{{PercipioUserId: "c3a5", Email: "milton.waddams@initech.com"}}
+
+	t.Run("should record quarantined users", func(t *testing.T) {
+		stateStore := state.New(t.TempDir())
+		connector := &Connector{
+			state:    stateStore,
+			identity: UserIdentity{IdField: "employeeId", MissingId: MissingIdQuarantine},
+		}
+		connector.reportMissingIds(ctx, missing)
+
+		var record quarantineRecord
+		found, err := stateStore.Load(quarantineStateKey, &record)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, "employeeId", record.IdField)
+		assert.Equal(t, missing, record.Users)
+		assert.WithinDuration(t, time.Now(), record.RecordedAt, time.Minute)
+	})
+
+	t.Run("should not record skipped users", func(t *testing.T) {
+		stateStore := state.New(t.TempDir())
+		connector := &Connector{
+			state:    stateStore,
+			identity: UserIdentity{IdField: "employeeId", MissingId: MissingIdSkip},
+		}
+		connector.reportMissingIds(ctx, missing)
+
+		found, err := stateStore.Load(quarantineStateKey, &quarantineRecord{})
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+}
+
+func TestUserIdentityValidate(t *testing.T) {
+	assert.NoError(t, UserIdentity{}.validate())
+	assert.NoError(t, UserIdentity{MissingId: MissingIdQuarantine}.validate())
+
+	err := UserIdentity{MissingId: "ignore"}.validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid missing identifier policy "ignore"`)
+}
@@ -0,0 +1,165 @@
+package connector
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// reportIndex holds the sorted users and courses extracted from a report, so
+// paginated List calls don't re-scan the whole report for every page.
+type reportIndex struct {
+	report  *client.Report
+	catalog *catalogIndex
+	users   []client.User
+	courses []client.Course
+	groups  []client.Group
+	// groupsErr is why groups couldn't be built, returned when they are
+	// listed.
+	groupsErr error
+	roles     []role
+	// roleDirectory is the user management data roles were built from.
+	roleDirectory *roleDirectory
+	assessments   assessmentResults
+	// assignmentDirectory is the assignment data assignments were built
+	// from.
+	assignmentDirectory *assignmentDirectory
+	assignments         courseAssignments
+
+	// userResourceIds maps Percipio user IDs to user resource IDs. It is
+	// nil when the two are the same.
+	userResourceIds map[string]string
+}
+
+// index returns the index for the currently loaded report, building it on
+// first use and rebuilding it if the report, catalog, user management or
+// assignment data has been replaced.
+func (d *Connector) index(ctx context.Context) *reportIndex {
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	if d.reportIndex == nil ||
+		d.reportIndex.report != d.report ||
+		d.reportIndex.catalog != d.catalog ||
+		d.reportIndex.roleDirectory != d.roles ||
+		d.reportIndex.assignmentDirectory != d.assignments {
+		users, userResourceIds, missing, courses := scanReport(ctx, d.report, d.identity, d.userAttributes)
+		d.reportMissingIds(ctx, missing)
+		reportUsers := len(users)
+		var roles []role
+		if d.rolesEnabled {
+			var added []client.User
+			roles, added = buildRoleIndex(ctx, d.roles, users, userResourceIds)
+			users = append(users, added...)
+		}
+		assignments := buildAssignmentIndex(d.assignments, d.mergedUserIds)
+		var assignedCourses []client.Course
+		if d.assignmentsEnabled {
+			users = append(users, buildAssignedUsers(ctx, assignments, users, userResourceIds, d.roles)...)
+			if assignedCourses = buildAssignedCourses(assignments, courses); len(assignedCourses) > 0 {
+				courses = append(courses, assignedCourses...)
+				slices.SortFunc(courses, func(a, b client.Course) int {
+					return strings.Compare(a.Id, b.Id)
+				})
+			}
+		}
+		if len(users) > reportUsers {
+			slices.SortFunc(users, func(a, b client.User) int {
+				return strings.Compare(a.Id, b.Id)
+			})
+		}
+		if dormant := markDormant(users, d.dormancyWindow, time.Now()); dormant > 0 {
+			logging.Extract(ctx).Info("Flagged dormant users",
+				zap.Int("dormant_users", dormant),
+				zap.Duration("dormancy_window", d.dormancyWindow))
+		}
+		var statuses client.StatusesStore
+		if d.client != nil {
+			statuses = d.client.StatusesStore
+		}
+		groups, groupsErr := buildGroupIndex(ctx, d.report, statuses, users, userResourceIds, d.groupOptions)
+		if groupsErr != nil {
+			logging.Extract(ctx).Error("Failed to build groups", zap.Error(groupsErr))
+		}
+		courses = d.enrichCourses(courses)
+		titleAssignedCourses(courses, assignedCourses)
+		d.reportIndex = &reportIndex{
+			report:              d.report,
+			catalog:             d.catalog,
+			users:               users,
+			courses:             courses,
+			groups:              groups,
+			groupsErr:           groupsErr,
+			roles:               roles,
+			roleDirectory:       d.roles,
+			assessments:         buildAssessmentIndex(d.report, d.assessments),
+			assignmentDirectory: d.assignments,
+			assignments:         assignments,
+			userResourceIds:     userResourceIds,
+		}
+	}
+	return d.reportIndex
+}
+
+// scanReport extracts the users and courses of a report in a single pass over
+// its rows; see buildUserIndex and buildCourseIndex. The other reads of the
+// report take passes of their own: the statuses store and status history are
+// loaded from it when it is fetched, and assessments and groups are indexed
+// from it here.
+func scanReport(
+	ctx context.Context,
+	report *client.Report,
+	identity UserIdentity,
+	attributes map[string]string,
+) ([]client.User, map[string]string, []quarantinedUser, []client.Course) {
+	if report == nil || len(*report) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	userExtractor := newUserExtractor(ctx, identity, attributes)
+	courseExtractor := newCourseExtractor(ctx)
+	for i := range *report {
+		entry := &(*report)[i]
+		userExtractor.add(entry)
+		courseExtractor.add(entry)
+	}
+	users, resourceIds, missing := userExtractor.finish(len(*report))
+	return users, resourceIds, missing, courseExtractor.finish(len(*report))
+}
+
+// user returns the indexed user with the given ID.
+func (i *reportIndex) user(id string) (client.User, bool) {
+	n, found := slices.BinarySearchFunc(i.users, id, func(user client.User, id string) int {
+		return strings.Compare(user.Id, id)
+	})
+	if !found {
+		return client.User{}, false
+	}
+	return i.users[n], true
+}
+
+// course returns the indexed course with the given ID.
+func (i *reportIndex) course(id string) (client.Course, bool) {
+	n, found := slices.BinarySearchFunc(i.courses, id, func(course client.Course, id string) int {
+		return strings.Compare(course.Id, id)
+	})
+	if !found {
+		return client.Course{}, false
+	}
+	return i.courses[n], true
+}
+
+// reportLoaded reports whether a completed report is available to answer
+// lookups from.
+func (d *Connector) reportLoaded() bool {
+	d.reportMutex.RLock()
+	defer d.reportMutex.RUnlock()
+
+	return d.reportState == ReportCompleted && d.report != nil
+}
@@ -78,7 +78,9 @@ func TestIntegrationConnectorFlow(t *testing.T) {
 		if len(courses) > 0 {
 			entitlements, _, _, err := courseSyncer.Entitlements(ctx, courses[0], nil)
 			require.NoError(t, err)
-			assert.Len(t, entitlements, 5) // assigned, completed, in_progress, no_status_reported, status_undefined
+			// Only the statuses learners have on the course
+			assert.NotEmpty(t, entitlements)
+			assert.Subset(t, CourseEntitlements, entitlementSlugs(entitlements))
 		}
 
 		// Test course grants
@@ -0,0 +1,211 @@
+package connector
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// MergeByEmail merges users sharing any email address from the identity's
+// email columns.
+const MergeByEmail = "email"
+
+// userMerge records a Percipio user merged into another.
+type userMerge struct {
+	PercipioUserId string
+	SurvivorId     string
+	MatchedOn      string
+	MatchedValue   string
+}
+
+// mergeCandidate is what mergeUsers knows about a Percipio user.
+type mergeCandidate struct {
+	id        string
+	firstSeen time.Time
+	keys      [][2]string
+}
+
+// normalizeMergeValue makes values that only differ in case or surrounding
+// whitespace match, as happens when someone's email address is re-entered.
+func normalizeMergeValue(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// mergeUsers finds the Percipio users that are the same person, because they
+// share a normalized value of one of the mergeBy keys: MergeByEmail or a
+// report column. Matches are transitive. Each group of users is merged into
+// the one seen first in the report (by earliest activity date, then lowest
+// user ID), so a recreated account joins the original rather than replacing
+// it. The merges are returned ordered by merged user ID.
+func mergeUsers(report *client.Report, identity UserIdentity, mergeBy []string) []userMerge {
+	if report == nil || len(mergeBy) == 0 {
+		return nil
+	}
+
+	candidates := make(map[string]*mergeCandidate)
+	for _, entry := range *report {
+		if entry.UserId == "" {
+			continue
+		}
+		candidate, ok := candidates[entry.UserId]
+		if !ok {
+			candidate = &mergeCandidate{id: entry.UserId}
+			candidates[entry.UserId] = candidate
+		}
+		if date := entry.EarliestActivity(); !date.IsZero() && (candidate.firstSeen.IsZero() || date.Before(candidate.firstSeen)) {
+			candidate.firstSeen = date
+		}
+		for _, key := range mergeBy {
+			columns := []string{key}
+			if key == MergeByEmail {
+				columns = identity.emailFields()
+			}
+			for _, column := range columns {
+				value := normalizeMergeValue(entry.Column(column))
+				if value != "" && !slices.Contains(candidate.keys, [2]string{key, value}) {
+					candidate.keys = append(candidate.keys, [2]string{key, value})
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(candidates))
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	// Union the users sharing a key.
+	parents := make(map[string]string, len(ids))
+	var find func(id string) string
+	find = func(id string) string {
+		parent, ok := parents[id]
+		if !ok || parent == id {
+			return id
+		}
+		root := find(parent)
+		parents[id] = root
+		return root
+	}
+	owners := make(map[[2]string]string)
+	for _, id := range ids {
+		for _, key := range candidates[id].keys {
+			owner, ok := owners[key]
+			if !ok {
+				owners[key] = id
+				continue
+			}
+			if root, ownerRoot := find(id), find(owner); root != ownerRoot {
+				parents[root] = ownerRoot
+			}
+		}
+	}
+
+	groups := make(map[string][]*mergeCandidate)
+	for _, id := range ids {
+		root := find(id)
+		groups[root] = append(groups[root], candidates[id])
+	}
+
+	var merges []userMerge
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		survivor := slices.MinFunc(group, func(a, b *mergeCandidate) int {
+			// Users without any activity date sort last.
+			if a.firstSeen.IsZero() != b.firstSeen.IsZero() {
+				if a.firstSeen.IsZero() {
+					return 1
+				}
+				return -1
+			}
+			return cmp.Or(a.firstSeen.Compare(b.firstSeen), strings.Compare(a.id, b.id))
+		})
+		for _, candidate := range group {
+			if candidate == survivor {
+				continue
+			}
+			match := sharedMergeKey(candidate, group)
+			merges = append(merges, userMerge{
+				PercipioUserId: candidate.id,
+				SurvivorId:     survivor.id,
+				MatchedOn:      match[0],
+				MatchedValue:   match[1],
+			})
+		}
+	}
+	slices.SortFunc(merges, func(a, b userMerge) int {
+		return strings.Compare(a.PercipioUserId, b.PercipioUserId)
+	})
+	return merges
+}
+
+// sharedMergeKey returns the first key the candidate shares with another user
+// in its group, for logging why it was merged.
+func sharedMergeKey(candidate *mergeCandidate, group []*mergeCandidate) [2]string {
+	for _, key := range candidate.keys {
+		for _, other := range group {
+			if other != candidate && slices.Contains(other.keys, key) {
+				return key
+			}
+		}
+	}
+	return [2]string{}
+}
+
+// resolveIdentities merges duplicate users in the loaded report: their rows
+// and their statuses are moved to the surviving user, so the rest of the sync
+// sees a single user. Every merge is logged. Must be called with reportMutex
+// held, after the report is loaded and saved for fallback.
+func (d *Connector) resolveIdentities(ctx context.Context) error {
+	d.mergedUserIds = nil
+	if len(d.mergeUsersBy) == 0 || d.report == nil {
+		return nil
+	}
+
+	logger := logging.Extract(ctx)
+	merges := mergeUsers(d.report, d.identity, d.mergeUsersBy)
+	if len(merges) == 0 {
+		logger.Debug("No duplicate users to merge", zap.Strings("merge_users_by", d.mergeUsersBy))
+		return nil
+	}
+
+	survivors := make(map[string]string, len(merges))
+	for _, merge := range merges {
+		survivors[merge.PercipioUserId] = merge.SurvivorId
+		logger.Info("Merging duplicate user",
+			zap.String("merged_user_id", merge.PercipioUserId),
+			zap.String("survivor_user_id", merge.SurvivorId),
+			zap.String("matched_on", merge.MatchedOn),
+			zap.String("matched_value", merge.MatchedValue))
+	}
+
+	rows := 0
+	for i := range *d.report {
+		if survivor, ok := survivors[(*d.report)[i].UserId]; ok {
+			(*d.report)[i].UserId = survivor
+			rows++
+		}
+	}
+	statuses, err := d.client.StatusesStore.Merge(survivors)
+	if err != nil {
+		return err
+	}
+	observations := d.client.StatusHistory.Merge(survivors)
+	d.mergedUserIds = survivors
+
+	logger.Info("Merged duplicate users",
+		zap.Int("merged_users", len(merges)),
+		zap.Int("rewritten_rows", rows),
+		zap.Int("rewritten_statuses", statuses),
+		zap.Int("rewritten_observations", observations))
+	return nil
+}
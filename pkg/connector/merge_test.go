@@ -0,0 +1,144 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// duplicateReport has Michael's original account, a recreated one with his
+// email in another case, Milton under two user IDs sharing only an employee
+// ID, and Peter, who has no duplicate.
+func duplicateReport() *client.Report {
+	return &client.Report{
+		{
+			UserId:       "f1a2",
+			FirstName:    "Michael",
+			LastName:     "Bolton",
+			EmailAddress: "Michael.Bolton@initech.com",
+			ContentId:    "course2",
+			Status:       "Started",
+			FirstAccess:  "2025-05-01T00:00:00.000Z",
+			LastAccess:   "2025-05-02T00:00:00.000Z",
+		},
+		{
+			UserId:        "b2f4",
+			FirstName:     "Michael",
+			LastName:      "Bolton",
+			EmailAddress:  "michael.bolton@initech.com",
+			ContentId:     "course1",
+			Status:        "Completed",
+			FirstAccess:   "2024-01-10T00:00:00.000Z",
+			CompletedDate: "2024-01-11T00:00:00.000Z",
+		},
+		{
+			UserId:       "f1a2",
+			FirstName:    "Michael",
+			LastName:     "Bolton",
+			EmailAddress: "Michael.Bolton@initech.com",
+			ContentId:    "course1",
+			Status:       "Started",
+			FirstAccess:  "2025-05-01T00:00:00.000Z",
+		},
+		{
+			UserId:       "c3a5",
+			FirstName:    "Milton",
+			LastName:     "Waddams",
+			EmailAddress: "milton.waddams@initech.com",
+			ContentId:    "course1",
+			Status:       "Started",
+			Attributes:   map[string]string{"employeeId": "E300"},
+		},
+		{
+			UserId:       "a0c3",
+			FirstName:    "Milton",
+			LastName:     "Waddams",
+			EmailAddress: "milton@example.com",
+			ContentId:    "course2",
+			Status:       "Completed",
+			Attributes:   map[string]string{"employeeId": " e300 "},
+		},
+		{
+			UserId:       "d4b6",
+			FirstName:    "Peter",
+			LastName:     "Gibbons",
+			EmailAddress: "peter.gibbons@initech.com",
+			ContentId:    "course1",
+			Status:       "Completed",
+		},
+	}
+}
+
+func TestMergeUsers(t *testing.T) {
+	t.Run("should merge users by normalized email into the oldest account", func(t *testing.T) {
+		merges := mergeUsers(duplicateReport(), UserIdentity{}, []string{MergeByEmail})
+		assert.Equal(t, []userMerge{
+			{PercipioUserId: "f1a2", SurvivorId: "b2f4", MatchedOn: MergeByEmail, MatchedValue: "michael.bolton@initech.com"},
+		}, merges)
+	})
+
+	t.Run("should merge users by a report column", func(t *testing.T) {
+		merges := mergeUsers(duplicateReport(), UserIdentity{}, []string{MergeByEmail, "employeeId"})
+		// Neither Milton has an activity date, so the lowest user ID survives.
+		assert.Equal(t, []userMerge{
+			{PercipioUserId: "c3a5", SurvivorId: "a0c3", MatchedOn: "employeeId", MatchedValue: "e300"},
+			{PercipioUserId: "f1a2", SurvivorId: "b2f4", MatchedOn: MergeByEmail, MatchedValue: "michael.bolton@initech.com"},
+		}, merges)
+	})
+
+	t.Run("should merge transitively", func(t *testing.T) {
+		report := &client.Report{
+			{UserId: "u1", EmailAddress: "a@initech.com", FirstAccess: "2025-03-01"},
+			{UserId: "u2", EmailAddress: "a@initech.com", Attributes: map[string]string{"employeeId": "E1"}, FirstAccess: "2025-02-01"},
+			{UserId: "u3", Attributes: map[string]string{"employeeId": "E1"}, FirstAccess: "2025-01-01"},
+		}
+		merges := mergeUsers(report, UserIdentity{}, []string{MergeByEmail, "employeeId"})
+		require.Len(t, merges, 2)
+		assert.Equal(t, "u1", merges[0].PercipioUserId)
+		assert.Equal(t, "u3", merges[0].SurvivorId)
+		assert.Equal(t, "u2", merges[1].PercipioUserId)
+		assert.Equal(t, "u3", merges[1].SurvivorId)
+	})
+
+	t.Run("should do nothing without merge keys", func(t *testing.T) {
+		assert.Empty(t, mergeUsers(duplicateReport(), UserIdentity{}, nil))
+	})
+}
+
+func TestResolveIdentities(t *testing.T) {
+	ctx := context.Background()
+
+	report := duplicateReport()
+	percipioClient, err := client.New(ctx, "https://api.example.com", "test-org", "test-token")
+	require.NoError(t, err)
+	require.NoError(t, percipioClient.LoadReport(ctx, report))
+
+	connector := &Connector{
+		client:       percipioClient,
+		report:       report,
+		reportState:  ReportCompleted,
+		mergeUsersBy: []string{MergeByEmail},
+	}
+	require.NoError(t, connector.resolveIdentities(ctx))
+
+	// The original completion survives the recreated account's start.
+	assert.Equal(t, map[string]string{
+		"b2f4": "completed",
+		"c3a5": "in_progress",
+		"d4b6": "completed",
+	}, getStatuses(t, percipioClient.StatusesStore, "course1"))
+	assert.Equal(t, map[string]string{
+		"b2f4": "in_progress",
+		"a0c3": "completed",
+	}, getStatuses(t, percipioClient.StatusesStore, "course2"))
+
+	users := connector.index(ctx).users
+	require.Len(t, users, 4)
+	assert.Equal(t, "b2f4", users[1].Id)
+	// The merged user takes the most recent email seen.
+	assert.Equal(t, "Michael.Bolton@initech.com", users[1].Email)
+}
@@ -0,0 +1,186 @@
+package connector
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+	"github.com/iiiatthew/baton-percipio-report/pkg/state"
+)
+
+// Option configures optional connector behavior in New.
+type Option func(*Connector)
+
+// WithStateDir sets the directory used to persist state between syncs.
+// Features that depend on it are disabled when no directory is set.
+func WithStateDir(dir string) Option {
+	return func(c *Connector) {
+		c.state = state.New(dir)
+	}
+}
+
+// WithStateEncryption encrypts the state files the connector writes with age
+// and decrypts them when they are read back.
+func WithStateEncryption(options state.EncryptionOptions) Option {
+	return func(c *Connector) {
+		c.stateEncryption = options
+	}
+}
+
+// WithLogRedaction keeps personal data out of the connector's logs by hashing
+// or dropping it.
+func WithLogRedaction(options logging.RedactionOptions) Option {
+	return func(c *Connector) {
+		c.logRedaction = options
+	}
+}
+
+// WithGuardrails sets the checks a report must pass before it is published.
+func WithGuardrails(guardrails Guardrails) Option {
+	return func(c *Connector) {
+		c.guardrails = guardrails
+	}
+}
+
+// WithReportFallback serves the last good report, if it is at most maxAge old,
+// when a fresh report can't be generated. It needs a state directory.
+func WithReportFallback(maxAge time.Duration) Option {
+	return func(c *Connector) {
+		c.fallbackMaxAge = maxAge
+	}
+}
+
+// WithPageSize sets how many users, courses or grants are returned per page
+// when the SDK doesn't ask for a specific size.
+func WithPageSize(pageSize int) Option {
+	return func(c *Connector) {
+		c.pageSize = pageSize
+	}
+}
+
+// WithCatalog enriches courses with metadata from the Content Discovery
+// catalog.
+func WithCatalog(options CatalogOptions) Option {
+	return func(c *Connector) {
+		c.catalogOptions = options
+	}
+}
+
+// WithUserAttributes copies report columns into user profiles. The mapping is
+// from report column to profile key; see ParseUserAttributes.
+func WithUserAttributes(attributes map[string]string) Option {
+	return func(c *Connector) {
+		c.userAttributes = attributes
+	}
+}
+
+// WithUserIdentity sets which report columns identify users and link them to
+// accounts elsewhere.
+func WithUserIdentity(identity UserIdentity) Option {
+	return func(c *Connector) {
+		c.identity = identity
+	}
+}
+
+// WithUserMerge merges users that share a normalized value of any of the
+// given keys: MergeByEmail or a report column.
+func WithUserMerge(mergeBy []string) Option {
+	return func(c *Connector) {
+		c.mergeUsersBy = mergeBy
+	}
+}
+
+// WithDormancyWindow flags users with no learning activity within window as
+// dormant. Zero disables the flag.
+func WithDormancyWindow(window time.Duration) Option {
+	return func(c *Connector) {
+		c.dormancyWindow = window
+	}
+}
+
+// WithGroups publishes groups of users sharing a value of a report column.
+func WithGroups(options GroupOptions) Option {
+	return func(c *Connector) {
+		c.groupOptions = options
+	}
+}
+
+// WithRoles publishes the roles users hold in Percipio user management.
+func WithRoles(enabled bool) Option {
+	return func(c *Connector) {
+		c.rolesEnabled = enabled
+	}
+}
+
+// WithAssessments sets the pass score and the attempt assessments are graded
+// by.
+func WithAssessments(options AssessmentOptions) Option {
+	return func(c *Connector) {
+		c.assessments = options
+	}
+}
+
+// WithAssignments grants the assigned entitlement of courses from the content
+// assigned to learners, and the overdue entitlement to learners past the due
+// date without completing.
+func WithAssignments(enabled bool) Option {
+	return func(c *Connector) {
+		c.assignmentsEnabled = enabled
+	}
+}
+
+// WithEntitlements sets which entitlements courses have and the templates
+// they are named by.
+func WithEntitlements(options EntitlementOptions) Option {
+	return func(c *Connector) {
+		c.entitlements = options
+	}
+}
+
+// WithEverCompleted keeps the full history of course statuses and grants the
+// ever_completed entitlement to users who completed a course at any point,
+// even if they have since restarted it.
+func WithEverCompleted(enabled bool) Option {
+	return func(c *Connector) {
+		c.everCompletedEnabled = enabled
+	}
+}
+
+// WithStatusStore chooses where the course statuses of a loaded report are
+// kept, e.g. on disk for reports too large for memory.
+func WithStatusStore(options client.StatusStoreOptions) Option {
+	return func(c *Connector) {
+		c.statusStore = options
+	}
+}
+
+// ParseUserAttributes parses user attribute mappings of the form
+// "column=profile_key", or just "column" to keep the column name as the key.
+// Keys the connector already sets in user profiles can't be overridden.
+func ParseUserAttributes(mappings []string) (map[string]string, error) {
+	attributes := make(map[string]string, len(mappings))
+	keys := make(map[string]string, len(mappings))
+	for _, mapping := range mappings {
+		column, key, found := strings.Cut(mapping, "=")
+		column = strings.TrimSpace(column)
+		key = strings.TrimSpace(key)
+		if !found {
+			key = column
+		}
+		if column == "" || key == "" {
+			return nil, fmt.Errorf("invalid user attribute mapping %q: expected column=profile_key", mapping)
+		}
+		if slices.Contains(reservedUserProfileKeys, key) {
+			return nil, fmt.Errorf("invalid user attribute mapping %q: profile key %s is reserved", mapping, key)
+		}
+		if other, ok := keys[key]; ok && other != column {
+			return nil, fmt.Errorf("invalid user attribute mapping %q: profile key %s is already mapped from %s", mapping, key, other)
+		}
+		attributes[column] = key
+		keys[key] = column
+	}
+	return attributes, nil
+}
@@ -0,0 +1,44 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUserAttributes(t *testing.T) {
+	t.Run("should map columns to profile keys", func(t *testing.T) {
+		attributes, err := ParseUserAttributes([]string{"department", "employeeId=employee_id", " jobTitle = job_title "})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"department": "department",
+			"employeeId": "employee_id",
+			"jobTitle":   "job_title",
+		}, attributes)
+	})
+
+	t.Run("should accept no mappings", func(t *testing.T) {
+		attributes, err := ParseUserAttributes(nil)
+		require.NoError(t, err)
+		assert.Empty(t, attributes)
+	})
+
+	testCases := []struct {
+		name     string
+		mappings []string
+		message  string
+	}{
+		{"empty column", []string{"=department"}, "expected column=profile_key"},
+		{"empty key", []string{"department="}, "expected column=profile_key"},
+		{"reserved key", []string{"mail=email"}, "profile key email is reserved"},
+		{"duplicate key", []string{"dept=department", "department"}, "already mapped from dept"},
+	}
+	for _, tc := range testCases {
+		t.Run("should reject "+tc.name, func(t *testing.T) {
+			_, err := ParseUserAttributes(tc.mappings)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.message)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package connector
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultPageSize = 1000
+
+// pageTokenContext separates the page token key from other uses of the API
+// token.
+const pageTokenContext = "baton-percipio-report page tokens"
+
+// pageTokens seals the keys pages end with into opaque page tokens. Keys are
+// user IDs, which are often emails or logins, and page tokens are stored by
+// the SDK with the sync, so they mustn't hold them in plaintext.
+type pageTokens struct {
+	aead cipher.AEAD
+}
+
+// newPageTokens returns page tokens keyed by secret, so tokens issued before
+// a restart can still be opened with the same API token. An empty secret
+// means a random key, so tokens only open within one run.
+func newPageTokens(secret string) (*pageTokens, error) {
+	var key []byte
+	if secret == "" {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate page token key: %w", err)
+		}
+	} else {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(pageTokenContext))
+		key = mac.Sum(nil)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &pageTokens{aead: aead}, nil
+}
+
+// randomPageTokens seals the page tokens of connectors created without New.
+var randomPageTokens = sync.OnceValues(func() (*pageTokens, error) {
+	return newPageTokens("")
+})
+
+// seal returns the page token for a page ending with key.
+func (p *pageTokens) seal(key string) (string, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate page token nonce: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(p.aead.Seal(nonce, nonce, []byte(key), nil)), nil
+}
+
+// open returns the key a page token was sealed from.
+func (p *pageTokens) open(token string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(sealed) < p.aead.NonceSize() {
+		return "", status.Errorf(codes.InvalidArgument, "invalid page token")
+	}
+	nonceSize := p.aead.NonceSize()
+	key, err := p.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "invalid page token: it was issued for other credentials")
+	}
+	return string(key), nil
+}
+
+// paginate returns the page of items that follows the page token, along with
+// the token for the next page ("" when this is the last page). Items must be
+// sorted by key. The token seals the key of the last item on the previous
+// page, so pages stay stable even if the underlying list is rebuilt between
+// calls.
+func paginate[T any](d *Connector, items []T, key func(T) string, token *pagination.Token) ([]T, string, error) {
+	after, size, err := d.pageBounds(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := 0
+	if after != "" {
+		start = sort.Search(len(items), func(i int) bool {
+			return key(items[i]) > after
+		})
+	}
+
+	end := min(start+size, len(items))
+	page := items[start:end]
+
+	next := ""
+	if end < len(items) {
+		if next, err = d.nextPageToken(key(items[end-1])); err != nil {
+			return nil, "", err
+		}
+	}
+	return page, next, nil
+}
+
+// pageBounds returns the key a page starts after and how many items it holds:
+// the token's size if it has one, or the configured page size.
+func (d *Connector) pageBounds(token *pagination.Token) (string, int, error) {
+	size := d.listPageSize()
+	after := ""
+	if token != nil {
+		if token.Size > 0 {
+			size = token.Size
+		}
+		if token.Token != "" {
+			tokens, err := d.tokens()
+			if err != nil {
+				return "", 0, err
+			}
+			if after, err = tokens.open(token.Token); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+	return after, size, nil
+}
+
+// nextPageToken returns the token for the page that follows key.
+func (d *Connector) nextPageToken(key string) (string, error) {
+	tokens, err := d.tokens()
+	if err != nil {
+		return "", err
+	}
+	return tokens.seal(key)
+}
+
+// tokens returns the connector's page tokens. It tolerates a nil connector,
+// like listPageSize.
+func (d *Connector) tokens() (*pageTokens, error) {
+	if d == nil || d.pageTokens == nil {
+		return randomPageTokens()
+	}
+	return d.pageTokens, nil
+}
+
+// listPageSize returns the configured page size. It tolerates a nil
+// connector so builders created without one still paginate.
+func (d *Connector) listPageSize() int {
+	if d == nil || d.pageSize <= 0 {
+		return defaultPageSize
+	}
+	return d.pageSize
+}
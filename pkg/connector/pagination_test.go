@@ -0,0 +1,108 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pageToken returns the token of a page ending with key.
+func pageToken(t *testing.T, d *Connector, key string) string {
+	token, err := d.nextPageToken(key)
+	require.NoError(t, err)
+	return token
+}
+
+// pageKey returns the key a page token was sealed from.
+func pageKey(t *testing.T, d *Connector, token string) string {
+	after, _, err := d.pageBounds(&pagination.Token{Token: token})
+	require.NoError(t, err)
+	return after
+}
+
+func TestPaginate(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	identity := func(s string) string { return s }
+	connector := &Connector{pageSize: 2}
+
+	t.Run("should return everything when it fits", func(t *testing.T) {
+		page, next, err := paginate(&Connector{pageSize: 10}, items, identity, nil)
+		require.NoError(t, err)
+		assert.Equal(t, items, page)
+		assert.Empty(t, next)
+	})
+
+	t.Run("should walk all pages in order", func(t *testing.T) {
+		var seen []string
+		token := &pagination.Token{}
+		for {
+			page, next, err := paginate(connector, items, identity, token)
+			require.NoError(t, err)
+			seen = append(seen, page...)
+			if next == "" {
+				break
+			}
+			token = &pagination.Token{Token: next}
+		}
+		assert.Equal(t, items, seen)
+	})
+
+	t.Run("should prefer the token page size", func(t *testing.T) {
+		page, next, err := paginate(connector, items, identity, &pagination.Token{Size: 3})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, page)
+		assert.Equal(t, "c", pageKey(t, connector, next))
+	})
+
+	t.Run("should resume after a key that no longer exists", func(t *testing.T) {
+		page, next, err := paginate(connector, items, identity, &pagination.Token{Token: pageToken(t, connector, "bb")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"c", "d"}, page)
+		assert.Equal(t, "d", pageKey(t, connector, next))
+	})
+
+	t.Run("should handle an empty list", func(t *testing.T) {
+		page, next, err := paginate(connector, []string{}, identity, &pagination.Token{Token: pageToken(t, connector, "x")})
+		require.NoError(t, err)
+		assert.Empty(t, page)
+		assert.Empty(t, next)
+	})
+}
+
+func TestPageTokens(t *testing.T) {
+	const userId = "milton.waddams@initech.com"
+
+	newConnector := func(apiToken string) *Connector {
+		tokens, err := newPageTokens(apiToken)
+		require.NoError(t, err)
+		return &Connector{pageTokens: tokens}
+	}
+
+	t.Run("should not hold the key in plaintext", func(t *testing.T) {
+		token := pageToken(t, newConnector("test-token"), userId)
+		assert.NotContains(t, token, "milton")
+		assert.NotContains(t, token, "initech")
+	})
+
+	t.Run("should open tokens issued before a restart", func(t *testing.T) {
+		token := pageToken(t, newConnector("test-token"), userId)
+		assert.Equal(t, userId, pageKey(t, newConnector("test-token"), token))
+	})
+
+	t.Run("should reject tokens issued for other credentials", func(t *testing.T) {
+		token := pageToken(t, newConnector("test-token"), userId)
+		_, _, err := newConnector("other-token").pageBounds(&pagination.Token{Token: token})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("should reject tokens that aren't page tokens", func(t *testing.T) {
+		for _, token := range []string{userId, "c2hvcnQ"} {
+			_, _, err := newConnector("test-token").pageBounds(&pagination.Token{Token: token})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), token)
+		}
+	})
+}
@@ -19,7 +19,26 @@ var userResourceType = &v2.ResourceType{
 	Annotations: annotationsForUserResourceType(),
 }
 
+// The course resource type is for all content (courses, assessments, books,
+// videos, ...) with activity in the learning activity report.
 var courseResourceType = &v2.ResourceType{
 	Id:          "course",
 	DisplayName: "Course",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_APP},
+}
+
+// The group resource type is for users grouped by a report column such as
+// department, cost center or audience. It is only synced when configured.
+var groupResourceType = &v2.ResourceType{
+	Id:          "group",
+	DisplayName: "Group",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_GROUP},
+}
+
+// The role resource type is for the roles users hold in Percipio user
+// management, such as admin or manager. It is only synced when configured.
+var roleResourceType = &v2.ResourceType{
+	Id:          "role",
+	DisplayName: "Role",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_ROLE},
 }
@@ -0,0 +1,512 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultUsersPageSize = 1000
+	rolesStateKey        = "roles"
+
+	// learnerRole is the role every Percipio user has unless given another,
+	// so revoking a role returns the user to it.
+	learnerRole = "Learner"
+)
+
+// knownRoles are published even when nobody holds them, so they can be
+// granted.
+var knownRoles = []string{"Admin", "Curator", "Manager", learnerRole}
+
+// roleDirectory is the User Management service's list of users, fetched once
+// per report.
+type roleDirectory struct {
+	fetchedAt time.Time
+	users     []client.ManagedUser
+}
+
+// role is a Percipio role and the users holding it.
+type role struct {
+	Id      string
+	Name    string
+	Members []string
+}
+
+// roleId turns a role name into a resource ID, e.g. "Compliance Manager" is
+// "compliance_manager".
+func roleId(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+}
+
+// isPrivilegedRole reports whether a role grants more than learning.
+func isPrivilegedRole(name string) bool {
+	return name != "" && roleId(name) != roleId(learnerRole)
+}
+
+// loadRoles fetches the users and their roles from the User Management
+// service. When the fetch fails, the last good directory is used if the
+// report fallback allows it; otherwise the sync fails, since publishing roles
+// without members would revoke every role grant.
+func (d *Connector) loadRoles(ctx context.Context) error {
+	if !d.rolesEnabled {
+		return nil
+	}
+
+	logger := logging.Extract(ctx)
+	fetchStart := time.Now()
+	users, err := d.fetchManagedUsers(ctx)
+	if err != nil {
+		cached, fetchedAt, fallbackErr := loadFallbackDirectory[client.ManagedUser](d, rolesStateKey)
+		if fallbackErr != nil {
+			logger.Debug("Role fallback not used", zap.Error(fallbackErr))
+			return fmt.Errorf("failed to fetch users from user management: %w", err)
+		}
+		logger.Warn("Serving stale user roles because user management could not be reached",
+			zap.Error(err),
+			zap.Time("roles_fetched_at", fetchedAt),
+			zap.Int("managed_users", len(cached)))
+		d.roles = &roleDirectory{fetchedAt: fetchedAt, users: cached}
+		return nil
+	}
+	d.roles = &roleDirectory{fetchedAt: time.Now().UTC(), users: users}
+	saveLastGoodDirectory(ctx, d, rolesStateKey, d.roles.fetchedAt, users)
+
+	logger.Info("User management users fetched",
+		zap.Int("managed_users", len(users)),
+		zap.Duration("duration", time.Since(fetchStart)))
+	return nil
+}
+
+// fetchManagedUsers pages through every user in the User Management service.
+func (d *Connector) fetchManagedUsers(ctx context.Context) ([]client.ManagedUser, error) {
+	var users []client.ManagedUser
+	for {
+		page, total, _, err := d.client.GetUsersPage(ctx, len(users), defaultUsersPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch users at offset %d: %w", len(users), err)
+		}
+		users = append(users, page...)
+		if len(page) == 0 || len(users) >= total {
+			return users, nil
+		}
+	}
+}
+
+// buildRoleIndex lists the known roles and every role held by a published
+// user, with their members sorted by user resource ID. Active users holding a
+// privileged role who have no learning activity are returned too, so they can
+// be published: administrative access matters whether or not someone learns.
+// They can only be matched when users are identified by Percipio user ID.
+func buildRoleIndex(
+	ctx context.Context,
+	directory *roleDirectory,
+	users []client.User,
+	userResourceIds map[string]string,
+) ([]role, []client.User) {
+	rolesById := make(map[string]*role)
+	for _, name := range knownRoles {
+		rolesById[roleId(name)] = &role{Id: roleId(name), Name: name}
+	}
+	if directory == nil {
+		return sortedRoles(rolesById), nil
+	}
+
+	published := make(map[string]bool, len(users))
+	for _, user := range users {
+		published[user.Id] = true
+	}
+
+	var (
+		added     []client.User
+		unmatched int
+		members   = make(map[string]map[string]struct{})
+	)
+	for _, managedUser := range directory.users {
+		if managedUser.Role == "" {
+			continue
+		}
+		resourceId := managedUser.Id
+		if userResourceIds != nil {
+			resourceId = userResourceIds[managedUser.Id]
+		}
+		if !published[resourceId] {
+			switch {
+			case !isPrivilegedRole(managedUser.Role) || !managedUser.IsActive:
+				continue
+			case userResourceIds != nil:
+				unmatched++
+				continue
+			}
+			published[resourceId] = true
+			added = append(added, managedUser.ToUser())
+		}
+
+		id := roleId(managedUser.Role)
+		r, ok := rolesById[id]
+		if !ok {
+			r = &role{Id: id, Name: managedUser.Role}
+			rolesById[id] = r
+		}
+		if _, ok := members[id]; !ok {
+			members[id] = make(map[string]struct{})
+		}
+		if _, ok := members[id][resourceId]; !ok {
+			members[id][resourceId] = struct{}{}
+			r.Members = append(r.Members, resourceId)
+		}
+	}
+
+	roles := sortedRoles(rolesById)
+	for i := range roles {
+		slices.Sort(roles[i].Members)
+	}
+
+	logger := logging.Extract(ctx)
+	if unmatched > 0 {
+		logger.Warn("Users with privileged roles have no learning activity and can't be matched to a user identifier",
+			zap.Int("unmatched_users", unmatched))
+	}
+	logger.Info("Role extraction completed",
+		zap.Int("roles", len(roles)),
+		zap.Int("users_without_activity", len(added)))
+
+	return roles, added
+}
+
+func sortedRoles(rolesById map[string]*role) []role {
+	roles := make([]role, 0, len(rolesById))
+	for _, r := range rolesById {
+		roles = append(roles, *r)
+	}
+	slices.SortFunc(roles, func(a, b role) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+	return roles
+}
+
+// role returns the indexed role with the given ID.
+func (i *reportIndex) role(id string) (role, bool) {
+	n, found := slices.BinarySearchFunc(i.roles, id, func(r role, id string) int {
+		return strings.Compare(r.Id, id)
+	})
+	if !found {
+		return role{}, false
+	}
+	return i.roles[n], true
+}
+
+type roleBuilder struct {
+	client       *client.Client
+	resourceType *v2.ResourceType
+	connector    *Connector
+}
+
+func (o *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	_ = ctx // This method returns a static resource type
+	return o.resourceType
+}
+
+// roleResource creates a connector resource for a Percipio role.
+func roleResource(r role, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"id":      r.Id,
+		"name":    r.Name,
+		"members": len(r.Members),
+	}
+
+	return resourceSdk.NewRoleResource(
+		r.Name,
+		roleResourceType,
+		r.Id,
+		[]resourceSdk.RoleTraitOption{resourceSdk.WithRoleProfile(profile)},
+		resourceSdk.WithParentResourceID(parentResourceID),
+		resourceSdk.WithDescription(fmt.Sprintf("Percipio %s role", r.Name)),
+	)
+}
+
+// List returns the Percipio roles, ordered by ID.
+func (o *roleBuilder) List(
+	ctx context.Context,
+	parentResourceID *v2.ResourceId,
+	pToken *pagination.Token,
+) (
+	[]*v2.Resource,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	if err := o.connector.waitForReport(ctx); err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	roles, nextToken, err := paginate(
+		o.connector,
+		o.connector.index(ctx).roles,
+		func(r role) string { return r.Id },
+		pToken,
+	)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	outputResources := make([]*v2.Resource, 0, len(roles))
+	for _, r := range roles {
+		resource, err := roleResource(r, parentResourceID)
+		if err != nil {
+			return nil, "", outputAnnotations, err
+		}
+		outputResources = append(outputResources, resource)
+	}
+
+	return outputResources, nextToken, outputAnnotations, nil
+}
+
+// Entitlements returns the assignment entitlement of a role.
+func (o *roleBuilder) Entitlements(
+	_ context.Context,
+	resource *v2.Resource,
+	_ *pagination.Token,
+) (
+	[]*v2.Entitlement,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	return []*v2.Entitlement{
+		entitlement.NewAssignmentEntitlement(
+			resource,
+			assignedEntitlement,
+			entitlement.WithGrantableTo(userResourceType),
+			entitlement.WithDisplayName(fmt.Sprintf("Role %s %s", resource.DisplayName, assignedEntitlement)),
+			entitlement.WithDescription(fmt.Sprintf("Assigned the %s role in Percipio", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+// Grants returns a page of the users holding a role, ordered by user ID.
+func (o *roleBuilder) Grants(
+	ctx context.Context,
+	resource *v2.Resource,
+	pToken *pagination.Token,
+) (
+	[]*v2.Grant,
+	string,
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	if err := o.connector.waitForReport(ctx); err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	r, ok := o.connector.index(ctx).role(resource.Id.Resource)
+	if !ok {
+		return nil, "", outputAnnotations, nil
+	}
+
+	members, nextToken, err := paginate(o.connector, r.Members, func(userId string) string { return userId }, pToken)
+	if err != nil {
+		return nil, "", outputAnnotations, err
+	}
+
+	grants := make([]*v2.Grant, 0, len(members))
+	for _, userId := range members {
+		principalId, err := resourceSdk.NewResourceID(userResourceType, userId)
+		if err != nil {
+			return nil, "", outputAnnotations, err
+		}
+		grants = append(grants, grant.NewGrant(resource, assignedEntitlement, principalId))
+	}
+
+	return grants, nextToken, outputAnnotations, nil
+}
+
+// Get returns a single role by ID.
+func (o *roleBuilder) Get(
+	ctx context.Context,
+	resourceId *v2.ResourceId,
+	parentResourceId *v2.ResourceId,
+) (
+	*v2.Resource,
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	r, err := o.lookupRole(ctx, resourceId.Resource)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+
+	resource, err := roleResource(r, parentResourceId)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+	return resource, outputAnnotations, nil
+}
+
+// lookupRole returns the indexed role with the given ID. The known roles are
+// indexed even before a report is loaded; the others come from user
+// management, which is only read with the report, so until then they are
+// Unavailable rather than NotFound.
+func (o *roleBuilder) lookupRole(ctx context.Context, id string) (role, error) {
+	r, ok := o.connector.index(ctx).role(id)
+	switch {
+	case ok:
+		return r, nil
+	case !o.connector.reportLoaded():
+		return role{}, status.Errorf(codes.Unavailable,
+			"role %s comes from user management, which is read with the learning activity report, and that is not loaded yet", id)
+	default:
+		return role{}, status.Errorf(codes.NotFound, "role %s not found", id)
+	}
+}
+
+// percipioUserId returns the Percipio user ID of a user resource.
+func (o *roleBuilder) percipioUserId(ctx context.Context, resourceId string) (string, error) {
+	if o.connector.identity.usesPercipioId() {
+		return resourceId, nil
+	}
+	if !o.connector.reportLoaded() {
+		return "", status.Errorf(codes.Unavailable,
+			"user %s is matched to a Percipio user through the learning activity report, which is not loaded yet", resourceId)
+	}
+	user, ok := o.connector.index(ctx).user(resourceId)
+	if !ok {
+		return "", status.Errorf(codes.NotFound, "user %s not found", resourceId)
+	}
+	return user.PercipioUserId, nil
+}
+
+// setRole gives a user a role in the User Management service.
+func (o *roleBuilder) setRole(ctx context.Context, principal *v2.ResourceId, roleName string) (annotations.Annotations, error) {
+	var outputAnnotations annotations.Annotations
+
+	if principal.ResourceType != userResourceType.Id {
+		return outputAnnotations, status.Errorf(codes.InvalidArgument, "roles can only be granted to users, not %s", principal.ResourceType)
+	}
+	userId, err := o.percipioUserId(ctx, principal.Resource)
+	if err != nil {
+		return outputAnnotations, err
+	}
+
+	ratelimitData, err := o.client.UpdateUserRole(ctx, userId, roleName)
+	if ratelimitData != nil {
+		outputAnnotations.WithRateLimiting(ratelimitData)
+	}
+	if err != nil {
+		return outputAnnotations, toGRPCError(err)
+	}
+
+	logging.Extract(ctx).Info("Changed Percipio user role",
+		zap.String("user_id", userId),
+		zap.String("role", roleName))
+	return outputAnnotations, nil
+}
+
+// roleName returns the Percipio name of a role resource. Roles are published
+// under their name, so a role that isn't indexed yet, such as a custom role
+// granted before any report has been loaded, is named by its display name.
+func (o *roleBuilder) roleName(ctx context.Context, resource *v2.Resource) (string, error) {
+	r, err := o.lookupRole(ctx, resource.Id.Resource)
+	if err == nil {
+		return r.Name, nil
+	}
+	if status.Code(err) == codes.Unavailable && resource.DisplayName != "" && roleId(resource.DisplayName) == resource.Id.Resource {
+		return resource.DisplayName, nil
+	}
+	return "", err
+}
+
+// Grant gives a user the role. Percipio users hold a single role, so this
+// replaces the one they had.
+func (o *roleBuilder) Grant(
+	ctx context.Context,
+	principal *v2.Resource,
+	entitlement *v2.Entitlement,
+) (
+	annotations.Annotations,
+	error,
+) {
+	name, err := o.roleName(ctx, entitlement.Resource)
+	if err != nil {
+		return nil, err
+	}
+	return o.setRole(ctx, principal.Id, name)
+}
+
+// Revoke returns the user to the learner role if they still hold the revoked
+// role. When their role has changed since, there is nothing to revoke and
+// their current role is left alone. The learner role itself can't be revoked,
+// since every Percipio user holds some role.
+func (o *roleBuilder) Revoke(
+	ctx context.Context,
+	grant *v2.Grant,
+) (
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	revokedId := grant.Entitlement.Resource.Id.Resource
+	if revokedId == roleId(learnerRole) {
+		return nil, status.Errorf(codes.FailedPrecondition, "every Percipio user holds a role; grant another role instead of revoking %s", learnerRole)
+	}
+	principal := grant.Principal.Id
+	if principal.ResourceType != userResourceType.Id {
+		return outputAnnotations, status.Errorf(codes.InvalidArgument, "roles can only be granted to users, not %s", principal.ResourceType)
+	}
+	userId, err := o.percipioUserId(ctx, principal.Resource)
+	if err != nil {
+		return outputAnnotations, err
+	}
+
+	current, ratelimitData, err := o.client.GetManagedUser(ctx, userId)
+	if ratelimitData != nil {
+		outputAnnotations.WithRateLimiting(ratelimitData)
+	}
+	if err != nil {
+		return outputAnnotations, toGRPCError(err)
+	}
+	if current == nil || roleId(current.Role) != revokedId {
+		currentRole := ""
+		if current != nil {
+			currentRole = current.Role
+		}
+		logging.Extract(ctx).Info("Percipio user no longer holds the revoked role",
+			zap.String("user_id", userId),
+			zap.String("revoked_role", revokedId),
+			zap.String("current_role", currentRole))
+		outputAnnotations.Append(&v2.GrantAlreadyRevoked{})
+		return outputAnnotations, nil
+	}
+
+	return o.setRole(ctx, principal, learnerRole)
+}
+
+func newRoleBuilder(client *client.Client, connector *Connector) *roleBuilder {
+	return &roleBuilder{
+		client:       client,
+		resourceType: roleResourceType,
+		connector:    connector,
+	}
+}
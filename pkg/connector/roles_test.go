@@ -0,0 +1,278 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// roleServer serves the user management users and records role updates in
+// updates, keyed by request path. Users are looked up with their latest role.
+func roleServer(t *testing.T, updates map[string]string) *httptest.Server {
+	const usersPath = "/user-management/v1/organizations/test-org/users"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPatch {
+			var body map[string]string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			updates[r.URL.Path] = body["role"]
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+
+		if userId, ok := strings.CutPrefix(r.URL.Path, usersPath+"/"); ok {
+			role, updated := updates[r.URL.Path]
+			if !updated {
+				role = "Learner"
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = fmt.Fprintf(w, `{"id": %q, "role": %q, "isActive": true}`, userId, role)
+			return
+		}
+
+		assert.Equal(t, usersPath, r.URL.Path)
+		w.Header().Set("x-total-count", "4")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[
+			{"id": "michael.bolton@initech.com", "role": "Learner", "isActive": true},
+			{"id": "milton.waddams@initech.com", "role": "Compliance Manager", "isActive": true},
+			{"id": "bill.lumbergh@initech.com", "email": "bill.lumbergh@initech.com", "firstName": "Bill", "lastName": "Lumbergh", "role": "Admin", "isActive": true},
+			{"id": "bob.slydell@initech.com", "role": "Admin", "isActive": false}
+		]`))
+	}))
+}
+
+func roleReport() *client.Report {
+	return &client.Report{
+		{UserId: "michael.bolton@initech.com", ContentId: "course1", Status: "Completed"},
+		{UserId: "milton.waddams@initech.com", ContentId: "course1", Status: "Started", Attributes: map[string]string{"employeeId": "E200"}},
+	}
+}
+
+func TestRoleIndex(t *testing.T) {
+	ctx := context.Background()
+	server := roleServer(t, map[string]string{})
+	defer server.Close()
+
+	t.Run("should list known and held roles with their members", func(t *testing.T) {
+		connector := newLoadedConnector(t, server.URL, roleReport(), WithRoles(true), WithUserIdentity(UserIdentity{}))
+		require.NotNil(t, connector.roles)
+
+		index := connector.index(ctx)
+		ids := make([]string, 0, len(index.roles))
+		for _, r := range index.roles {
+			ids = append(ids, r.Id)
+		}
+		assert.Equal(t, []string{"admin", "compliance_manager", "curator", "learner", "manager"}, ids)
+
+		admin, ok := index.role("admin")
+		require.True(t, ok)
+		assert.Equal(t, []string{"bill.lumbergh@initech.com"}, admin.Members)
+		complianceManager, _ := index.role("compliance_manager")
+		assert.Equal(t, "Compliance Manager", complianceManager.Name)
+		assert.Equal(t, []string{"milton.waddams@initech.com"}, complianceManager.Members)
+		curator, _ := index.role("curator")
+		assert.Empty(t, curator.Members)
+
+		// Active admins without learning activity are published as users.
+		bill, ok := index.user("bill.lumbergh@initech.com")
+		require.True(t, ok)
+		assert.Equal(t, "Bill", bill.FirstName)
+		_, ok = index.user("bob.slydell@initech.com")
+		assert.False(t, ok)
+		assert.Len(t, index.users, 3)
+	})
+
+	t.Run("should map roles to configured user identifiers", func(t *testing.T) {
+		connector := newLoadedConnector(t, server.URL, roleReport(), WithRoles(true), WithUserIdentity(UserIdentity{IdField: "employeeId", MissingId: MissingIdSynthesize}))
+
+		index := connector.index(ctx)
+		complianceManager, _ := index.role("compliance_manager")
+		assert.Equal(t, []string{"E200"}, complianceManager.Members)
+		// Bill has no activity, so has no employee ID to be published under.
+		admin, _ := index.role("admin")
+		assert.Empty(t, admin.Members)
+	})
+
+	t.Run("should fail when user management fails", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer failing.Close()
+
+		connector := newLoadedConnector(t, failing.URL, roleReport())
+		connector.rolesEnabled = true
+		err := connector.loadRoles(ctx)
+		assert.ErrorIs(t, err, client.ErrForbidden)
+		assert.Nil(t, connector.roles)
+	})
+
+	t.Run("should fall back on the last roles fetched when user management fails", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Not a status that is retried, so the test doesn't wait out the backoff.
+			w.WriteHeader(http.StatusNotImplemented)
+		}))
+		defer failing.Close()
+
+		stateDir := t.TempDir()
+		good := newLoadedConnector(t, server.URL, roleReport(), WithRoles(true), WithStateDir(stateDir), WithReportFallback(time.Hour))
+		require.NotNil(t, good.roles)
+
+		connector := newLoadedConnector(t, server.URL, roleReport(), WithStateDir(stateDir), WithReportFallback(time.Hour))
+		connector.client, _ = client.New(ctx, failing.URL, "test-org", "test-token")
+		connector.rolesEnabled = true
+		require.NoError(t, connector.loadRoles(ctx))
+		require.NotNil(t, connector.roles)
+		assert.Equal(t, good.roles.users, connector.roles.users)
+		assert.Len(t, connector.index(ctx).users, 3)
+	})
+}
+
+func TestRoleBuilder(t *testing.T) {
+	ctx := context.Background()
+	updates := make(map[string]string)
+	server := roleServer(t, updates)
+	defer server.Close()
+
+	connector := newLoadedConnector(t, server.URL, roleReport(), WithRoles(true), WithUserIdentity(UserIdentity{}))
+	require.Len(t, connector.ResourceSyncers(ctx), 3)
+	r := newRoleBuilder(connector.client, connector)
+
+	t.Run("should list roles", func(t *testing.T) {
+		resources, _, _, err := r.List(ctx, nil, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, resources, 5)
+		assert.Equal(t, "Admin", resources[0].DisplayName)
+		roleTrait, err := resourceSdk.GetRoleTrait(resources[0])
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), roleTrait.Profile.AsMap()["members"])
+	})
+
+	t.Run("should grant the assigned entitlement to members", func(t *testing.T) {
+		resource, _, err := r.Get(ctx, &v2.ResourceId{ResourceType: "role", Resource: "admin"}, nil)
+		require.NoError(t, err)
+
+		entitlements, _, _, err := r.Entitlements(ctx, resource, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, entitlements, 1)
+		assert.Equal(t, assignedEntitlement, entitlements[0].Slug)
+
+		grants, _, _, err := r.Grants(ctx, resource, &pagination.Token{})
+		require.NoError(t, err)
+		require.Len(t, grants, 1)
+		assert.Equal(t, "role:admin:assigned", grants[0].Entitlement.Id)
+		assert.Equal(t, "bill.lumbergh@initech.com", grants[0].Principal.Id.Resource)
+	})
+
+	t.Run("should change roles through user management", func(t *testing.T) {
+		resource, _, err := r.Get(ctx, &v2.ResourceId{ResourceType: "role", Resource: "manager"}, nil)
+		require.NoError(t, err)
+		user, err := userResource(client.User{Id: "michael.bolton@initech.com"}, nil)
+		require.NoError(t, err)
+		managerEntitlement := entitlement.NewAssignmentEntitlement(resource, assignedEntitlement)
+
+		_, err = r.Grant(ctx, user, managerEntitlement)
+		require.NoError(t, err)
+		assert.Equal(t, "Manager", updates["/user-management/v1/organizations/test-org/users/michael.bolton@initech.com"])
+
+		_, err = r.Revoke(ctx, grant.NewGrant(resource, assignedEntitlement, user.Id))
+		require.NoError(t, err)
+		assert.Equal(t, learnerRole, updates["/user-management/v1/organizations/test-org/users/michael.bolton@initech.com"])
+	})
+
+	t.Run("should leave a role changed since the grant alone", func(t *testing.T) {
+		userPath := "/user-management/v1/organizations/test-org/users/milton.waddams@initech.com"
+		updates[userPath] = "Curator"
+		manager, _, err := r.Get(ctx, &v2.ResourceId{ResourceType: "role", Resource: "manager"}, nil)
+		require.NoError(t, err)
+		user, err := userResource(client.User{Id: "milton.waddams@initech.com"}, nil)
+		require.NoError(t, err)
+
+		revokeAnnotations, err := r.Revoke(ctx, grant.NewGrant(manager, assignedEntitlement, user.Id))
+		require.NoError(t, err)
+		assert.True(t, revokeAnnotations.Contains(&v2.GrantAlreadyRevoked{}))
+		assert.Equal(t, "Curator", updates[userPath])
+	})
+
+	t.Run("should grant roles before any report is loaded", func(t *testing.T) {
+		unloaded, err := New(ctx, "test-org", "test-token", 24*time.Hour, WithRoles(true))
+		require.NoError(t, err)
+		unloaded.client, err = client.New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		r := newRoleBuilder(unloaded.client, unloaded)
+
+		_, _, err = r.Get(ctx, &v2.ResourceId{ResourceType: "role", Resource: "admin"}, nil)
+		require.NoError(t, err)
+		_, _, err = r.Get(ctx, &v2.ResourceId{ResourceType: "role", Resource: "compliance_manager"}, nil)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		_, _, _, err = r.Grants(ctx, &v2.Resource{Id: &v2.ResourceId{ResourceType: "role", Resource: "admin"}}, &pagination.Token{})
+		assert.Error(t, err)
+
+		resource, err := roleResource(role{Id: "compliance_manager", Name: "Compliance Manager"}, nil)
+		require.NoError(t, err)
+		user, err := userResource(client.User{Id: "peter.gibbons@initech.com"}, nil)
+		require.NoError(t, err)
+		_, err = r.Grant(ctx, user, entitlement.NewAssignmentEntitlement(resource, assignedEntitlement))
+		require.NoError(t, err)
+		assert.Equal(t, "Compliance Manager", updates["/user-management/v1/organizations/test-org/users/peter.gibbons@initech.com"])
+	})
+
+	t.Run("should be unavailable for users matched through the report before it is loaded", func(t *testing.T) {
+		unloaded, err := New(ctx, "test-org", "test-token", 24*time.Hour, WithRoles(true), WithUserIdentity(UserIdentity{IdField: "employeeId"}))
+		require.NoError(t, err)
+		unloaded.client, err = client.New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		r := newRoleBuilder(unloaded.client, unloaded)
+
+		resource, _, err := r.Get(ctx, &v2.ResourceId{ResourceType: "role", Resource: "admin"}, nil)
+		require.NoError(t, err)
+		user, err := userResource(client.User{Id: "E100"}, nil)
+		require.NoError(t, err)
+		_, err = r.Grant(ctx, user, entitlement.NewAssignmentEntitlement(resource, assignedEntitlement))
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	})
+
+	t.Run("should read roles changed since the last fetch", func(t *testing.T) {
+		role := "Learner"
+		changing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("x-total-count", "1")
+			w.WriteHeader(http.StatusOK)
+			_, _ = fmt.Fprintf(w, `[{"id": "michael.bolton@initech.com", "role": %q, "isActive": true}]`, role)
+		}))
+		defer changing.Close()
+
+		connector := newLoadedConnector(t, changing.URL, roleReport(), WithRoles(true))
+		role = "Manager"
+		require.NoError(t, connector.loadRoles(ctx))
+		assert.Equal(t, "Manager", connector.roles.users[0].Role)
+	})
+
+	t.Run("should not revoke the learner role", func(t *testing.T) {
+		resource, _, err := r.Get(ctx, &v2.ResourceId{ResourceType: "role", Resource: "learner"}, nil)
+		require.NoError(t, err)
+		user, err := userResource(client.User{Id: "michael.bolton@initech.com"}, nil)
+		require.NoError(t, err)
+
+		_, err = r.Revoke(ctx, grant.NewGrant(resource, assignedEntitlement, user.Id))
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+}
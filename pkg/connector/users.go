@@ -1,17 +1,23 @@
 package connector
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/iiiatthew/baton-percipio-report/pkg/client"
+	"github.com/iiiatthew/baton-percipio-report/pkg/logging"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
-	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type userBuilder struct {
@@ -26,6 +32,12 @@ func (o *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return o.resourceType
 }
 
+// reservedUserProfileKeys are the profile keys userResource sets.
+var reservedUserProfileKeys = []string{"id", "display_name", "email", "first_name", "last_name", "percipio_user_id", "last_activity", "dormant"}
+
+// dormantStatusDetails explains the status of users without recent activity.
+const dormantStatusDetails = "dormant"
+
 func getDisplayName(user client.User) string {
 	return fmt.Sprintf("%s %s", user.FirstName, user.LastName)
 }
@@ -39,12 +51,42 @@ func userResource(user client.User, parentResourceID *v2.ResourceId) (*v2.Resour
 		"first_name":   user.FirstName,
 		"last_name":    user.LastName,
 	}
+	if user.PercipioUserId != "" && user.PercipioUserId != user.Id {
+		profile["percipio_user_id"] = user.PercipioUserId
+	}
+	if !user.LastActivity.IsZero() {
+		profile["last_activity"] = user.LastActivity.Format(time.RFC3339)
+	}
+	if user.Dormant {
+		profile["dormant"] = true
+	}
+	for key, value := range user.Attributes {
+		profile[key] = value
+	}
 
 	userTraitOptions := []resourceSdk.UserTraitOption{
-		resourceSdk.WithEmail(user.Email, true),
-		resourceSdk.WithStatus(v2.UserTrait_Status_STATUS_ENABLED),
 		resourceSdk.WithUserProfile(profile),
 	}
+	if user.Dormant {
+		userTraitOptions = append(userTraitOptions, resourceSdk.WithDetailedStatus(v2.UserTrait_Status_STATUS_ENABLED, dormantStatusDetails))
+	} else {
+		userTraitOptions = append(userTraitOptions, resourceSdk.WithStatus(v2.UserTrait_Status_STATUS_ENABLED))
+	}
+	if !user.LastActivity.IsZero() {
+		userTraitOptions = append(userTraitOptions, resourceSdk.WithLastLogin(user.LastActivity))
+	}
+	if user.Email != "" {
+		userTraitOptions = append(userTraitOptions, resourceSdk.WithEmail(user.Email, true))
+	}
+	for _, email := range user.AdditionalEmails {
+		userTraitOptions = append(userTraitOptions, resourceSdk.WithEmail(email, false))
+	}
+	if user.Login != "" {
+		userTraitOptions = append(userTraitOptions, resourceSdk.WithUserLogin(user.Login))
+	}
+	if len(user.EmployeeIds) > 0 {
+		userTraitOptions = append(userTraitOptions, resourceSdk.WithEmployeeID(user.EmployeeIds...))
+	}
 
 	userResource0, err := resourceSdk.NewUserResource(
 		getDisplayName(user),
@@ -60,19 +102,252 @@ func userResource(user client.User, parentResourceID *v2.ResourceId) (*v2.Resour
 	return userResource0, nil
 }
 
-// List returns all the users from the learning activity report as resource objects.
+// buildUserIndex extracts the unique users from the report, keeping the most
+// recent name seen for each, sorted by resource ID. The identity's columns and
+// the columns named in attributes each take their most recent non-empty
+// value, since a user's latest row may leave a column blank.
+//
+// When users aren't identified by their Percipio user ID it also returns the
+// resource ID of each Percipio user. Users without an identifier are left out
+// (unless the identity synthesizes one) and returned separately.
+func buildUserIndex(
+	ctx context.Context,
+	report *client.Report,
+	identity UserIdentity,
+	attributes map[string]string,
+) ([]client.User, map[string]string, []quarantinedUser) {
+	if report == nil || len(*report) == 0 {
+		return nil, nil, nil
+	}
+
+	extractor := newUserExtractor(ctx, identity, attributes)
+	for i := range *report {
+		extractor.add(&(*report)[i])
+	}
+	return extractor.finish(len(*report))
+}
+
+// userWithDate is a user extracted from the report so far, with the most
+// recent value of each column it was seen with.
+type userWithDate struct {
+	user           client.User
+	mostRecentDate time.Time
+	values         map[string]string
+	valueDates     map[string]time.Time
+}
+
+// userExtractor collects the users of a report one row at a time, so users
+// and courses can be extracted in the same pass; see buildUserIndex.
+type userExtractor struct {
+	logger     *zap.Logger
+	identity   UserIdentity
+	attributes map[string]string
+	columns    []string
+	userMap    map[string]*userWithDate
+}
+
+func newUserExtractor(ctx context.Context, identity UserIdentity, attributes map[string]string) *userExtractor {
+	columns := identity.columns()
+	for column := range attributes {
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return &userExtractor{
+		logger:     logging.Extract(ctx),
+		identity:   identity,
+		attributes: attributes,
+		columns:    columns,
+		userMap:    make(map[string]*userWithDate),
+	}
+}
+
+// add takes in a report row.
+func (e *userExtractor) add(entry *client.ReportEntry) {
+	logger, columns, userMap := e.logger, e.columns, e.userMap
+
+	// Skip entries with empty userId
+	if entry.UserId == "" {
+		return
+	}
+
+	mostRecentDate := entry.LatestActivity()
+
+	existing, exists := userMap[entry.UserId]
+	if exists {
+		if mostRecentDate.After(existing.mostRecentDate) {
+			logger.Debug("Updating user with more recent data",
+				zap.String("userId", entry.UserId),
+				zap.Time("oldDate", existing.mostRecentDate),
+				zap.Time("newDate", mostRecentDate))
+
+			existing.user = client.User{
+				PercipioUserId: entry.UserId,
+				FirstName:      entry.FirstName,
+				LastName:       entry.LastName,
+			}
+			existing.mostRecentDate = mostRecentDate
+		}
+	} else {
+		existing = &userWithDate{
+			user: client.User{
+				PercipioUserId: entry.UserId,
+				FirstName:      entry.FirstName,
+				LastName:       entry.LastName,
+			},
+			mostRecentDate: mostRecentDate,
+			values:         make(map[string]string, len(columns)),
+			valueDates:     make(map[string]time.Time, len(columns)),
+		}
+		userMap[entry.UserId] = existing
+	}
+
+	for _, column := range columns {
+		value := entry.Column(column)
+		if value == "" {
+			continue
+		}
+		if date, seen := existing.valueDates[column]; seen && !mostRecentDate.After(date) {
+			continue
+		}
+		existing.values[column] = value
+		existing.valueDates[column] = mostRecentDate
+	}
+}
+
+// finish returns the users of the rows added, as buildUserIndex does. rows is
+// the number of rows in the report, for logging.
+func (e *userExtractor) finish(rows int) ([]client.User, map[string]string, []quarantinedUser) {
+	logger, identity, attributes, userMap := e.logger, e.identity, e.attributes, e.userMap
+
+	var resourceIds map[string]string
+	if !identity.usesPercipioId() {
+		resourceIds = make(map[string]string, len(userMap))
+	}
+	users := make([]client.User, 0, len(userMap))
+	missing := make([]quarantinedUser, 0)
+
+	for _, userData := range userMap {
+		user := userData.user
+		values := userData.values
+
+		user.Id = values[identity.idField()]
+		if user.Id == "" {
+			if identity.MissingId != MissingIdSynthesize {
+				missing = append(missing, quarantinedUser{
+					PercipioUserId: user.PercipioUserId,
+					Email:          values[identity.emailFields()[0]],
+					FirstName:      user.FirstName,
+					LastName:       user.LastName,
+				})
+				continue
+			}
+			user.Id = synthesizedIdPrefix + user.PercipioUserId
+		}
+
+		for _, column := range identity.emailFields() {
+			email := values[column]
+			switch {
+			case email == "" || email == user.Email || slices.Contains(user.AdditionalEmails, email):
+			case user.Email == "":
+				user.Email = email
+			default:
+				user.AdditionalEmails = append(user.AdditionalEmails, email)
+			}
+		}
+		if identity.LoginField != "" {
+			user.Login = values[identity.LoginField]
+		}
+		for _, column := range identity.EmployeeIdFields {
+			if employeeId := values[column]; employeeId != "" && !slices.Contains(user.EmployeeIds, employeeId) {
+				user.EmployeeIds = append(user.EmployeeIds, employeeId)
+			}
+		}
+		for column, key := range attributes {
+			if value := values[column]; value != "" {
+				if user.Attributes == nil {
+					user.Attributes = make(map[string]string, len(attributes))
+				}
+				user.Attributes[key] = value
+			}
+		}
+
+		user.LastActivity = userData.mostRecentDate
+
+		if resourceIds != nil {
+			resourceIds[user.PercipioUserId] = user.Id
+		}
+		users = append(users, user)
+	}
+	slices.SortFunc(users, func(a, b client.User) int {
+		return cmp.Or(strings.Compare(a.Id, b.Id), strings.Compare(a.PercipioUserId, b.PercipioUserId))
+	})
+	// Several Percipio users can share an identifier; they are published as
+	// one user holding all of their grants.
+	if sharedIds := len(users); sharedIds > 0 {
+		// Compacting keeps the first of each run, so carry the latest
+		// activity back to it.
+		for i := len(users) - 2; i >= 0; i-- {
+			if users[i].Id == users[i+1].Id && users[i+1].LastActivity.After(users[i].LastActivity) {
+				users[i].LastActivity = users[i+1].LastActivity
+			}
+		}
+		users = slices.CompactFunc(users, func(a, b client.User) bool {
+			return a.Id == b.Id
+		})
+		if sharedIds -= len(users); sharedIds > 0 {
+			logger.Warn("Percipio users share an identifier and were published as one user",
+				zap.String("id_field", identity.idField()),
+				zap.Int("shared_identifiers", sharedIds))
+		}
+	}
+	slices.SortFunc(missing, func(a, b quarantinedUser) int {
+		return strings.Compare(a.PercipioUserId, b.PercipioUserId)
+	})
+
+	// Log deduplication statistics
+	totalDuplicates := rows - len(users)
+	logger.Info("User extraction completed",
+		zap.Int("total_report_entries", rows),
+		zap.Int("unique_users", len(users)),
+		zap.Int("users_without_identifier", len(missing)),
+		zap.Int("duplicate_entries", totalDuplicates),
+		zap.Float64("deduplication_ratio", float64(totalDuplicates)/float64(rows)))
+
+	return users, resourceIds, missing
+}
+
+// markDormant flags the users with no activity in the dormancy window before
+// now. It does nothing when no window is set.
+func markDormant(users []client.User, window time.Duration, now time.Time) int {
+	if window <= 0 {
+		return 0
+	}
+	cutoff := now.Add(-window)
+	dormant := 0
+	for i := range users {
+		users[i].Dormant = users[i].LastActivity.Before(cutoff)
+		if users[i].Dormant {
+			dormant++
+		}
+	}
+	return dormant
+}
+
+// List returns a page of the users from the learning activity report as
+// resource objects, ordered by user ID.
 // Users include a UserTrait because they are the 'shape' of a standard user.
 func (o *userBuilder) List(
 	ctx context.Context,
 	parentResourceID *v2.ResourceId,
-	_ *pagination.Token,
+	pToken *pagination.Token,
 ) (
 	[]*v2.Resource,
 	string,
 	annotations.Annotations,
 	error,
 ) {
-	logger := ctxzap.Extract(ctx)
+	logger := logging.Extract(ctx)
 	logger.Debug("Starting Users List from Report Data")
 
 	outputResources := make([]*v2.Resource, 0)
@@ -88,79 +363,25 @@ func (o *userBuilder) List(
 		return outputResources, "", outputAnnotations, nil
 	}
 
-	// Extract unique users from report, keeping the most recent data
-	type userWithDate struct {
-		user           client.User
-		mostRecentDate string
-	}
-
-	userMap := make(map[string]userWithDate)
-
-	for _, entry := range *o.connector.report {
-		// Skip entries with empty userId
-		if entry.UserId == "" {
-			continue
-		}
-
-		var mostRecentDate string
-		switch {
-		case entry.CompletedDate != "":
-			mostRecentDate = entry.CompletedDate
-		case entry.LastAccess != "":
-			mostRecentDate = entry.LastAccess
-		default:
-			mostRecentDate = entry.FirstAccess
-		}
-
-		if existing, exists := userMap[entry.UserId]; exists {
-			if mostRecentDate > existing.mostRecentDate {
-				logger.Debug("Updating user with more recent data",
-					zap.String("userId", entry.UserId),
-					zap.String("oldDate", existing.mostRecentDate),
-					zap.String("newDate", mostRecentDate))
-
-				userMap[entry.UserId] = userWithDate{
-					user: client.User{
-						Id:        entry.UserId,
-						Email:     entry.EmailAddress,
-						FirstName: entry.FirstName,
-						LastName:  entry.LastName,
-					},
-					mostRecentDate: mostRecentDate,
-				}
-			}
-		} else {
-			userMap[entry.UserId] = userWithDate{
-				user: client.User{
-					Id:        entry.UserId,
-					Email:     entry.EmailAddress,
-					FirstName: entry.FirstName,
-					LastName:  entry.LastName,
-				},
-				mostRecentDate: mostRecentDate,
-			}
-		}
+	users, nextToken, err := paginate(
+		o.connector,
+		o.connector.index(ctx).users,
+		func(user client.User) string { return user.Id },
+		pToken,
+	)
+	if err != nil {
+		return nil, "", outputAnnotations, err
 	}
 
-	// Convert map to resources
-	for _, userData := range userMap {
-		userResource0, err := userResource(userData.user, parentResourceID)
+	for _, user := range users {
+		userResource0, err := userResource(user, parentResourceID)
 		if err != nil {
 			return nil, "", outputAnnotations, err
 		}
 		outputResources = append(outputResources, userResource0)
 	}
 
-	// Log deduplication statistics
-	totalDuplicates := len(*o.connector.report) - len(userMap)
-	logger.Info("User extraction completed",
-		zap.Int("total_report_entries", len(*o.connector.report)),
-		zap.Int("unique_users", len(outputResources)),
-		zap.Int("duplicate_entries", totalDuplicates),
-		zap.Float64("deduplication_ratio", float64(totalDuplicates)/float64(len(*o.connector.report))))
-
-	// No pagination needed since we're returning all users from the report
-	return outputResources, "", outputAnnotations, nil
+	return outputResources, nextToken, outputAnnotations, nil
 }
 
 // Entitlements always returns an empty slice for users.
@@ -191,6 +412,51 @@ func (o *userBuilder) Grants(
 	return nil, "", nil, nil
 }
 
+// Get returns a single user by ID. Once a report is loaded the answer comes
+// from the report index, so Get and List agree; before that the user is
+// looked up directly in Percipio.
+func (o *userBuilder) Get(
+	ctx context.Context,
+	resourceId *v2.ResourceId,
+	parentResourceId *v2.ResourceId,
+) (
+	*v2.Resource,
+	annotations.Annotations,
+	error,
+) {
+	var outputAnnotations annotations.Annotations
+
+	var user *client.User
+	if o.connector.reportLoaded() {
+		if indexed, ok := o.connector.index(ctx).user(resourceId.Resource); ok {
+			user = &indexed
+		}
+	} else if !o.connector.identity.usesPercipioId() {
+		// Percipio can only be asked about its own user IDs.
+		return nil, outputAnnotations, status.Errorf(codes.Unavailable,
+			"users are identified by %s, which needs a loaded report to look up", o.connector.identity.idField())
+	} else {
+		found, ratelimitData, err := o.client.GetUser(ctx, resourceId.Resource)
+		if ratelimitData != nil {
+			outputAnnotations.WithRateLimiting(ratelimitData)
+		}
+		if err != nil {
+			return nil, outputAnnotations, toGRPCError(err)
+		}
+		user = found
+	}
+
+	if user == nil {
+		return nil, outputAnnotations, status.Errorf(codes.NotFound, "user %s not found", resourceId.Resource)
+	}
+
+	userResource0, err := userResource(*user, parentResourceId)
+	if err != nil {
+		return nil, outputAnnotations, err
+	}
+	return userResource0, outputAnnotations, nil
+}
+
 func newUserBuilder(client *client.Client, report *client.Report, connector *Connector) *userBuilder {
 	return &userBuilder{
 		client:       client,
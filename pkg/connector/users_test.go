@@ -2,6 +2,11 @@ package connector
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,9 +14,12 @@ import (
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
+	resourceSdk "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/iiiatthew/baton-percipio-report/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestUsersList(t *testing.T) {
@@ -109,6 +117,43 @@ func TestUsersList(t *testing.T) {
 		assert.Equal(t, "Bill Lumbergh", bill.DisplayName)
 	})
 
+	t.Run("should paginate users in ID order", func(t *testing.T) {
+		connector := &Connector{
+			reportState: ReportCompleted,
+			pageSize:    2,
+			report: &client.Report{
+				{UserId: "peter.gibbons@initech.com", FirstName: "Peter", LastName: "Gibbons", ContentId: "course1"},
+				{UserId: "bill.lumbergh@initech.com", FirstName: "Bill", LastName: "Lumbergh", ContentId: "course1"},
+				{UserId: "michael.bolton@initech.com", FirstName: "Michael", LastName: "Bolton", ContentId: "course1"},
+				{UserId: "bill.lumbergh@initech.com", FirstName: "Bill", LastName: "Lumbergh", ContentId: "course2"},
+			},
+		}
+		u := newUserBuilder(nil, nil, connector)
+
+		var ids []string
+		token := &pagination.Token{}
+		pages := 0
+		for {
+			resources, nextToken, _, err := u.List(ctx, nil, token)
+			require.NoError(t, err)
+			pages++
+			for _, resource := range resources {
+				ids = append(ids, resource.Id.Resource)
+			}
+			if nextToken == "" {
+				break
+			}
+			token = &pagination.Token{Token: nextToken}
+		}
+
+		assert.Equal(t, 2, pages)
+		assert.Equal(t, []string{
+			"bill.lumbergh@initech.com",
+			"michael.bolton@initech.com",
+			"peter.gibbons@initech.com",
+		}, ids)
+	})
+
 	t.Run("should wait for report that was generated during validation", func(t *testing.T) {
 		server := test.FixturesServer()
 		defer server.Close()
@@ -279,3 +324,289 @@ func TestUserResource(t *testing.T) {
 		assert.Equal(t, " ", resource.DisplayName)
 	})
 }
+
+func TestUsersGet(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should answer from the loaded report", func(t *testing.T) {
+		connector := &Connector{
+			reportState: ReportCompleted,
+			report: &client.Report{
+				{
+					UserId:       "michael.bolton@initech.com",
+					FirstName:    "Michael",
+					LastName:     "Bolton",
+					EmailAddress: "michael.bolton@initech.com",
+					ContentId:    "bs_adg02_a23_enus",
+				},
+			},
+		}
+		u := newUserBuilder(nil, nil, connector)
+
+		resource, _, err := u.Get(ctx, &v2.ResourceId{ResourceType: "user", Resource: "michael.bolton@initech.com"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Michael Bolton", resource.DisplayName)
+
+		_, _, err = u.Get(ctx, &v2.ResourceId{ResourceType: "user", Resource: "bob.slydell@initech.com"}, nil)
+		require.Error(t, err)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("should look up the user when no report is loaded", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if !strings.HasSuffix(r.URL.Path, "/users/michael.bolton@initech.com") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`{"id": "b2f4", "email": "michael.bolton@initech.com", "firstName": "Michael", "lastName": "Bolton"}`))
+		}))
+		defer server.Close()
+
+		percipioClient, err := client.New(ctx, server.URL, "test-org", "test-token")
+		require.NoError(t, err)
+		u := newUserBuilder(percipioClient, nil, &Connector{client: percipioClient})
+
+		resource, _, err := u.Get(ctx, &v2.ResourceId{ResourceType: "user", Resource: "michael.bolton@initech.com"}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "michael.bolton@initech.com", resource.Id.Resource)
+		assert.Equal(t, "Michael Bolton", resource.DisplayName)
+
+		_, _, err = u.Get(ctx, &v2.ResourceId{ResourceType: "user", Resource: "bob.slydell@initech.com"}, nil)
+		require.Error(t, err)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestBuildUserIndexAttributes(t *testing.T) {
+	ctx := context.Background()
+
+	report := &client.Report{
+		{
+			UserId:        "michael.bolton@initech.com",
+			FirstName:     "Michael",
+			LastName:      "Bolton",
+			ContentId:     "course1",
+			CompletedDate: "2025-01-10T00:00:00.000Z",
+			Attributes:    map[string]string{"department": "Engineering", "jobTitle": "Engineer", "location": "Austin"},
+		},
+		{
+			UserId:        "michael.bolton@initech.com",
+			FirstName:     "Michael",
+			LastName:      "Bolton",
+			ContentId:     "course2",
+			CompletedDate: "2025-06-20T00:00:00.000Z",
+			Attributes:    map[string]string{"department": "Product", "location": ""},
+		},
+		{
+			UserId:        "michael.bolton@initech.com",
+			FirstName:     "Michael",
+			LastName:      "Bolton",
+			ContentId:     "course3",
+			CompletedDate: "2025-03-01T00:00:00.000Z",
+			Attributes:    map[string]string{"department": "Sales", "jobTitle": "Senior Engineer"},
+		},
+		{
+			UserId:    "milton.waddams@initech.com",
+			FirstName: "Milton",
+			LastName:  "Waddams",
+			ContentId: "course1",
+		},
+	}
+
+	users, _, _ := buildUserIndex(ctx, report, UserIdentity{}, map[string]string{
+		"department": "department",
+		"jobTitle":   "job_title",
+		"location":   "location",
+	})
+	require.Len(t, users, 2)
+
+	// Each attribute takes the most recent non-empty value.
+	assert.Equal(t, map[string]string{
+		"department": "Product",
+		"job_title":  "Senior Engineer",
+		"location":   "Austin",
+	}, users[0].Attributes)
+	assert.Nil(t, users[1].Attributes)
+
+	resource, err := userResource(users[0], nil)
+	require.NoError(t, err)
+	userTrait, err := resourceSdk.GetUserTrait(resource)
+	require.NoError(t, err)
+	profile := userTrait.Profile.AsMap()
+	assert.Equal(t, "Product", profile["department"])
+	assert.Equal(t, "Senior Engineer", profile["job_title"])
+	assert.Equal(t, "michael.bolton@initech.com", profile["id"])
+
+	// Without a mapping no attributes are kept.
+	users, _, _ = buildUserIndex(ctx, report, UserIdentity{}, nil)
+	assert.Nil(t, users[0].Attributes)
+}
+
+func TestBuildUserIndexDates(t *testing.T) {
+	ctx := context.Background()
+
+	// Compared as strings the first row looks newer; in time the second is.
+	report := &client.Report{
+		{
+			UserId:     "michael.bolton@initech.com",
+			FirstName:  "Mike",
+			LastName:   "Bolton",
+			ContentId:  "course1",
+			LastAccess: "2025-06-20T10:00:00+02:00",
+		},
+		{
+			UserId:        "michael.bolton@initech.com",
+			FirstName:     "Michael",
+			LastName:      "Bolton",
+			ContentId:     "course2",
+			CompletedDate: "2025-06-20 09:00:00",
+		},
+		{
+			UserId:     "michael.bolton@initech.com",
+			FirstName:  "Mikey",
+			LastName:   "Bolton",
+			ContentId:  "course3",
+			LastAccess: "yesterday",
+		},
+	}
+
+	users, _, _ := buildUserIndex(ctx, report, UserIdentity{}, nil)
+	require.Len(t, users, 1)
+	assert.Equal(t, "Michael", users[0].FirstName)
+}
+
+func TestUserActivity(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	report := &client.Report{
+		{
+			UserId:        "michael.bolton@initech.com",
+			ContentId:     "course1",
+			CompletedDate: "2025-01-10T00:00:00.000Z",
+		},
+		{
+			UserId:     "michael.bolton@initech.com",
+			ContentId:  "course2",
+			LastAccess: "2025-06-20T09:30:00.000Z",
+		},
+		{
+			UserId:      "milton.waddams@initech.com",
+			ContentId:   "course1",
+			FirstAccess: "2024-11-02T00:00:00.000Z",
+		},
+		{
+			UserId:    "peter.gibbons@initech.com",
+			ContentId: "course1",
+		},
+	}
+
+	users, _, _ := buildUserIndex(ctx, report, UserIdentity{}, nil)
+	require.Len(t, users, 3)
+	assert.Equal(t, time.Date(2025, 6, 20, 9, 30, 0, 0, time.UTC), users[0].LastActivity)
+	assert.Equal(t, time.Date(2024, 11, 2, 0, 0, 0, 0, time.UTC), users[1].LastActivity)
+	assert.True(t, users[2].LastActivity.IsZero())
+
+	t.Run("should flag users without activity in the window", func(t *testing.T) {
+		dormant := markDormant(users, 90*24*time.Hour, now)
+		assert.Equal(t, 2, dormant)
+		assert.False(t, users[0].Dormant)
+		assert.True(t, users[1].Dormant)
+		assert.True(t, users[2].Dormant)
+	})
+
+	t.Run("should not flag anyone without a window", func(t *testing.T) {
+		users := slices.Clone(users)
+		for i := range users {
+			users[i].Dormant = false
+		}
+		assert.Equal(t, 0, markDormant(users, 0, now))
+		assert.False(t, users[1].Dormant)
+	})
+
+	t.Run("should publish last activity as the last login", func(t *testing.T) {
+		resource, err := userResource(users[0], nil)
+		require.NoError(t, err)
+		userTrait, err := resourceSdk.GetUserTrait(resource)
+		require.NoError(t, err)
+		assert.Equal(t, users[0].LastActivity, userTrait.LastLogin.AsTime())
+		assert.Equal(t, v2.UserTrait_Status_STATUS_ENABLED, userTrait.Status.Status)
+		assert.Empty(t, userTrait.Status.Details)
+		assert.Equal(t, "2025-06-20T09:30:00Z", userTrait.Profile.AsMap()["last_activity"])
+		assert.NotContains(t, userTrait.Profile.AsMap(), "dormant")
+	})
+
+	t.Run("should mark dormant users", func(t *testing.T) {
+		resource, err := userResource(users[2], nil)
+		require.NoError(t, err)
+		userTrait, err := resourceSdk.GetUserTrait(resource)
+		require.NoError(t, err)
+		assert.Nil(t, userTrait.LastLogin)
+		assert.Equal(t, v2.UserTrait_Status_STATUS_ENABLED, userTrait.Status.Status)
+		assert.Equal(t, dormantStatusDetails, userTrait.Status.Details)
+		assert.Equal(t, true, userTrait.Profile.AsMap()["dormant"])
+	})
+}
+
+func TestScanReport(t *testing.T) {
+	ctx := context.Background()
+	report := &client.Report{
+		{UserId: "michael.bolton", FirstName: "Michael", ContentId: "course2", ContentTitle: "Course 2", EmailAddress: "michael.bolton@initech.com"},
+		{UserId: "milton.waddams", FirstName: "Milton", ContentId: "course1", ContentTitle: "Course 1", EmailAddress: "milton.waddams@initech.com"},
+		{UserId: "michael.bolton", FirstName: "Michael", ContentId: "course1", ContentTitle: "Course 1", EmailAddress: "michael.bolton@initech.com"},
+	}
+	identity := UserIdentity{IdField: "emailAddress"}
+
+	t.Run("should match separate passes", func(t *testing.T) {
+		users, resourceIds, missing, courses := scanReport(ctx, report, identity, nil)
+
+		wantUsers, wantResourceIds, wantMissing := buildUserIndex(ctx, report, identity, nil)
+		assert.Equal(t, wantUsers, users)
+		assert.Equal(t, wantResourceIds, resourceIds)
+		assert.Equal(t, wantMissing, missing)
+		assert.Equal(t, buildCourseIndex(ctx, report), courses)
+		assert.Len(t, users, 2)
+		assert.Len(t, courses, 2)
+	})
+
+	t.Run("should return nothing for an empty report", func(t *testing.T) {
+		users, resourceIds, missing, courses := scanReport(ctx, &client.Report{}, identity, nil)
+		assert.Nil(t, users)
+		assert.Nil(t, resourceIds)
+		assert.Nil(t, missing)
+		assert.Nil(t, courses)
+	})
+}
+
+func BenchmarkScanReport(b *testing.B) {
+	ctx := context.Background()
+	report := make(client.Report, 0, 200000)
+	for u := 0; u < 20000; u++ {
+		for c := 0; c < 10; c++ {
+			report = append(report, client.ReportEntry{
+				UserId:       fmt.Sprintf("00000000-0000-0000-0000-%012d", u),
+				FirstName:    "Peter",
+				LastName:     "Gibbons",
+				EmailAddress: fmt.Sprintf("user%d@initech.com", u),
+				ContentId:    fmt.Sprintf("11111111-0000-0000-0000-%012d", (u*7+c)%500),
+				ContentTitle: "TPS Reports",
+			})
+		}
+	}
+
+	b.Run("separate passes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buildUserIndex(ctx, &report, UserIdentity{}, nil)
+			buildCourseIndex(ctx, &report)
+		}
+	})
+	b.Run("single pass", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			scanReport(ctx, &report, UserIdentity{}, nil)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package logging
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// RedactOff logs personal data as is.
+	RedactOff = "off"
+	// RedactHash replaces personal data with a keyed hash, so the same
+	// value can still be followed across log lines.
+	RedactHash = "hash"
+	// RedactDrop removes personal data from logs.
+	RedactDrop = "drop"
+
+	redactedValue = "[redacted]"
+	hashPrefix    = "hmac:"
+	// hashLength is the number of hex digits of the HMAC kept.
+	hashLength = 16
+)
+
+// RedactModes lists the valid RedactionOptions modes.
+var RedactModes = []string{RedactOff, RedactHash, RedactDrop}
+
+// personalKeyParts mark the log field keys that hold personal data. A key
+// holds personal data when, lowercased and without separators, it contains
+// one of them, e.g. "user_id", "merged_user_id", "userIds" and "emails".
+var personalKeyParts = []string{
+	"displayname",
+	"email",
+	"employeeid",
+	"firstname",
+	"fullname",
+	"lastname",
+	"login",
+	"userid",
+	"username",
+}
+
+// personalKeys are the other log field keys that hold personal data.
+var personalKeys = []string{
+	"matched_value",
+	"samples",
+}
+
+// keySeparators are removed from keys before they are matched against
+// personalKeyParts.
+var keySeparators = strings.NewReplacer("_", "", "-", "", ".", "", " ", "")
+
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`)
+	// userPathPattern matches the user ID segment of user-management API
+	// paths, such as /users/{id}, in endpoints, paths and errors.
+	userPathPattern = regexp.MustCompile(`(/users/)([^/?#\s"]+)`)
+)
+
+// RedactionOptions configures how personal data is kept out of logs.
+type RedactionOptions struct {
+	// Mode is RedactOff, RedactHash or RedactDrop. Empty means RedactOff.
+	Mode string
+	// HashKey is the HMAC key of RedactHash. Empty means a random key, so
+	// hashes only match within one run.
+	HashKey string
+}
+
+// redactor is the process-wide redaction configuration. Logging is
+// configured once per process, like zap's global logger.
+var redactor = struct {
+	sync.RWMutex
+	mode    string
+	key     []byte
+	secrets []string
+}{mode: RedactOff}
+
+// Configure sets how personal data is redacted from the loggers returned by
+// Extract and Wrap.
+func Configure(options RedactionOptions) error {
+	mode := options.Mode
+	if mode == "" {
+		mode = RedactOff
+	}
+	if !slices.Contains(RedactModes, mode) {
+		return fmt.Errorf("invalid log redaction %q: expected one of %v", options.Mode, RedactModes)
+	}
+
+	key := []byte(options.HashKey)
+	if mode == RedactHash && len(key) == 0 {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate log redaction key: %w", err)
+		}
+	}
+
+	redactor.Lock()
+	defer redactor.Unlock()
+	redactor.mode = mode
+	redactor.key = key
+	return nil
+}
+
+// AddSecret keeps secret, e.g. an API token, out of every log field,
+// whatever the redaction mode.
+func AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	redactor.Lock()
+	defer redactor.Unlock()
+	if !slices.Contains(redactor.secrets, secret) {
+		redactor.secrets = append(redactor.secrets, secret)
+	}
+}
+
+// Extract returns the logger of ctx, redacting what it logs.
+func Extract(ctx context.Context) *zap.Logger {
+	return Wrap(ctxzap.Extract(ctx))
+}
+
+// ToContext returns ctx with its logger redacting what it logs, so libraries
+// logging through ctxzap.Extract, such as the SDK's HTTP client, are
+// redacted too.
+func ToContext(ctx context.Context) context.Context {
+	return ctxzap.ToContext(ctx, Extract(ctx))
+}
+
+// Wrap returns logger redacting what it logs.
+func Wrap(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if _, ok := core.(*redactingCore); ok {
+			return core
+		}
+		return &redactingCore{Core: core}
+	}))
+}
+
+// redactingCore redacts entries before passing them to the wrapped core.
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	redactor.RLock()
+	entry.Message = redactText(entry.Message)
+	redactor.RUnlock()
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+// redactFields returns fields with secrets and personal data redacted.
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redactor.RLock()
+	defer redactor.RUnlock()
+
+	redacted := make([]zapcore.Field, 0, len(fields))
+	for _, field := range fields {
+		if isPersonalKey(field.Key) && redactor.mode != RedactOff {
+			if redactor.mode == RedactDrop {
+				continue
+			}
+			redacted = append(redacted, hashField(field))
+			continue
+		}
+
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = redactText(field.String)
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok {
+				field = zap.String(field.Key, redactText(err.Error()))
+			}
+		case zapcore.StringerType, zapcore.ByteStringType, zapcore.ReflectType,
+			zapcore.ArrayMarshalerType, zapcore.ObjectMarshalerType:
+			if text := fmt.Sprint(fieldValue(field)); redactText(text) != text {
+				field = zap.String(field.Key, redactText(text))
+			}
+		}
+		redacted = append(redacted, field)
+	}
+	return redacted
+}
+
+// isPersonalKey reports whether the log field key holds personal data.
+func isPersonalKey(key string) bool {
+	if slices.Contains(personalKeys, key) {
+		return true
+	}
+	normalized := keySeparators.Replace(strings.ToLower(key))
+	for _, part := range personalKeyParts {
+		if strings.Contains(normalized, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashField replaces the value of a personal field with its hash, or the
+// hashes of its elements.
+func hashField(field zapcore.Field) zapcore.Field {
+	switch value := fieldValue(field).(type) {
+	case string:
+		return zap.String(field.Key, hashValue(value))
+	case []interface{}:
+		hashes := make([]string, len(value))
+		for i, element := range value {
+			hashes[i] = hashValue(fmt.Sprint(element))
+		}
+		return zap.Strings(field.Key, hashes)
+	default:
+		return zap.String(field.Key, hashValue(fmt.Sprint(value)))
+	}
+}
+
+// fieldValue returns the value a field encodes to.
+func fieldValue(field zapcore.Field) interface{} {
+	encoder := zapcore.NewMapObjectEncoder()
+	field.AddTo(encoder)
+	return encoder.Fields[field.Key]
+}
+
+// redactText removes secrets from text, and the email addresses and user IDs
+// of API paths in it unless redaction is off. The caller holds the redactor's
+// read lock.
+func redactText(text string) string {
+	for _, secret := range redactor.secrets {
+		text = strings.ReplaceAll(text, secret, redactedValue)
+	}
+	text = bearerPattern.ReplaceAllString(text, "${1}"+redactedValue)
+
+	switch redactor.mode {
+	case RedactHash:
+		text = userPathPattern.ReplaceAllStringFunc(text, func(match string) string {
+			groups := userPathPattern.FindStringSubmatch(match)
+			return groups[1] + hashValue(unescapePathSegment(groups[2]))
+		})
+		text = emailPattern.ReplaceAllStringFunc(text, hashValue)
+	case RedactDrop:
+		text = userPathPattern.ReplaceAllString(text, "${1}"+redactedValue)
+		text = emailPattern.ReplaceAllString(text, redactedValue)
+	}
+	return text
+}
+
+// unescapePathSegment returns a path segment unescaped, so a user ID in a
+// path hashes like the same ID in a user_id field.
+func unescapePathSegment(segment string) string {
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		return unescaped
+	}
+	return segment
+}
+
+// hashValue returns the keyed hash of value. The caller holds the
+// redactor's read lock.
+func hashValue(value string) string {
+	mac := hmac.New(sha256.New, redactor.key)
+	mac.Write([]byte(value))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observe configures redaction and returns a redacting logger and the
+// entries it logs.
+func observe(t *testing.T, options RedactionOptions) (*zap.Logger, *observer.ObservedLogs) {
+	require.NoError(t, Configure(options))
+	t.Cleanup(func() { require.NoError(t, Configure(RedactionOptions{})) })
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	return Wrap(zap.New(core)), logs
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, Configure(RedactionOptions{})) })
+
+	t.Run("should accept every mode", func(t *testing.T) {
+		for _, mode := range append(RedactModes, "") {
+			assert.NoError(t, Configure(RedactionOptions{Mode: mode}), mode)
+		}
+	})
+
+	t.Run("should reject unknown modes", func(t *testing.T) {
+		assert.Error(t, Configure(RedactionOptions{Mode: "shred"}))
+	})
+}
+
+func TestRedaction(t *testing.T) {
+	t.Run("should log personal data as is when off", func(t *testing.T) {
+		logger, logs := observe(t, RedactionOptions{Mode: RedactOff})
+		logger.Debug("Updating user", zap.String("userId", "michael.bolton@initech.com"))
+
+		assert.Equal(t, "michael.bolton@initech.com", logs.All()[0].ContextMap()["userId"])
+	})
+
+	t.Run("should hash personal fields stably", func(t *testing.T) {
+		logger, logs := observe(t, RedactionOptions{Mode: RedactHash, HashKey: "pepper"})
+		logger.Info("Merged users",
+			zap.String("merged_user_id", "michael.bolton"),
+			zap.String("survivor_user_id", "michael.bolton"),
+			zap.Strings("samples", []string{"a", "b"}),
+			zap.String("course_id", "course1"))
+
+		fields := logs.All()[0].ContextMap()
+		assert.True(t, strings.HasPrefix(fields["merged_user_id"].(string), hashPrefix))
+		assert.Equal(t, fields["merged_user_id"], fields["survivor_user_id"])
+		assert.Len(t, fields["samples"], 2)
+		assert.Equal(t, "course1", fields["course_id"])
+
+		// The same key hashes the same way in another run.
+		logger, logs = observe(t, RedactionOptions{Mode: RedactHash, HashKey: "pepper"})
+		logger.Info("Merged users", zap.String("user_id", "michael.bolton"))
+		assert.Equal(t, fields["merged_user_id"], logs.All()[0].ContextMap()["user_id"])
+	})
+
+	t.Run("should drop personal fields", func(t *testing.T) {
+		logger, logs := observe(t, RedactionOptions{Mode: RedactDrop})
+		logger.With(zap.String("user_id", "michael.bolton")).Info("Granted role",
+			zap.String("matched_value", "michael.bolton@initech.com"),
+			zap.String("role", "admin"))
+
+		assert.Equal(t, map[string]interface{}{"role": "admin"}, logs.All()[0].ContextMap())
+	})
+
+	t.Run("should redact emails in free text", func(t *testing.T) {
+		logger, logs := observe(t, RedactionOptions{Mode: RedactDrop})
+		logger.Error("Lookup failed for milton.waddams@initech.com",
+			zap.Error(errors.New("no user milton.waddams@initech.com")),
+			zap.String("endpoint", "https://api.percipio.com/users?email=milton.waddams@initech.com"))
+
+		entry := logs.All()[0]
+		assert.NotContains(t, entry.Message, "initech")
+		for key, value := range entry.ContextMap() {
+			assert.NotContains(t, value, "initech", key)
+		}
+	})
+
+	t.Run("should redact user IDs in API paths", func(t *testing.T) {
+		logger, logs := observe(t, RedactionOptions{Mode: RedactHash, HashKey: "pepper"})
+		logger.Debug("Making API request",
+			zap.String("endpoint", "https://api.percipio.com/user-management/v1/organizations/org/users/michael%20bolton?role=ADMIN"),
+			zap.String("path", "/user-management/v1/organizations/%s/users/michael%20bolton"),
+			zap.String("user_id", "michael bolton"))
+
+		fields := logs.All()[0].ContextMap()
+		hash := fields["user_id"].(string)
+		assert.Equal(t, "https://api.percipio.com/user-management/v1/organizations/org/users/"+hash+"?role=ADMIN", fields["endpoint"])
+		assert.Equal(t, "/user-management/v1/organizations/%s/users/"+hash, fields["path"])
+
+		logger, logs = observe(t, RedactionOptions{Mode: RedactDrop})
+		logger.Error("Request failed",
+			zap.Error(errors.New(`Get "https://api.percipio.com/user-management/v1/organizations/org/users/michael.bolton": EOF`)),
+			zap.String("endpoint", "https://api.percipio.com/user-management/v1/organizations/org/users"))
+
+		fields = logs.All()[0].ContextMap()
+		assert.Equal(t, `Get "https://api.percipio.com/user-management/v1/organizations/org/users/[redacted]": EOF`, fields["error"])
+		assert.Equal(t, "https://api.percipio.com/user-management/v1/organizations/org/users", fields["endpoint"])
+	})
+
+	t.Run("should keep bearer tokens out whatever the mode", func(t *testing.T) {
+		AddSecret("s3cr3t-token")
+		logger, logs := observe(t, RedactionOptions{Mode: RedactOff})
+		logger.Debug("Making API request",
+			zap.String("authorization", "Bearer abc.def-ghi"),
+			zap.Any("query_params", map[string]string{"token": "s3cr3t-token"}),
+			zap.Error(errors.New("request with s3cr3t-token failed")))
+
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(t, "Bearer [redacted]", fields["authorization"])
+		assert.NotContains(t, fields["query_params"], "s3cr3t-token")
+		assert.Equal(t, "request with [redacted] failed", fields["error"])
+	})
+
+	t.Run("should redact loggers extracted from a context", func(t *testing.T) {
+		require.NoError(t, Configure(RedactionOptions{Mode: RedactDrop}))
+		t.Cleanup(func() { require.NoError(t, Configure(RedactionOptions{})) })
+		core, logs := observer.New(zapcore.DebugLevel)
+		ctx := ctxzap.ToContext(context.Background(), zap.New(core))
+
+		Extract(ctx).Debug("Updating user", zap.String("userId", "michael.bolton"))
+		assert.Empty(t, logs.All()[0].ContextMap())
+	})
+
+	t.Run("should redact what is logged through a context's logger", func(t *testing.T) {
+		require.NoError(t, Configure(RedactionOptions{Mode: RedactDrop}))
+		t.Cleanup(func() { require.NoError(t, Configure(RedactionOptions{})) })
+		core, logs := observer.New(zapcore.DebugLevel)
+		ctx := ToContext(ToContext(ctxzap.ToContext(context.Background(), zap.New(core))))
+
+		ctxzap.Extract(ctx).Debug("http cache miss",
+			zap.String("url", "https://api.percipio.com/user-management/v1/organizations/org/users/michael.bolton"))
+		require.Len(t, logs.All(), 1)
+		assert.Equal(t, "https://api.percipio.com/user-management/v1/organizations/org/users/[redacted]", logs.All()[0].ContextMap()["url"])
+	})
+
+	t.Run("should recognize personal keys by their name", func(t *testing.T) {
+		logger, logs := observe(t, RedactionOptions{Mode: RedactDrop})
+		logger.Info("Matched users",
+			zap.Strings("userIds", []string{"michael.bolton"}),
+			zap.String("manager_email", "bill.lumbergh@initech.com"),
+			zap.String("display-name", "Bill Lumbergh"),
+			zap.String("EmployeeId", "E100"),
+			zap.String("course_name", "Compliance"),
+			zap.Int("unmatched_users", 2))
+
+		assert.Equal(t, map[string]interface{}{"course_name": "Compliance", "unmatched_users": int64(2)}, logs.All()[0].ContextMap())
+	})
+}
@@ -0,0 +1,133 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+// encryptedExtension is appended to the file name of encrypted documents.
+const encryptedExtension = ".age"
+
+// ageHeader starts every binary age file.
+var ageHeader = []byte("age-encryption.org/")
+
+// EncryptionOptions configures how documents are encrypted at rest.
+type EncryptionOptions struct {
+	// Recipients are age public keys (age1...) documents are encrypted to.
+	Recipients []string
+	// IdentityFile is an age identity file (AGE-SECRET-KEY-1... lines)
+	// used to decrypt documents. Documents are also encrypted to the
+	// recipients of its X25519 identities.
+	IdentityFile string
+	// Passphrase encrypts documents with a passphrase instead of keys.
+	Passphrase string
+	// Required refuses to load documents that aren't encrypted. Without
+	// it, plaintext documents from before encryption was configured are
+	// still read, and replaced by encrypted ones when next saved.
+	Required bool
+}
+
+// Encryption encrypts and decrypts documents with age.
+type Encryption struct {
+	recipients []age.Recipient
+	identities []age.Identity
+	required   bool
+}
+
+// NewEncryption parses the configured keys. It returns nil when no
+// encryption is configured.
+func NewEncryption(options EncryptionOptions) (*Encryption, error) {
+	keyed := len(options.Recipients) > 0 || options.IdentityFile != ""
+	switch {
+	case keyed && options.Passphrase != "":
+		return nil, errors.New("invalid state encryption: use either age keys or a passphrase, not both")
+	case !keyed && options.Passphrase == "":
+		if options.Required {
+			return nil, errors.New("invalid state encryption: encryption is required but no age key or passphrase is configured")
+		}
+		return nil, nil
+	case keyed && options.IdentityFile == "":
+		return nil, errors.New("invalid state encryption: an identity file is needed to read back state encrypted to recipients")
+	}
+
+	encryption := &Encryption{required: options.Required}
+	if options.Passphrase != "" {
+		recipient, err := age.NewScryptRecipient(options.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state encryption passphrase: %w", err)
+		}
+		identity, err := age.NewScryptIdentity(options.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state encryption passphrase: %w", err)
+		}
+		encryption.recipients = []age.Recipient{recipient}
+		encryption.identities = []age.Identity{identity}
+		return encryption, nil
+	}
+
+	identities, err := readIdentities(options.IdentityFile)
+	if err != nil {
+		return nil, err
+	}
+	encryption.identities = identities
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			encryption.recipients = append(encryption.recipients, x25519.Recipient())
+		}
+	}
+	for _, value := range options.Recipients {
+		recipient, err := age.ParseX25519Recipient(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state encryption recipient %q: %w", value, err)
+		}
+		encryption.recipients = append(encryption.recipients, recipient)
+	}
+	return encryption, nil
+}
+
+func readIdentities(path string) ([]age.Identity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state encryption identity file: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state encryption identity file %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// encrypt returns data encrypted to the configured recipients.
+func (e *Encryption) encrypt(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := age.Encrypt(&out, e.recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// decrypt returns the plaintext of an age encrypted document.
+func (e *Encryption) decrypt(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, ageHeader) {
+		return nil, errors.New("not an age encrypted file")
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), e.identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,167 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeIdentity writes a new age identity file and returns its path and the
+// identity.
+func writeIdentity(t *testing.T) (string, *age.X25519Identity) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "key.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# test key\n"+identity.String()+"\n"), 0o600))
+	return path, identity
+}
+
+// fastPassphrase returns a passphrase encryption with a low scrypt work
+// factor, so tests don't spend a second per document.
+func fastPassphrase(t *testing.T, passphrase string, required bool) *Encryption {
+	encryption, err := NewEncryption(EncryptionOptions{Passphrase: passphrase, Required: required})
+	require.NoError(t, err)
+	encryption.recipients[0].(*age.ScryptRecipient).SetWorkFactor(10)
+	return encryption
+}
+
+func TestNewEncryption(t *testing.T) {
+	identityFile, identity := writeIdentity(t)
+
+	t.Run("should be disabled without keys", func(t *testing.T) {
+		encryption, err := NewEncryption(EncryptionOptions{})
+		require.NoError(t, err)
+		assert.Nil(t, encryption)
+	})
+
+	t.Run("should encrypt to the identity file and extra recipients", func(t *testing.T) {
+		escrow, err := age.GenerateX25519Identity()
+		require.NoError(t, err)
+
+		encryption, err := NewEncryption(EncryptionOptions{
+			IdentityFile: identityFile,
+			Recipients:   []string{escrow.Recipient().String()},
+		})
+		require.NoError(t, err)
+		assert.Len(t, encryption.recipients, 2)
+		assert.Len(t, encryption.identities, 1)
+
+		ciphertext, err := encryption.encrypt([]byte("secret"))
+		require.NoError(t, err)
+		for _, key := range []age.Identity{identity, escrow} {
+			plaintext, err := (&Encryption{identities: []age.Identity{key}}).decrypt(ciphertext)
+			require.NoError(t, err)
+			assert.Equal(t, "secret", string(plaintext))
+		}
+	})
+
+	for _, tc := range []struct {
+		name    string
+		options EncryptionOptions
+	}{
+		{"required without keys", EncryptionOptions{Required: true}},
+		{"keys and a passphrase", EncryptionOptions{IdentityFile: identityFile, Passphrase: "hunter2"}},
+		{"recipients without an identity file", EncryptionOptions{Recipients: []string{identity.Recipient().String()}}},
+		{"a missing identity file", EncryptionOptions{IdentityFile: filepath.Join(t.TempDir(), "missing")}},
+		{"an invalid recipient", EncryptionOptions{IdentityFile: identityFile, Recipients: []string{"age1nope"}}},
+	} {
+		t.Run("should reject "+tc.name, func(t *testing.T) {
+			_, err := NewEncryption(tc.options)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	identityFile, _ := writeIdentity(t)
+	keyed, err := NewEncryption(EncryptionOptions{IdentityFile: identityFile})
+	require.NoError(t, err)
+
+	for name, encryption := range map[string]*Encryption{
+		"identity file": keyed,
+		"passphrase":    fastPassphrase(t, "correct horse battery staple", false),
+	} {
+		t.Run("should round trip with an "+name, func(t *testing.T) {
+			store := New(t.TempDir())
+			store.SetEncryption(encryption)
+			require.NoError(t, store.Save("doc", document{Name: "initech", Count: 3}))
+
+			data, err := os.ReadFile(store.Path("doc"))
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "initech")
+			assert.Equal(t, ".age", filepath.Ext(store.Path("doc")))
+
+			var loaded document
+			found, err := store.Load("doc", &loaded)
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, document{Name: "initech", Count: 3}, loaded)
+		})
+	}
+
+	t.Run("should migrate plaintext documents unless encryption is required", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, New(dir).Save("doc", document{Name: "plain"}))
+
+		store := New(dir)
+		store.SetEncryption(keyed)
+		var loaded document
+		found, err := store.Load("doc", &loaded)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "plain", loaded.Name)
+
+		require.NoError(t, store.Save("doc", loaded))
+		_, err = os.Stat(filepath.Join(dir, "doc.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist, "the plaintext copy is removed")
+	})
+
+	t.Run("should refuse plaintext documents when encryption is required", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, New(dir).Save("doc", document{Name: "plain"}))
+
+		store := New(dir)
+		store.SetEncryption(fastPassphrase(t, "hunter2", true))
+		var loaded document
+		_, err := store.Load("doc", &loaded)
+		assert.ErrorContains(t, err, "not encrypted")
+	})
+
+	t.Run("should refuse plaintext posing as an encrypted document", func(t *testing.T) {
+		store := New(t.TempDir())
+		store.SetEncryption(keyed)
+		require.NoError(t, os.WriteFile(store.Path("doc"), []byte(`{"name":"plain"}`), 0o600))
+
+		var loaded document
+		_, err := store.Load("doc", &loaded)
+		assert.ErrorContains(t, err, "failed to decrypt")
+	})
+
+	t.Run("should not read encrypted documents without a key", func(t *testing.T) {
+		dir := t.TempDir()
+		encrypted := New(dir)
+		encrypted.SetEncryption(keyed)
+		require.NoError(t, encrypted.Save("doc", document{Name: "initech"}))
+
+		var loaded document
+		_, err := New(dir).Load("doc", &loaded)
+		assert.ErrorContains(t, err, "no state encryption key")
+	})
+
+	t.Run("should not decrypt with the wrong passphrase", func(t *testing.T) {
+		dir := t.TempDir()
+		encrypted := New(dir)
+		encrypted.SetEncryption(fastPassphrase(t, "hunter2", false))
+		require.NoError(t, encrypted.Save("doc", document{Name: "initech"}))
+
+		store := New(dir)
+		store.SetEncryption(fastPassphrase(t, "hunter3", false))
+		var loaded document
+		_, err := store.Load("doc", &loaded)
+		assert.ErrorContains(t, err, "failed to decrypt")
+	})
+}
@@ -0,0 +1,152 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Store persists small JSON documents (guard baselines, cached reports,
+// snapshots) between syncs. Each document is a file named after its key in
+// the store's directory, encrypted with age when the store has an
+// Encryption. A Store with an empty directory is disabled: Load finds
+// nothing and Save is a no-op.
+type Store struct {
+	dir        string
+	encryption *Encryption
+}
+
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Enabled reports whether the store has a directory to write to.
+func (s *Store) Enabled() bool {
+	return s != nil && s.dir != ""
+}
+
+// SetEncryption encrypts the documents saved from now on, and decrypts the
+// encrypted documents loaded. A nil Encryption stores documents in plaintext.
+func (s *Store) SetEncryption(encryption *Encryption) {
+	s.encryption = encryption
+}
+
+// Path returns the file backing the given key.
+func (s *Store) Path(key string) string {
+	if s.encryption != nil {
+		return s.encryptedPath(key)
+	}
+	return s.plaintextPath(key)
+}
+
+func (s *Store) plaintextPath(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+func (s *Store) encryptedPath(key string) string {
+	return s.plaintextPath(key) + encryptedExtension
+}
+
+// Load decodes the document stored under key into target, decrypting it if
+// it is encrypted. It returns false when the store is disabled or the
+// document doesn't exist yet.
+func (s *Store) Load(key string, target any) (bool, error) {
+	if !s.Enabled() {
+		return false, nil
+	}
+
+	data, found, err := s.read(key)
+	if !found || err != nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return false, fmt.Errorf("failed to decode state %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Save encodes value and writes it under key. The write goes to a temporary
+// file that is renamed into place, so a crash never leaves a torn document.
+func (s *Store) Save(key string, value any) error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode state %s: %w", key, err)
+	}
+	if s.encryption != nil {
+		data, err = s.encryption.encrypt(data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt state %s: %w", key, err)
+		}
+	}
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write state %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state %s: %w", key, err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.Path(key)); err != nil {
+		return fmt.Errorf("failed to write state %s: %w", key, err)
+	}
+
+	// Don't leave a plaintext copy behind once the document is encrypted.
+	if s.encryption != nil {
+		if err := os.Remove(s.plaintextPath(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove plaintext state %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// read returns the contents of the document stored under key, decrypted.
+// Plaintext documents are refused when encryption is required, and encrypted
+// ones when the store has no Encryption to decrypt them with.
+func (s *Store) read(key string) ([]byte, bool, error) {
+	if s.encryption != nil {
+		data, err := os.ReadFile(s.encryptedPath(key))
+		if err == nil {
+			data, err = s.encryption.decrypt(data)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to decrypt state %s: %w", key, err)
+			}
+			return data, true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, false, fmt.Errorf("failed to read state %s: %w", key, err)
+		}
+	} else if _, err := os.Stat(s.encryptedPath(key)); err == nil {
+		return nil, false, fmt.Errorf("state %s is encrypted but no state encryption key is configured", key)
+	}
+
+	data, err := os.ReadFile(s.plaintextPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read state %s: %w", key, err)
+	}
+	if s.encryption != nil && s.encryption.required {
+		return nil, false, fmt.Errorf("refusing to read state %s: %s is not encrypted and state encryption is required", key, s.plaintextPath(key))
+	}
+	return data, true, nil
+}
@@ -0,0 +1,56 @@
+package state
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type document struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := New(t.TempDir())
+
+	var missing document
+	found, err := store.Load("doc", &missing)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, store.Save("doc", document{Name: "initech", Count: 3}))
+
+	var loaded document
+	found, err = store.Load("doc", &loaded)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, document{Name: "initech", Count: 3}, loaded)
+
+	info, err := os.Stat(store.Path("doc"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestDisabledStore(t *testing.T) {
+	store := New("")
+	assert.False(t, store.Enabled())
+
+	require.NoError(t, store.Save("doc", document{Name: "ignored"}))
+
+	var loaded document
+	found, err := store.Load("doc", &loaded)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestLoadCorruptDocument(t *testing.T) {
+	store := New(t.TempDir())
+	require.NoError(t, os.WriteFile(store.Path("doc"), []byte("{not json"), 0o600))
+
+	var loaded document
+	_, err := store.Load("doc", &loaded)
+	assert.Error(t, err)
+}